@@ -0,0 +1,35 @@
+package lumberjack
+
+import "sync/atomic"
+
+// maxUnlockedAppend is the largest write UnlockedAppend makes without the
+// Logger's lock: the smallest PIPE_BUF POSIX allows.
+const maxUnlockedAppend = 512
+
+// unlockedAppend writes p while holding l.mu only for reading, if it can be
+// done without changing the Logger's state.  ok is false if the write has to
+// take the lock instead, because the file isn't open, it must rotate, or p is
+// too long.
+func (l *Logger) unlockedAppend(p []byte) (n int, ok bool, err error) {
+	if len(p) > maxUnlockedAppend || l.LogSplitDay > 0 || l.LogSplitHour > 0 || l.SyncEveryNLines > 0 || l.MinFreeDiskMB > 0 || l.PersistCounters || l.BufferSize > 0 || l.HashChain || l.ExclusiveLock {
+		return 0, false, nil
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.file == nil || len(l.fallback) > 0 {
+		return 0, false, nil
+	}
+	// reserve room for p, so that concurrent writes can't together take the
+	// file past LogMaxSize.
+	writeLen := int64(len(p))
+	if atomic.AddInt64(&l.size, writeLen) > l.max() {
+		atomic.AddInt64(&l.size, -writeLen)
+		return 0, false, nil
+	}
+	n, err = l.writeAll(l.file, p)
+	if n < len(p) {
+		atomic.AddInt64(&l.size, int64(n-len(p)))
+	}
+	return n, true, err
+}
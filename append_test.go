@@ -0,0 +1,123 @@
+package lumberjack
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUnlockedAppend(t *testing.T) {
+	currentTime = fakeTime
+	megabyte = 1
+	defer func() { megabyte = 1024 * 1024 }()
+	dir := makeTempDir("TestUnlockedAppend", t)
+	defer os.RemoveAll(dir)
+
+	// backups all get the same name when the time doesn't move, so give
+	// each rotation a new time.
+	var mu sync.Mutex
+	now := fakeTime()
+	currentTime = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(time.Second)
+		return now
+	}
+	defer func() { currentTime = fakeTime }()
+
+	const maxSize = 1000
+	l := &Logger{
+		fullPathFileName: logFile(dir),
+		LogMaxSize:       maxSize,
+		UnlockedAppend:   true,
+	}
+	const writers, lines = 8, 200
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < lines; i++ {
+				if _, err := l.Write([]byte(fmt.Sprintf("%d %03d\n", w, i))); err != nil {
+					t.Errorf("write failed: %v", err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	isNil(l.Close(), t)
+
+	// every line landed whole, once, and no file went past the limit.
+	files, err := ioutil.ReadDir(dir)
+	isNil(err, t)
+	assert(len(files) > 1, t, "expected the file to rotate")
+	seen := make(map[string]bool)
+	for _, f := range files {
+		assert(f.Size() <= maxSize, t, "%s is %d bytes, over %d", f.Name(), f.Size(), maxSize)
+		file, err := os.Open(filepath.Join(dir, f.Name()))
+		isNil(err, t)
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := scanner.Text()
+			var w, i int
+			_, err := fmt.Sscanf(line, "%d %d", &w, &i)
+			isNil(err, t)
+			assert(!seen[line], t, "line %q written twice", line)
+			seen[line] = true
+		}
+		file.Close()
+	}
+	equals(writers*lines, len(seen), t)
+}
+
+func TestUnlockedAppendExclusiveLock(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestUnlockedAppendExclusiveLock", t)
+	defer os.RemoveAll(dir)
+
+	l := &Logger{
+		fullPathFileName: logFile(dir),
+		UnlockedAppend:   true,
+	}
+	defer l.Close()
+	_, err := l.Write([]byte("boo!\n"))
+	isNil(err, t)
+	_, ok, err := l.unlockedAppend([]byte("foo!\n"))
+	isNil(err, t)
+	equals(true, ok, t)
+
+	// writes with ExclusiveLock take the lock file, so they take the
+	// Logger's lock too.
+	l.ExclusiveLock = true
+	_, ok, err = l.unlockedAppend([]byte("bar!\n"))
+	isNil(err, t)
+	equals(false, ok, t)
+	existsWithContent(logFile(dir), []byte("boo!\nfoo!\n"), t)
+}
+
+func BenchmarkUnlockedAppend(b *testing.B) {
+	for _, unlocked := range []bool{false, true} {
+		b.Run(fmt.Sprintf("unlocked=%v", unlocked), func(b *testing.B) {
+			dir := makeTempDir("BenchmarkUnlockedAppend", b)
+			defer os.RemoveAll(dir)
+			l := &Logger{
+				fullPathFileName: logFile(dir),
+				UnlockedAppend:   unlocked,
+			}
+			defer l.Close()
+			line := []byte(strings.Repeat("x", 99) + "\n")
+			b.SetBytes(int64(len(line)))
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					l.Write(line)
+				}
+			})
+		})
+	}
+}
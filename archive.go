@@ -0,0 +1,73 @@
+package lumberjack
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// osLink exists so it can be mocked out by tests.
+var osLink = os.Link
+
+// archive links the new backup into ArchiveHardlinkDir, copying it if it
+// can't be linked.
+func (l *Logger) archive(backup string) {
+	if l.ArchiveHardlinkDir == "" {
+		return
+	}
+	if err := os.MkdirAll(l.ArchiveHardlinkDir, l.dirMode()); err != nil {
+		l.handleError(fmt.Errorf("can't make archive directory: %w", err))
+		return
+	}
+	dst := filepath.Join(l.ArchiveHardlinkDir, filepath.Base(backup))
+	err := osLink(backup, dst)
+	if err == nil {
+		return
+	}
+	// a file of that name is there already; don't replace it.
+	if !os.IsExist(err) {
+		err = copyFile(backup, dst, l.tempSuffix())
+	}
+	if err != nil {
+		l.handleError(fmt.Errorf("can't archive %s: %w", backup, err))
+	}
+}
+
+// copyFile copies src to dst through a temporary file, with the extension
+// tmpSuffix, so that dst is never seen half written.
+func copyFile(src, dst, tmpSuffix string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := ioutil.TempFile(filepath.Dir(dst), "."+filepath.Base(dst)+"*"+tmpSuffix)
+	if err != nil {
+		return err
+	}
+	tmp := out.Name()
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Chmod(tmp, info.Mode()); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
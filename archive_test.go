@@ -0,0 +1,74 @@
+package lumberjack
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestArchiveHardlinkDir(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestArchiveHardlinkDir", t)
+	defer os.RemoveAll(dir)
+	archiveDir := filepath.Join(dir, "archive")
+
+	l := &Logger{
+		fullPathFileName:   filepath.Join(dir, "logs", "foobar.log"),
+		ArchiveHardlinkDir: archiveDir,
+	}
+	defer l.Close()
+	_, err := l.Write([]byte("boo!"))
+	isNil(err, t)
+	newFakeTime()
+	err = l.Rotate()
+	isNil(err, t)
+
+	backup := backupFile(filepath.Join(dir, "logs"))
+	archived := backupFile(archiveDir)
+	existsWithContent(backup, []byte("boo!"), t)
+	existsWithContent(archived, []byte("boo!"), t)
+	local, err := os.Stat(backup)
+	isNil(err, t)
+	linked, err := os.Stat(archived)
+	isNil(err, t)
+	assert(os.SameFile(local, linked), t, "expected %s to be a hardlink of %s", archived, backup)
+
+	// each copy has a life of its own.
+	err = os.Remove(backup)
+	isNil(err, t)
+	existsWithContent(archived, []byte("boo!"), t)
+}
+
+func TestArchiveHardlinkDirCrossDevice(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestArchiveHardlinkDirCrossDevice", t)
+	defer os.RemoveAll(dir)
+	archiveDir := filepath.Join(dir, "archive")
+
+	osLink = func(oldname, newname string) error {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: syscall.EXDEV}
+	}
+	defer func() { osLink = os.Link }()
+
+	l := &Logger{
+		fullPathFileName:   logFile(dir),
+		ArchiveHardlinkDir: archiveDir,
+		ErrorHandler:       func(err error) { t.Errorf("unexpected error: %v", err) },
+	}
+	defer l.Close()
+	_, err := l.Write([]byte("boo!"))
+	isNil(err, t)
+	newFakeTime()
+	err = l.Rotate()
+	isNil(err, t)
+
+	existsWithContent(backupFile(dir), []byte("boo!"), t)
+	existsWithContent(backupFile(archiveDir), []byte("boo!"), t)
+	local, err := os.Stat(backupFile(dir))
+	isNil(err, t)
+	copied, err := os.Stat(backupFile(archiveDir))
+	isNil(err, t)
+	assert(!os.SameFile(local, copied), t, "expected %s to be a copy", backupFile(archiveDir))
+	fileCount(archiveDir, 1, t)
+}
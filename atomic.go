@@ -0,0 +1,19 @@
+package lumberjack
+
+// WriteAtomic writes p, a record such as a multi-line stack trace, so that
+// it lands whole in one file.  Like Write, if p doesn't fit in the current
+// file, the file is rotated first.  Unlike Write, a p longer than the
+// maximum file size is not refused: the current file is rotated unless it is
+// empty, and p is written whole to the new one, which ends up larger than
+// LogMaxSize.  Writes buffered by WriteShards are flushed first, so p comes
+// after them.
+func (l *Logger) WriteAtomic(p []byte) (int, error) {
+	if l.WriteShards > 0 {
+		l.flushShards()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n, _, err := l.writeRecord(p, true)
+	return n, err
+}
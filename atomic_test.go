@@ -0,0 +1,50 @@
+package lumberjack
+
+import (
+	"os"
+	"testing"
+)
+
+func TestWriteAtomic(t *testing.T) {
+	currentTime = fakeTime
+	megabyte = 1
+	dir := makeTempDir("TestWriteAtomic", t)
+	defer os.RemoveAll(dir)
+
+	l := &Logger{
+		fullPathFileName: logFile(dir),
+		LogMaxSize:       10,
+	}
+	defer l.Close()
+	_, err := l.Write([]byte("boo!\n"))
+	isNil(err, t)
+
+	// the trace doesn't fit after the first line, so it starts a new file.
+	trace := []byte("panic\n a\n")
+	newFakeTime()
+	n, err := l.WriteAtomic(trace)
+	isNil(err, t)
+	equals(len(trace), n, t)
+	existsWithContent(backupFile(dir), []byte("boo!\n"), t)
+	existsWithContent(logFile(dir), trace, t)
+
+	// one longer than the file may be gets a file of its own.
+	long := []byte("panic\n a\n b\n c\n")
+	_, err = l.Write(long)
+	notNil(err, t)
+	newFakeTime()
+	n, err = l.WriteAtomic(long)
+	isNil(err, t)
+	equals(len(long), n, t)
+	existsWithContent(backupFile(dir), trace, t)
+	existsWithContent(logFile(dir), long, t)
+
+	newFakeTime()
+	_, err = l.Write([]byte("boo!\n"))
+	isNil(err, t)
+	existsWithContent(backupFile(dir), long, t)
+	existsWithContent(logFile(dir), []byte("boo!\n"), t)
+	files, err := l.oldLogFiles()
+	isNil(err, t)
+	equals(3, len(files), t)
+}
@@ -0,0 +1,96 @@
+package lumberjack
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// auditRecord is one line of the AuditLog.
+type auditRecord struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	File   string    `json:"file"`
+	Size   int64     `json:"size"`
+	SHA256 string    `json:"sha256"`
+	Prev   string    `json:"prev"`
+}
+
+// audit records ev in the AuditLog, if any.  Failures are passed to the
+// ErrorHandler, like those of MetricsSink.
+func (l *Logger) audit(ev event) {
+	if l.AuditLog == nil {
+		return
+	}
+	if w, ok := l.AuditLog.(*Logger); ok && w == l {
+		l.handleError(errors.New("AuditLog must not be the Logger itself"))
+		return
+	}
+	sum := ev.sum
+	if sum == "" && ev.Type != EventRemove {
+		var err error
+		if sum, err = fileChecksum(l.fs(), ev.File); err != nil {
+			l.handleError(fmt.Errorf("can't checksum %s for the audit log: %s", ev.File, err))
+		}
+	}
+
+	l.sinkMu.Lock()
+	defer l.sinkMu.Unlock()
+	rec := auditRecord{
+		Time:   ev.Time,
+		Action: ev.Type,
+		File:   ev.File,
+		Size:   ev.Size,
+		SHA256: sum,
+		Prev:   l.auditPrev,
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		l.handleError(fmt.Errorf("can't encode audit record: %s", err))
+		return
+	}
+	b = append(b, '\n')
+	if _, err := l.AuditLog.Write(b); err != nil {
+		l.handleError(fmt.Errorf("can't write audit record: %s", err))
+		return
+	}
+	l.auditPrev = checksum(b)
+}
+
+// auditChecksum returns the checksum to record for a file about to be
+// removed, or "" if there is no AuditLog.
+func (l *Logger) auditChecksum(name string) string {
+	if l.AuditLog == nil {
+		return ""
+	}
+	sum, err := fileChecksum(l.fs(), name)
+	if err != nil {
+		l.handleError(fmt.Errorf("can't checksum %s for the audit log: %s", name, err))
+	}
+	return sum
+}
+
+// fileChecksum returns the hex SHA-256 of the contents of the file in fsys.
+func fileChecksum(fsys FileSystem, name string) (string, error) {
+	f, err := fsys.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checksum returns the hex SHA-256 of b.
+func checksum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
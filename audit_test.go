@@ -0,0 +1,106 @@
+package lumberjack
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAuditLog(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestAuditLog", t)
+	defer os.RemoveAll(dir)
+
+	audit := new(bytes.Buffer)
+	l := &Logger{
+		fullPathFileName:   logFile(dir),
+		AuditLog:           audit,
+		LogMaxSaveQuantity: 1,
+	}
+	defer closeWait(l, t)
+
+	sum := func(b []byte) string {
+		s := sha256.Sum256(b)
+		return hex.EncodeToString(s[:])
+	}
+	b := []byte("boo!")
+	_, err := l.Write(b)
+	isNil(err, t)
+	newFakeTime()
+	isNil(l.Rotate(), t)
+	first := backupFile(dir)
+	l.waitMill()
+
+	b2 := []byte("foooooo!")
+	_, err = l.Write(b2)
+	isNil(err, t)
+	newFakeTime()
+	isNil(l.Rotate(), t)
+	// the removal is recorded by the mill.
+	l.waitMill()
+
+	want := []auditRecord{
+		{Action: EventRotate, File: first, Size: int64(len(b)), SHA256: sum(b)},
+		{Action: EventRotate, File: backupFile(dir), Size: int64(len(b2)), SHA256: sum(b2)},
+		{Action: EventRemove, File: first, Size: int64(len(b)), SHA256: sum(b)},
+	}
+	scanner := bufio.NewScanner(audit)
+	prev := ""
+	i := 0
+	for ; scanner.Scan(); i++ {
+		assert(i < len(want), t, "unexpected record %s", scanner.Text())
+		var rec auditRecord
+		isNil(json.Unmarshal(scanner.Bytes(), &rec), t)
+		equals(want[i].Action, rec.Action, t)
+		equals(want[i].File, rec.File, t)
+		equals(want[i].Size, rec.Size, t)
+		equals(want[i].SHA256, rec.SHA256, t)
+		// each record is chained to the one before.
+		equals(prev, rec.Prev, t)
+		prev = sum(append(scanner.Bytes(), '\n'))
+	}
+	equals(len(want), i, t)
+}
+
+func TestAuditLogStartupRotation(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestAuditLogStartupRotation", t)
+	defer os.RemoveAll(dir)
+
+	lastWrite := fakeTime().UTC().Add(-72 * time.Hour).Truncate(time.Second)
+	data := []byte(lastWrite.Format("2006-01-02 15:04:05") + " bye\n")
+	err := ioutil.WriteFile(logFile(dir), data, 0644)
+	isNil(err, t)
+
+	audit := new(bytes.Buffer)
+	l := &Logger{
+		LogPathName:       dir + string(filepath.Separator),
+		LogFileName:       "foobar",
+		LogFileSuffix:     ".log",
+		LogFileTimeFormat: "2006-01-02 15:04:05",
+		AuditLog:          audit,
+	}
+	defer l.Close()
+	// the file Init moves aside gets a record like any other rotation.
+	isNil(l.Init(), t)
+	backup := filepath.Join(dir, "foobar-"+lastWrite.Format(backupTimeFormat)+".log")
+
+	var rec auditRecord
+	line, err := audit.ReadBytes('\n')
+	isNil(err, t)
+	isNil(json.Unmarshal(line, &rec), t)
+	equals(EventRotate, rec.Action, t)
+	equals(backup, rec.File, t)
+	equals(int64(len(data)), rec.Size, t)
+	s := sha256.Sum256(data)
+	equals(hex.EncodeToString(s[:]), rec.SHA256, t)
+	equals("", rec.Prev, t)
+	equals(0, audit.Len(), t)
+}
@@ -0,0 +1,295 @@
+package lumberjack
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Orphans returns the paths of backups that belong to this Logger but that it
+// no longer manages, typically because they were compressed with a
+// Compressor other than the configured one (say .gz files after switching to
+// zstd).  Retention never removes such files.  Only files whose names start
+// with the Logger's prefix and carry one of its backup timestamps are
+// considered.
+func (l *Logger) Orphans() ([]string, error) {
+	files, err := l.fs().ReadDir(l.dir())
+	if err != nil {
+		return nil, fmt.Errorf("can't read log file directory: %s", err)
+	}
+	prefix, ext := l.prefixAndExt()
+	cext := l.compressedExt(ext, l.compressor())
+
+	var orphans []string
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		name := f.Name()
+		if l.isBackupName(name, prefix, ext) || l.isBackupName(name, prefix, cext) {
+			continue
+		}
+		// look for a backup name, with or without its extension, followed by
+		// some other suffix.
+		for i := len(prefix); i < len(name); i++ {
+			if name[i] != '.' {
+				continue
+			}
+			if l.isBackupName(name[:i], prefix, ext) || l.isBackupName(name[:i], prefix, "") {
+				orphans = append(orphans, filepath.Join(l.dir(), name))
+				break
+			}
+		}
+	}
+	return orphans, nil
+}
+
+// isBackupName reports whether name has the form of one of the Logger's
+// backups.
+func (l *Logger) isBackupName(name, prefix, ext string) bool {
+	if l.GenerationNaming {
+		_, err := generationFromName(name, prefix, ext)
+		return err == nil
+	}
+	_, err := l.timeFromName(name, prefix, ext)
+	return err == nil
+}
+
+// ReclaimOrphans removes the files reported by Orphans, returning the paths it
+// removed.
+func (l *Logger) ReclaimOrphans() ([]string, error) {
+	orphans, err := l.Orphans()
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for _, name := range orphans {
+		errRemove := l.fs().Remove(name)
+		if errRemove != nil {
+			if err == nil {
+				err = errRemove
+			}
+			continue
+		}
+		removed = append(removed, name)
+	}
+	return removed, err
+}
+
+// MigrateBackups renames backups whose timestamps use oldLayout, such as the
+// "2006-01-02T15-04-05.000" of the original lumberjack, to the current
+// naming scheme so that retention manages them again.  Compressed backups
+// keep their compressor's suffix.  It returns the number of backups renamed.
+// A backup whose new name is already taken, as happens when two old backups
+// fall within the same second, is left alone and reported in the error.
+// The current scheme includes any BackupTimeFormat.  It isn't supported
+// with GenerationNaming or DailyBackupNaming.
+func (l *Logger) MigrateBackups(oldLayout string) (int, error) {
+	if l.GenerationNaming {
+		return 0, errors.New("can't migrate backups to generation naming")
+	}
+	if l.DailyBackupNaming {
+		return 0, errors.New("can't migrate backups to daily naming")
+	}
+	files, err := l.fs().ReadDir(l.dir())
+	if err != nil {
+		return 0, fmt.Errorf("can't read log file directory: %s", err)
+	}
+	prefix, ext := l.prefixAndExt()
+	cext := l.compressedExt(ext, l.compressor())
+
+	migrated := 0
+	var errs []string
+	for _, f := range files {
+		if f.IsDir() || !strings.HasPrefix(f.Name(), prefix) {
+			continue
+		}
+		name, compressed := f.Name(), false
+		if strings.HasSuffix(name, cext) {
+			name, compressed = strings.TrimSuffix(name, cext)+ext, true
+		}
+		if !strings.HasSuffix(name, ext) {
+			continue
+		}
+		// already in the current scheme.  This has to compare the text,
+		// since time.Parse accepts fractional seconds the layout lacks.
+		ts := name[len(prefix) : len(name)-len(ext)]
+		if t, seq, err := l.timeSeqFromName(name, prefix, ext); err == nil && (seq > 0 || t.Format(l.backupTimeFormat()) == ts) {
+			continue
+		}
+		t, err := time.ParseInLocation(oldLayout, ts, l.location())
+		if err != nil {
+			continue
+		}
+		src := filepath.Join(l.dir(), f.Name())
+		dst := prefix + t.Format(l.backupTimeFormat()) + ext
+		if compressed {
+			dst = prefix + t.Format(l.backupTimeFormat()) + cext
+		}
+		dst = filepath.Join(l.dir(), dst)
+		if _, err := l.fs().Stat(dst); err == nil {
+			errs = append(errs, fmt.Sprintf("%s: %s already exists", src, dst))
+			continue
+		}
+		if err := l.fs().Rename(src, dst); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		migrated++
+	}
+	if len(errs) > 0 {
+		return migrated, fmt.Errorf("can't migrate all backups: %s", strings.Join(errs, "; "))
+	}
+	return migrated, nil
+}
+
+// DiskUsage returns the bytes used by the current log file and by the
+// backups retention manages, with compressed backups counted at their size on
+// disk.  It doesn't change anything.
+func (l *Logger) DiskUsage() (active int64, backups int64, err error) {
+	info, err := l.fs().Stat(l.filename())
+	if err == nil {
+		active = info.Size()
+	} else if !os.IsNotExist(err) {
+		return 0, 0, fmt.Errorf("error getting log file info: %s", err)
+	}
+	files, err := l.oldLogFiles()
+	if err != nil {
+		return active, 0, err
+	}
+	for _, f := range files {
+		backups += f.Size()
+	}
+	return active, backups, nil
+}
+
+// BackupInfo describes a backup.
+type BackupInfo struct {
+	// Name is the backup's file name, and Path its full path.
+	Name string
+	Path string
+
+	// Time is when the backup was rotated, as formatted in its name, or its
+	// modification time with GenerationNaming.
+	Time time.Time
+
+	// Size is the backup's size on disk, compressed or not.
+	Size int64
+
+	// Compressed reports whether the backup has been compressed.
+	Compressed bool
+}
+
+// Backups returns the backups retention manages, newest first.
+func (l *Logger) Backups() ([]BackupInfo, error) {
+	files, err := l.oldLogFiles()
+	if err != nil {
+		return nil, err
+	}
+	backups := make([]BackupInfo, len(files))
+	for i, f := range files {
+		backups[i] = BackupInfo{
+			Name:       f.Name(),
+			Path:       filepath.Join(l.dir(), f.Name()),
+			Time:       f.timestamp,
+			Size:       f.Size(),
+			Compressed: l.IsCompressed(f.Name()),
+		}
+	}
+	return backups, nil
+}
+
+// ReconcileReport sorts the files in the log directory that look like a
+// Logger's, by their names, into what they are.  Every list is sorted.
+type ReconcileReport struct {
+	// Active is the log file, or empty if it doesn't exist.
+	Active string
+
+	// Backups are the backups retention manages.
+	Backups []string
+
+	// Sidecars are the files kept beside the log file: the generation
+	// record of GenerationNaming and the CurrentMarker, PersistCounters,
+	// ExclusiveLock and HashChain files.
+	Sidecars []string
+
+	// Temp are the temporary files used to replace sidecars and to probe the
+	// directory at Init.  They only last as long as the operation making
+	// them, so any found while the Logger is idle were left by a crash.
+	Temp []string
+
+	// Leaks are the files named after the log file that are none of the
+	// above, such as backups made by another Compressor, as Orphans
+	// reports, or a compressed backup next to its original, as a
+	// compression cut short leaves behind.
+	Leaks []string
+}
+
+// Reconcile lists the files in the log directory whose names start with the
+// log file's name, less its extension, or with a dot and its name, and
+// reports what each of them is, so that tests and operators can check that
+// rotation and retention leave nothing unaccounted for.  It doesn't change
+// anything.  Run it while the Logger is idle, say after Prune, since files
+// being rotated or compressed may otherwise be reported as leaks.
+func (l *Logger) Reconcile() (*ReconcileReport, error) {
+	files, err := l.fs().ReadDir(l.dir())
+	if err != nil {
+		return nil, fmt.Errorf("can't read log file directory: %s", err)
+	}
+	backups, err := l.oldLogFiles()
+	if err != nil {
+		return nil, err
+	}
+	base := filepath.Base(l.filename())
+	stem := base[:len(base)-len(filepath.Ext(base))]
+	generation := filepath.Base(l.generationFile())
+	marker := filepath.Base(l.markerFile())
+	counters := filepath.Base(l.countersFile())
+	lock := filepath.Base(l.lockFile())
+	chain := filepath.Base(l.chainFile())
+
+	isBackup := make(map[string]bool)
+	uncompressed := make(map[string]bool)
+	for _, f := range backups {
+		isBackup[f.Name()] = true
+		if !l.IsCompressed(f.Name()) {
+			uncompressed[l.backupStem(f.Name())] = true
+		}
+	}
+
+	report := &ReconcileReport{}
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasPrefix(name, stem) && !strings.HasPrefix(name, "."+stem) {
+			continue
+		}
+		path := filepath.Join(l.dir(), name)
+		switch {
+		case name == base:
+			report.Active = path
+		case isBackup[name] && l.IsCompressed(name) && uncompressed[l.backupStem(name)]:
+			report.Leaks = append(report.Leaks, path)
+		case isBackup[name]:
+			report.Backups = append(report.Backups, path)
+		case name == generation || name == marker || name == counters || name == lock || name == chain:
+			report.Sidecars = append(report.Sidecars, path)
+		case name == generation+l.tempSuffix(),
+			isTemp(name, marker, l.tempSuffix()),
+			isTemp(name, counters, l.tempSuffix()),
+			strings.HasPrefix(name, "."+base+".probe"):
+			report.Temp = append(report.Temp, path)
+		default:
+			report.Leaks = append(report.Leaks, path)
+		}
+	}
+	return report, nil
+}
+
+// isTemp reports whether name is one of the temporary files writeFileAtomic
+// uses to replace base.
+func isTemp(name, base, tmpSuffix string) bool {
+	return strings.HasPrefix(name, "."+base) && strings.HasSuffix(name, tmpSuffix)
+}
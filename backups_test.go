@@ -0,0 +1,232 @@
+package lumberjack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReclaimOrphans(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestReclaimOrphans", t)
+	defer os.RemoveAll(dir)
+
+	data := []byte("data")
+	gz := backupFile(dir) + compressSuffix
+	err := ioutil.WriteFile(gz, data, 0644)
+	isNil(err, t)
+	newFakeTime()
+	up := backupFile(dir) + ".up"
+	err = ioutil.WriteFile(up, data, 0644)
+	isNil(err, t)
+	newFakeTime()
+	plain := backupFile(dir)
+	err = ioutil.WriteFile(plain, data, 0644)
+	isNil(err, t)
+	notOurs := filepath.Join(dir, "other-2014-05-04T14-44-33.log.gz")
+	err = ioutil.WriteFile(notOurs, data, 0644)
+	isNil(err, t)
+	notBackup := logFile(dir) + ".foo"
+	err = ioutil.WriteFile(notBackup, data, 0644)
+	isNil(err, t)
+
+	// the .gz backup was made before switching compressors.
+	l := &Logger{
+		fullPathFileName: logFile(dir),
+		Compress:         true,
+		Compressor:       upperCompressor{},
+	}
+	orphans, err := l.Orphans()
+	isNil(err, t)
+	equals([]string{gz}, orphans, t)
+	exists(gz, t)
+
+	removed, err := l.ReclaimOrphans()
+	isNil(err, t)
+	equals([]string{gz}, removed, t)
+	notExist(gz, t)
+	exists(up, t)
+	exists(plain, t)
+	exists(notOurs, t)
+	exists(notBackup, t)
+}
+
+func TestMigrateBackups(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestMigrateBackups", t)
+	defer os.RemoveAll(dir)
+
+	const oldLayout = "2006-01-02T15-04-05.000"
+	data := []byte("data")
+	base := fakeTime().UTC().Truncate(time.Second).Add(250 * time.Millisecond)
+	var old, migrated []string
+	for i, ext := range []string{".log", ".log.gz", ".log"} {
+		ts := base.Add(time.Duration(i) * time.Hour)
+		name := filepath.Join(dir, "foobar-"+ts.Format(oldLayout)+ext)
+		err := ioutil.WriteFile(name, data, 0644)
+		isNil(err, t)
+		old = append(old, name)
+		migrated = append(migrated, filepath.Join(dir, "foobar-"+ts.Format(backupTimeFormat)+ext))
+	}
+	// a second one in the same second can't be migrated.
+	clash := filepath.Join(dir, "foobar-"+base.Add(500*time.Millisecond).Format(oldLayout)+".log")
+	err := ioutil.WriteFile(clash, data, 0644)
+	isNil(err, t)
+
+	l := &Logger{
+		fullPathFileName:   logFile(dir),
+		LogMaxSaveQuantity: 2,
+	}
+	defer closeWait(l, t)
+	n, err := l.MigrateBackups(oldLayout)
+	notNil(err, t)
+	equals(3, n, t)
+	for i := range old {
+		notExist(old[i], t)
+		exists(migrated[i], t)
+	}
+	exists(clash, t)
+
+	// retention orders them with the rest; the one left behind is still
+	// recognized, since parsing tolerates the fractional seconds.
+	files, err := l.oldLogFiles()
+	isNil(err, t)
+	equals(4, len(files), t)
+	err = l.Rotate()
+	isNil(err, t)
+	l.waitMill()
+	notExist(migrated[0], t)
+	notExist(clash, t)
+	exists(migrated[1], t)
+	exists(migrated[2], t)
+}
+
+func TestDiskUsage(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestDiskUsage", t)
+	defer os.RemoveAll(dir)
+
+	l := &Logger{fullPathFileName: logFile(dir)}
+	active, backups, err := l.DiskUsage()
+	isNil(err, t)
+	equals(int64(0), active, t)
+	equals(int64(0), backups, t)
+
+	err = ioutil.WriteFile(logFile(dir), bytes.Repeat([]byte("a"), 100), 0644)
+	isNil(err, t)
+	for _, size := range []int{10, 20} {
+		newFakeTime()
+		err = ioutil.WriteFile(backupFile(dir), bytes.Repeat([]byte("b"), size), 0644)
+		isNil(err, t)
+	}
+	newFakeTime()
+	err = ioutil.WriteFile(backupFile(dir)+compressSuffix, bytes.Repeat([]byte("c"), 30), 0644)
+	isNil(err, t)
+	// not a backup.
+	err = ioutil.WriteFile(filepath.Join(dir, "other.log"), bytes.Repeat([]byte("d"), 40), 0644)
+	isNil(err, t)
+
+	active, backups, err = l.DiskUsage()
+	isNil(err, t)
+	equals(int64(100), active, t)
+	equals(int64(60), backups, t)
+}
+
+func TestBackups(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestBackups", t)
+	defer os.RemoveAll(dir)
+
+	l := &Logger{fullPathFileName: logFile(dir)}
+	backups, err := l.Backups()
+	isNil(err, t)
+	equals(0, len(backups), t)
+
+	older := fakeTime().UTC().Truncate(time.Second)
+	err = ioutil.WriteFile(backupFile(dir)+compressSuffix, []byte("older"), 0644)
+	isNil(err, t)
+	newFakeTime()
+	newer := fakeTime().UTC().Truncate(time.Second)
+	err = ioutil.WriteFile(backupFile(dir), []byte("newer!"), 0644)
+	isNil(err, t)
+	err = ioutil.WriteFile(logFile(dir), []byte("current"), 0644)
+	isNil(err, t)
+
+	backups, err = l.Backups()
+	isNil(err, t)
+	equals(2, len(backups), t)
+	equals(filepath.Base(backupFile(dir)), backups[0].Name, t)
+	equals(backupFile(dir), backups[0].Path, t)
+	equals(true, backups[0].Time.Equal(newer), t)
+	equals(int64(6), backups[0].Size, t)
+	equals(false, backups[0].Compressed, t)
+	equals(true, backups[1].Time.Equal(older), t)
+	equals(int64(5), backups[1].Size, t)
+	equals(true, backups[1].Compressed, t)
+}
+
+func TestReconcile(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestReconcile", t)
+	defer os.RemoveAll(dir)
+
+	compressed := backupFile(dir) + compressSuffix
+	err := ioutil.WriteFile(backupFile(dir), []byte("data"), 0644)
+	isNil(err, t)
+	l := &Logger{
+		fullPathFileName: logFile(dir),
+		Compress:         true,
+		CurrentMarker:    true,
+		LazyMill:         true,
+	}
+	defer l.Close()
+	_, err = l.Write([]byte("boo!"))
+	isNil(err, t)
+	err = l.millRunOnce()
+	isNil(err, t)
+	exists(compressed, t)
+
+	// a clean directory has nothing to report.
+	marker := filepath.Join(dir, "foobar.current")
+	report, err := l.Reconcile()
+	isNil(err, t)
+	equals(&ReconcileReport{
+		Active:   logFile(dir),
+		Backups:  []string{compressed},
+		Sidecars: []string{marker},
+	}, report, t)
+
+	// a compression cut short, a stray temporary file and a probe left by a
+	// crash.
+	newFakeTime()
+	plain := backupFile(dir)
+	err = ioutil.WriteFile(plain, []byte("data"), 0644)
+	isNil(err, t)
+	truncated := plain + compressSuffix
+	err = ioutil.WriteFile(truncated, []byte{0x1f}, 0644)
+	isNil(err, t)
+	stray := compressed + ".tmp"
+	err = ioutil.WriteFile(stray, []byte("data"), 0644)
+	isNil(err, t)
+	probe := filepath.Join(dir, ".foobar.log.probe123")
+	err = ioutil.WriteFile(probe, nil, 0644)
+	isNil(err, t)
+	notOurs := filepath.Join(dir, "other.log")
+	err = ioutil.WriteFile(notOurs, []byte("data"), 0644)
+	isNil(err, t)
+
+	report, err = l.Reconcile()
+	isNil(err, t)
+	equals(&ReconcileReport{
+		Active:   logFile(dir),
+		Backups:  []string{compressed, plain},
+		Sidecars: []string{marker},
+		Temp:     []string{probe},
+		Leaks:    []string{stray, truncated},
+	}, report, t)
+	exists(truncated, t)
+	exists(stray, t)
+}
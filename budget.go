@@ -0,0 +1,67 @@
+package lumberjack
+
+import (
+	"sync"
+)
+
+// compressMemoryEstimate is the memory one in-flight compression is assumed to
+// use.  A compress/flate writer keeps roughly 800KB of sliding window, hash
+// chains and token buffers, and io.Copy adds a 32KB transfer buffer, so each
+// active compressor is charged a rounded-up 1MB against the budget.
+const compressMemoryEstimate = 1024 * 1024
+
+// compressBudget is shared by every Logger in the process.
+var compressBudget = newMemoryBudget()
+
+// SetCompressMemoryBudget bounds the memory used by compressions that run at
+// the same time, across all Loggers in the process.  Each running compression
+// is charged compressMemoryEstimate bytes (about 1MB), so a budget of 4MB lets
+// at most four compressions proceed concurrently and the rest wait their
+// turn.  A budget smaller than a single compression still lets one run at a
+// time.  A budget of zero or less, the default, disables the limit.
+func SetCompressMemoryBudget(bytes int64) {
+	compressBudget.setLimit(bytes)
+}
+
+// memoryBudget is a weighted semaphore that throttles work by its estimated
+// memory cost.
+type memoryBudget struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	limit int64
+	inUse int64
+}
+
+func newMemoryBudget() *memoryBudget {
+	b := &memoryBudget{}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// setLimit changes the budget and wakes any waiters so they re-check it.
+func (b *memoryBudget) setLimit(limit int64) {
+	b.mu.Lock()
+	b.limit = limit
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+// acquire blocks until n bytes fit in the budget.  When nothing else holds
+// the budget, acquire always succeeds so that an undersized budget can't
+// deadlock.
+func (b *memoryBudget) acquire(n int64) {
+	b.mu.Lock()
+	for b.limit > 0 && b.inUse > 0 && b.inUse+n > b.limit {
+		b.cond.Wait()
+	}
+	b.inUse += n
+	b.mu.Unlock()
+}
+
+// release returns n bytes to the budget.
+func (b *memoryBudget) release(n int64) {
+	b.mu.Lock()
+	b.inUse -= n
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
@@ -0,0 +1,56 @@
+package lumberjack
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCompressMemoryBudgetSerializes(t *testing.T) {
+	b := newMemoryBudget()
+	b.setLimit(compressMemoryEstimate)
+
+	var active, peak int32
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.acquire(compressMemoryEstimate)
+			defer b.release(compressMemoryEstimate)
+			n := atomic.AddInt32(&active, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			<-time.After(10 * time.Millisecond)
+			atomic.AddInt32(&active, -1)
+		}()
+	}
+	wg.Wait()
+
+	// with room for only one compressor, they must have run one at a time.
+	equals(int32(1), peak, t)
+	equals(int64(0), b.inUse, t)
+}
+
+func TestCompressMemoryBudgetUndersized(t *testing.T) {
+	b := newMemoryBudget()
+	b.setLimit(1)
+
+	// a budget smaller than one compression still lets one through.
+	done := make(chan struct{})
+	go func() {
+		b.acquire(compressMemoryEstimate)
+		b.release(compressMemoryEstimate)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("acquire blocked on an idle budget")
+	}
+}
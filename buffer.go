@@ -0,0 +1,87 @@
+package lumberjack
+
+import (
+	"bufio"
+	"fmt"
+	"time"
+)
+
+// fileWriter writes to whichever file the Logger has open, so that one
+// bufio.Writer serves every file in turn.  The buffer is flushed before the
+// file is closed, so it never holds bytes for an earlier file.
+type fileWriter struct {
+	l *Logger
+}
+
+func (w fileWriter) Write(p []byte) (int, error) {
+	return w.l.writeAll(w.l.file, p)
+}
+
+// writeOut writes p to the open file, through the write buffer if BufferSize
+// is set.  A buffer that fails to write out is emptied, losing the bytes it
+// held, rather than failing every later write.  It assumes l.mu is held.
+func (l *Logger) writeOut(p []byte) (int, error) {
+	if l.BufferSize <= 0 {
+		return l.writeAll(l.file, p)
+	}
+	if l.buf == nil {
+		l.buf = bufio.NewWriterSize(fileWriter{l}, l.BufferSize)
+	}
+	n, err := l.buf.Write(p)
+	if err != nil {
+		l.buf.Reset(fileWriter{l})
+		return n, err
+	}
+	if l.FlushInterval > 0 && l.flushTimer == nil && l.buf.Buffered() > 0 {
+		l.startFlushTimer()
+	}
+	return n, nil
+}
+
+// buffered returns the number of bytes written but still in the write
+// buffer.  It assumes l.mu is held.
+func (l *Logger) buffered() int64 {
+	if l.buf == nil {
+		return 0
+	}
+	return int64(l.buf.Buffered())
+}
+
+// flushBuffer writes out the write buffer.  The bytes of a failed flush are
+// lost.  It assumes l.mu is held.
+func (l *Logger) flushBuffer() error {
+	if l.flushTimer != nil {
+		l.flushTimer.Stop()
+		l.flushTimer = nil
+	}
+	if l.buffered() == 0 {
+		return nil
+	}
+	if err := l.buf.Flush(); err != nil {
+		lost := l.buf.Buffered()
+		l.buf.Reset(fileWriter{l})
+		return fmt.Errorf("can't flush log file buffer, discarded %d bytes: %w", lost, err)
+	}
+	return nil
+}
+
+// startFlushTimer flushes the write buffer FlushInterval from now.  It
+// assumes l.mu is held.
+func (l *Logger) startFlushTimer() {
+	var t *time.Timer
+	t = time.AfterFunc(l.FlushInterval, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		// a flush since the timer was set has stopped it, but it may have
+		// fired already.
+		if l.flushTimer != t {
+			return
+		}
+		l.flushTimer = nil
+		if err := l.flushBuffer(); err != nil {
+			l.handleError(err)
+		}
+	})
+	l.flushTimer = t
+}
@@ -0,0 +1,59 @@
+package lumberjack
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestBufferSize(t *testing.T) {
+	currentTime = fakeTime
+	megabyte = 1
+	dir := makeTempDir("TestBufferSize", t)
+	defer os.RemoveAll(dir)
+
+	l := &Logger{
+		fullPathFileName: logFile(dir),
+		LogMaxSize:       10,
+		BufferSize:       100,
+	}
+	defer l.Close()
+	_, err := l.Write([]byte("boo!"))
+	isNil(err, t)
+	_, err = l.Write([]byte("hello "))
+	isNil(err, t)
+	// the writes are held, but count towards the size.
+	existsWithContent(logFile(dir), []byte{}, t)
+	equals(int64(10), l.CurrentSize(), t)
+	isNil(l.HealthCheck(), t)
+
+	// rotation writes them out first.
+	newFakeTime()
+	_, err = l.Write([]byte("x"))
+	isNil(err, t)
+	existsWithContent(backupFile(dir), []byte("boo!hello "), t)
+	existsWithContent(logFile(dir), []byte{}, t)
+
+	err = l.Close()
+	isNil(err, t)
+	existsWithContent(logFile(dir), []byte("x"), t)
+}
+
+func TestFlushInterval(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestFlushInterval", t)
+	defer os.RemoveAll(dir)
+
+	l := &Logger{
+		fullPathFileName: logFile(dir),
+		BufferSize:       100,
+		FlushInterval:    10 * time.Millisecond,
+	}
+	defer l.Close()
+	_, err := l.Write([]byte("boo!"))
+	isNil(err, t)
+	existsWithContent(logFile(dir), []byte{}, t)
+
+	<-time.After(100 * time.Millisecond)
+	existsWithContent(logFile(dir), []byte("boo!"), t)
+}
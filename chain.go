@@ -0,0 +1,379 @@
+package lumberjack
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrHashChainMismatch is wrapped by the errors VerifyHashChain returns when
+// a log file doesn't match its hash chain.
+var ErrHashChainMismatch = errors.New("log file doesn't match its hash chain")
+
+// chainRotatedPrefix starts the hash chain records that close a file's
+// hashes, naming the backup the file became.
+const chainRotatedPrefix = "- "
+
+// chainStartPrefix starts the hash chain records that take the place of the
+// hashes of backups retention has removed, giving the last of them, which
+// the hashes after it are chained from.
+const chainStartPrefix = "= "
+
+// chainFileName returns the name of the HashChain file for the log file
+// filename.
+func chainFileName(filename string) string {
+	return filepath.Join(filepath.Dir(filename), "."+filepath.Base(filename)+".chain")
+}
+
+// chainFile returns the name of the HashChain file.
+func (l *Logger) chainFile() string {
+	return chainFileName(l.filename())
+}
+
+// openChain opens the HashChain file, if it isn't open yet, and picks up the
+// chain from its last hash.  It assumes l.chainMu is held.
+func (l *Logger) openChain() error {
+	if l.chain != nil {
+		return nil
+	}
+	f, err := os.OpenFile(l.chainFile(), os.O_CREATE|os.O_RDWR|os.O_APPEND, l.fileMode())
+	if err != nil {
+		return err
+	}
+	var prev []byte
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if line := s.Text(); !strings.HasPrefix(line, chainRotatedPrefix) {
+			prev = []byte(strings.TrimPrefix(line, chainStartPrefix))
+		}
+	}
+	if err := s.Err(); err != nil {
+		f.Close()
+		return err
+	}
+	l.chain = f
+	l.chainPrev = make([]byte, sha256.Size)
+	if prev != nil {
+		if _, err := hex.Decode(l.chainPrev, prev); err != nil {
+			f.Close()
+			l.chain = nil
+			return fmt.Errorf("last hash %q is malformed: %s", prev, err)
+		}
+	}
+	return nil
+}
+
+// hashLines adds b, just written to the log file, to the HashChain, and
+// records the hash of every line it completes.  Failures go to
+// ErrorHandler.
+func (l *Logger) hashLines(b []byte) {
+	if !l.HashChain || len(b) == 0 {
+		return
+	}
+	l.chainMu.Lock()
+	defer l.chainMu.Unlock()
+
+	if err := l.openChain(); err != nil {
+		l.handleError(fmt.Errorf("can't open hash chain: %w", err))
+		return
+	}
+	var out []byte
+	for len(b) > 0 {
+		if l.chainLine == nil {
+			l.chainLine = sha256.New()
+			l.chainLine.Write(l.chainPrev)
+		}
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			l.chainLine.Write(b)
+			break
+		}
+		l.chainLine.Write(b[:i+1])
+		out = l.endLine(out)
+		b = b[i+1:]
+	}
+	l.writeChain(out)
+}
+
+// endLine completes the hash of the current line and appends it, in hex, to
+// out.  It assumes l.chainMu is held.
+func (l *Logger) endLine(out []byte) []byte {
+	l.chainPrev = l.chainLine.Sum(l.chainPrev[:0])
+	l.chainLine = nil
+	out = append(out, hex.EncodeToString(l.chainPrev)...)
+	return append(out, '\n')
+}
+
+// writeChain appends records to the HashChain file.  It assumes l.chainMu is
+// held.
+func (l *Logger) writeChain(records []byte) {
+	if len(records) == 0 {
+		return
+	}
+	if _, err := l.chain.Write(records); err != nil {
+		l.handleError(fmt.Errorf("can't write hash chain: %w", err))
+	}
+}
+
+// chainRotated records that the log file has become the backup newname,
+// ending its hashes with that of any unfinished last line.
+func (l *Logger) chainRotated(newname string) {
+	if !l.HashChain {
+		return
+	}
+	l.chainMu.Lock()
+	defer l.chainMu.Unlock()
+
+	if err := l.openChain(); err != nil {
+		l.handleError(fmt.Errorf("can't open hash chain: %w", err))
+		return
+	}
+	var out []byte
+	if l.chainLine != nil {
+		out = l.endLine(out)
+	}
+	out = append(out, chainRotatedPrefix+filepath.Base(newname)+"\n"...)
+	l.writeChain(out)
+}
+
+// closeChain ends the hashes with that of any unfinished last line and
+// closes the HashChain file.
+func (l *Logger) closeChain() {
+	l.chainMu.Lock()
+	defer l.chainMu.Unlock()
+
+	if l.chain == nil {
+		return
+	}
+	if l.chainLine != nil {
+		l.writeChain(l.endLine(nil))
+	}
+	if err := l.chain.Close(); err != nil {
+		l.handleError(fmt.Errorf("can't close hash chain: %w", err))
+	}
+	l.chain = nil
+}
+
+// chainRemoved drops the backups retention has just removed from the
+// HashChain, so that the backups it names are all there.
+func (l *Logger) chainRemoved() {
+	if !l.HashChain {
+		return
+	}
+	l.chainMu.Lock()
+	defer l.chainMu.Unlock()
+
+	l.trimChain()
+}
+
+// trimChain drops from the HashChain file the hashes of backups that no
+// longer exist, leaving in their place a record of the last of them, so the
+// chain picks up from it.  The file is rewritten, and reopened by the next
+// write, only if anything is dropped.  Failures go to ErrorHandler.  It
+// assumes l.chainMu is held.
+func (l *Logger) trimChain() {
+	b, err := ioutil.ReadFile(l.chainFile())
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		l.handleError(fmt.Errorf("can't read hash chain: %w", err))
+		return
+	}
+	var out, hashes []string
+	start := ""
+	dropped := false
+	for _, line := range strings.Split(strings.TrimSuffix(string(b), "\n"), "\n") {
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, chainStartPrefix):
+			start = line
+		case !strings.HasPrefix(line, chainRotatedPrefix):
+			hashes = append(hashes, line)
+		case l.backupExists(filepath.Join(l.dir(), strings.TrimPrefix(line, chainRotatedPrefix))):
+			if start != "" {
+				out = append(out, start)
+				start = ""
+			}
+			out = append(out, hashes...)
+			out = append(out, line)
+			hashes = nil
+		default:
+			dropped = true
+			if len(hashes) > 0 {
+				start = chainStartPrefix + hashes[len(hashes)-1]
+			}
+			hashes = nil
+		}
+	}
+	if !dropped {
+		return
+	}
+	if start != "" {
+		out = append(out, start)
+	}
+	out = append(out, hashes...)
+	if l.chain != nil {
+		if err := l.chain.Close(); err != nil {
+			l.handleError(fmt.Errorf("can't close hash chain: %w", err))
+		}
+		l.chain = nil
+	}
+	var data []byte
+	for _, line := range out {
+		data = append(data, line+"\n"...)
+	}
+	if err := writeFileAtomic(l.chainFile(), data, l.fileMode(), l.tempSuffix()); err != nil {
+		l.handleError(fmt.Errorf("can't trim hash chain: %w", err))
+	}
+}
+
+// backupExists reports whether the backup name, or its compressed copy,
+// exists.
+func (l *Logger) backupExists(name string) bool {
+	if _, err := os.Lstat(name); err == nil {
+		return true
+	}
+	_, err := os.Lstat(l.compressedName(name))
+	return err == nil
+}
+
+// compressedName returns the name that compressing the backup name gives it.
+func (l *Logger) compressedName(name string) string {
+	_, ext := l.prefixAndExt()
+	return strings.TrimSuffix(name, ext) + l.compressedExt(ext, l.compressor())
+}
+
+// VerifyHashChain checks the log file filename and its backups against the
+// hash chain a Logger with HashChain keeps beside them, as
+// Logger.VerifyHashChain does for a Logger with the default naming and
+// Compressor.
+func VerifyHashChain(filename string) error {
+	return (&Logger{fullPathFileName: filename}).VerifyHashChain()
+}
+
+// VerifyHashChain checks the log file and its backups against the hash chain
+// kept with HashChain, returning an error wrapping ErrHashChainMismatch at
+// the first line that doesn't match, at a line added or removed, or at a
+// backup it names that is missing; retention drops the backups it removes
+// from the chain, which picks up from their last hash.  Compressed backups
+// are found by the name compressing gives them, with CompressFileSuffix or
+// the Compressor's suffix, and read back through the Compressor, which must
+// be a Decompressor; one that can't be read is reported.  A last line still
+// being written to the log file, without its newline or hash, is ignored.
+func (l *Logger) VerifyHashChain() error {
+	filename := l.filename()
+	b, err := ioutil.ReadFile(chainFileName(filename))
+	if err != nil {
+		return fmt.Errorf("can't read hash chain: %s", err)
+	}
+	dir := filepath.Dir(filename)
+	prev := make([]byte, sha256.Size)
+	var hashes []string
+	for _, line := range strings.SplitAfter(string(b), "\n") {
+		if line == "" {
+			continue
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if strings.HasPrefix(line, chainStartPrefix) {
+			if len(hashes) > 0 {
+				return fmt.Errorf("%w: %d hashes before %q don't belong to any file", ErrHashChainMismatch, len(hashes), line)
+			}
+			if _, err := hex.Decode(prev, []byte(strings.TrimPrefix(line, chainStartPrefix))); err != nil {
+				return fmt.Errorf("hash %q in chain is malformed: %s", line, err)
+			}
+			continue
+		}
+		if !strings.HasPrefix(line, chainRotatedPrefix) {
+			hashes = append(hashes, line)
+			continue
+		}
+		name := filepath.Join(dir, strings.TrimPrefix(line, chainRotatedPrefix))
+		if err := l.verifyFile(name, prev, hashes, false); err != nil {
+			return err
+		}
+		if len(hashes) > 0 {
+			if _, err := hex.Decode(prev, []byte(hashes[len(hashes)-1])); err != nil {
+				return fmt.Errorf("hash %q in chain is malformed: %s", hashes[len(hashes)-1], err)
+			}
+		}
+		hashes = nil
+	}
+	return l.verifyFile(filename, prev, hashes, true)
+}
+
+// verifyFile checks the lines of the log file or backup name, chained from
+// prev, against hashes.
+func (l *Logger) verifyFile(name string, prev []byte, hashes []string, active bool) error {
+	data, err := l.readLogFile(name)
+	if os.IsNotExist(err) && active && len(hashes) == 0 {
+		// not written to since the last rotation.
+		return nil
+	}
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s is missing", ErrHashChainMismatch, name)
+	}
+	if err != nil {
+		return fmt.Errorf("can't read %s: %s", name, err)
+	}
+	h := sha256.New()
+	sum := append([]byte(nil), prev...)
+	n := 0
+	for len(data) > 0 {
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line = data[:i+1]
+		} else if active && n == len(hashes) {
+			// still being written.
+			break
+		}
+		data = data[len(line):]
+		if n == len(hashes) {
+			return fmt.Errorf("%w: %s has lines from %d on that aren't in the chain", ErrHashChainMismatch, name, n+1)
+		}
+		h.Reset()
+		h.Write(sum)
+		h.Write(line)
+		sum = h.Sum(sum[:0])
+		if hex.EncodeToString(sum) != hashes[n] {
+			return fmt.Errorf("%w: %s line %d", ErrHashChainMismatch, name, n+1)
+		}
+		n++
+	}
+	if n < len(hashes) {
+		return fmt.Errorf("%w: %s is missing lines from %d on", ErrHashChainMismatch, name, n+1)
+	}
+	return nil
+}
+
+// readLogFile reads the log file or backup name, or its compressed copy if
+// it has been compressed.
+func (l *Logger) readLogFile(name string) ([]byte, error) {
+	b, err := ioutil.ReadFile(name)
+	if !os.IsNotExist(err) {
+		return b, err
+	}
+	cname := l.compressedName(name)
+	f, errC := os.Open(cname)
+	if errC != nil {
+		return nil, err
+	}
+	defer f.Close()
+	d, ok := l.compressor().(Decompressor)
+	if !ok {
+		return nil, fmt.Errorf("%s was compressed by a Compressor that isn't a Decompressor", cname)
+	}
+	r, errC := d.Decompress(f)
+	if errC != nil {
+		return nil, fmt.Errorf("can't decompress %s: %w", cname, errC)
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
@@ -0,0 +1,177 @@
+package lumberjack
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHashChain(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestHashChain", t)
+	defer os.RemoveAll(dir)
+
+	newLogger := func() *Logger {
+		return &Logger{fullPathFileName: logFile(dir), HashChain: true}
+	}
+	write := func(l *Logger, s string) {
+		_, err := l.Write([]byte(s))
+		isNilUp(err, t, 1)
+	}
+	l := newLogger()
+	defer l.Close()
+	// a line may take more than one write.
+	write(l, "one\n")
+	write(l, "two\nthr")
+	write(l, "ee\n")
+	newFakeTime()
+	backup := backupFile(dir)
+	err := l.Rotate()
+	isNil(err, t)
+	write(l, "four\n")
+	// a line still being written isn't checked yet.
+	write(l, "fi")
+	isNil(VerifyHashChain(logFile(dir)), t)
+	write(l, "ve\n")
+	err = l.Close()
+	isNil(err, t)
+
+	// the chain carries on after a restart.
+	l = newLogger()
+	defer l.Close()
+	write(l, "six\n")
+	isNil(VerifyHashChain(logFile(dir)), t)
+
+	chain, err := ioutil.ReadFile(filepath.Join(dir, ".foobar.log.chain"))
+	isNil(err, t)
+	lines := bytes.Split(bytes.TrimSuffix(chain, []byte("\n")), []byte("\n"))
+	equals(7, len(lines), t)
+	equals("- "+filepath.Base(backup), string(lines[3]), t)
+
+	// compressed backups are read through gzip.
+	data, err := ioutil.ReadFile(backup)
+	isNil(err, t)
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err = gz.Write(data)
+	isNil(err, t)
+	isNil(gz.Close(), t)
+	err = ioutil.WriteFile(backup+compressSuffix, buf.Bytes(), 0644)
+	isNil(err, t)
+	isNil(os.Remove(backup), t)
+	isNil(VerifyHashChain(logFile(dir)), t)
+
+	// any change to a backup breaks the chain.
+	isNil(os.Remove(backup+compressSuffix), t)
+	err = ioutil.WriteFile(backup, bytes.Replace(data, []byte("two"), []byte("TWO"), 1), 0644)
+	isNil(err, t)
+	err = VerifyHashChain(logFile(dir))
+	assert(errors.Is(err, ErrHashChainMismatch), t, "expected ErrHashChainMismatch, got %v", err)
+
+	// and so does a line removed from the log file.
+	err = ioutil.WriteFile(backup, data, 0644)
+	isNil(err, t)
+	isNil(VerifyHashChain(logFile(dir)), t)
+	err = ioutil.WriteFile(logFile(dir), []byte("four\nsix\n"), 0644)
+	isNil(err, t)
+	err = VerifyHashChain(logFile(dir))
+	assert(errors.Is(err, ErrHashChainMismatch), t, "expected ErrHashChainMismatch, got %v", err)
+}
+
+func TestHashChainTrimmed(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestHashChainTrimmed", t)
+	defer os.RemoveAll(dir)
+
+	l := &Logger{fullPathFileName: logFile(dir), HashChain: true, LogMaxSaveQuantity: 1}
+	defer l.Close()
+	var backups []string
+	for _, s := range []string{"one\n", "two\n", "three\n"} {
+		_, err := l.Write([]byte(s))
+		isNil(err, t)
+		newFakeTime()
+		backups = append(backups, backupFile(dir))
+		err = l.Rotate()
+		isNil(err, t)
+		l.waitMill()
+	}
+	_, err := l.Write([]byte("four\n"))
+	isNil(err, t)
+	// the removals trim the chain as they are done.
+	err = l.CloseContext(context.Background())
+	isNil(err, t)
+	notExist(backups[1], t)
+	exists(backups[2], t)
+
+	// the records of the removed backups are gone, and the chain starts
+	// from the last hash of the newest of them.
+	chain, err := ioutil.ReadFile(filepath.Join(dir, ".foobar.log.chain"))
+	isNil(err, t)
+	lines := strings.Split(strings.TrimSuffix(string(chain), "\n"), "\n")
+	equals(4, len(lines), t)
+	assert(strings.HasPrefix(lines[0], chainStartPrefix), t, "expected a start record, got %q", lines[0])
+	equals("- "+filepath.Base(backups[2]), lines[2], t)
+	isNil(VerifyHashChain(logFile(dir)), t)
+
+	// and carries on from there after a restart.
+	l = &Logger{fullPathFileName: logFile(dir), HashChain: true}
+	defer closeWait(l, t)
+	_, err = l.Write([]byte("five\n"))
+	isNil(err, t)
+	isNil(VerifyHashChain(logFile(dir)), t)
+	err = ioutil.WriteFile(backups[2], []byte("THREE\n"), 0644)
+	isNil(err, t)
+	err = VerifyHashChain(logFile(dir))
+	assert(errors.Is(err, ErrHashChainMismatch), t, "expected ErrHashChainMismatch, got %v", err)
+
+	// a backup deleted other than by retention is still in the chain, and
+	// reported missing.
+	isNil(os.Remove(backups[2]), t)
+	err = VerifyHashChain(logFile(dir))
+	assert(errors.Is(err, ErrHashChainMismatch), t, "expected ErrHashChainMismatch, got %v", err)
+}
+
+func TestHashChainCompressedBackups(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestHashChainCompressedBackups", t)
+	defer os.RemoveAll(dir)
+
+	compressed := make(chan string, 1)
+	l := &Logger{
+		fullPathFileName:   logFile(dir),
+		HashChain:          true,
+		Compress:           true,
+		CompressFileSuffix: ".gzip",
+		OnCompress: func(path string, _, _ int64) {
+			compressed <- path
+		},
+	}
+	defer closeWait(l, t)
+	_, err := l.Write([]byte("one\n"))
+	isNil(err, t)
+	newFakeTime()
+	err = l.Rotate()
+	isNil(err, t)
+	equals(backupFile(dir)+".gzip", <-compressed, t)
+	waitNotExist(backupFile(dir), t)
+
+	// the backup is found by the configured suffix.
+	isNil(l.VerifyHashChain(), t)
+	err = ioutil.WriteFile(backupFile(dir)+".gzip", []byte("not gzip"), 0644)
+	isNil(err, t)
+	err = l.VerifyHashChain()
+	notNil(err, t)
+
+	// a backup the Compressor can't read back is reported, not skipped.
+	u := &Logger{fullPathFileName: logFile(dir), Compressor: upperCompressor{}}
+	err = os.Rename(backupFile(dir)+".gzip", backupFile(dir)+".up")
+	isNil(err, t)
+	err = u.VerifyHashChain()
+	assert(err != nil && strings.Contains(err.Error(), "Decompressor"), t, "expected an unreadable backup, got %v", err)
+}
@@ -0,0 +1,16 @@
+package lumberjack
+
+import "time"
+
+// Clock tells Logger the time.
+type Clock interface {
+	Now() time.Time
+}
+
+// timeNow returns the time from Clock, or the system clock if it isn't set.
+func (l *Logger) timeNow() time.Time {
+	if l.Clock != nil {
+		return l.Clock.Now()
+	}
+	return currentTime()
+}
@@ -0,0 +1,48 @@
+package lumberjack
+
+import (
+	"context"
+	"fmt"
+)
+
+// CloseContext is like Close, but first waits for the cleanup running in the
+// background, or queued by the last rotation, to finish, so that the process
+// can exit without leaving a compressed backup half written.  If ctx is done
+// first, it stops waiting, closes the file anyway and returns an error
+// wrapping ctx's; the cleanup carries on for as long as the process does.
+// Writes after CloseContext reopen the file, as after Close, and may start
+// another cleanup.
+func (l *Logger) CloseContext(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.waitMill()
+	}()
+	var errWait error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		errWait = fmt.Errorf("cleanup of old log files still running: %w", ctx.Err())
+	}
+	if err := l.Close(); err != nil {
+		return err
+	}
+	return errWait
+}
+
+// waitMill waits until no cleanup pass queued by the last rotation, or by
+// the pass before it, is left queued or running, running a queued one itself
+// rather than waiting for the mill goroutine to pick it up.
+func (l *Logger) waitMill() {
+	l.startMill.Do(l.startMillRun)
+	select {
+	case <-l.millCh:
+		l.runQueuedMill()
+	default:
+	}
+	l.millIdleMu.Lock()
+	for l.millQueued > 0 {
+		l.millIdle.Wait()
+	}
+	l.millIdleMu.Unlock()
+}
@@ -0,0 +1,119 @@
+package lumberjack
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCloseContext(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestCloseContext", t)
+	defer os.RemoveAll(dir)
+
+	c := gatedCompressor{started: make(chan struct{}, 1), release: make(chan struct{})}
+	l := &Logger{
+		fullPathFileName: logFile(dir),
+		Compress:         true,
+		Compressor:       c,
+	}
+	defer l.Close()
+	_, err := l.Write([]byte("boo!"))
+	isNil(err, t)
+	newFakeTime()
+	backup := backupFile(dir)
+	err = l.Rotate()
+	isNil(err, t)
+	<-c.started
+
+	// a deadline that passes first is reported, and the file is closed.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = l.CloseContext(ctx)
+	assert(errors.Is(err, context.DeadlineExceeded), t, "expected a deadline error, got %v", err)
+	equals(File(nil), l.file, t)
+	exists(backup, t)
+
+	// otherwise it waits for the compression to finish.
+	time.AfterFunc(20*time.Millisecond, func() { close(c.release) })
+	err = l.CloseContext(context.Background())
+	isNil(err, t)
+	existsWithContent(backup+".up", []byte("BOO!"), t)
+	notExist(backup, t)
+}
+
+func TestCloseContextBeforeMillLocks(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestCloseContextBeforeMillLocks", t)
+	defer os.RemoveAll(dir)
+
+	l := &Logger{
+		fullPathFileName: logFile(dir),
+		Compress:         true,
+		Compressor:       upperCompressor{},
+	}
+	defer l.Close()
+	_, err := l.Write([]byte("boo!"))
+	isNil(err, t)
+	newFakeTime()
+	backup := backupFile(dir)
+
+	// holding millMu, the mill goroutine takes the rotation's pass from
+	// millCh but can't start it.
+	l.millMu.Lock()
+	err = l.Rotate()
+	isNil(err, t)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(l.millCh) > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	equals(0, len(l.millCh), t)
+
+	done := make(chan error, 1)
+	go func() { done <- l.CloseContext(context.Background()) }()
+	select {
+	case err := <-done:
+		t.Fatalf("CloseContext returned before the cleanup ran: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	l.millMu.Unlock()
+	err = <-done
+	isNil(err, t)
+	existsWithContent(backup+".up", []byte("BOO!"), t)
+	notExist(backup, t)
+}
+
+func TestCloseContextFollowUpPass(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestCloseContextFollowUpPass", t)
+	defer os.RemoveAll(dir)
+
+	var backups []string
+	for i := 1; i <= 3; i++ {
+		name := filepath.Join(dir, "foobar-"+fakeTime().UTC().Add(-time.Duration(i)*time.Hour).Format(backupTimeFormat)+".log")
+		err := ioutil.WriteFile(name, []byte("boo!"), 0644)
+		isNil(err, t)
+		backups = append(backups, name)
+	}
+
+	// with a batch of one, each pass queues another for what it left.
+	l := &Logger{
+		fullPathFileName: logFile(dir),
+		Compress:         true,
+		Compressor:       upperCompressor{},
+		MillBatchSize:    1,
+	}
+	defer l.Close()
+	_, err := l.Write([]byte("foo"))
+	isNil(err, t)
+	err = l.CloseContext(context.Background())
+	isNil(err, t)
+	for _, name := range backups {
+		existsWithContent(name+".up", []byte("BOO!"), t)
+		notExist(name, t)
+	}
+}
@@ -0,0 +1,183 @@
+package lumberjack
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Compressor compresses rotated log files.
+type Compressor interface {
+	// Suffix returns the extension appended to compressed backups, such as
+	// ".gz".
+	Suffix() string
+
+	// Compress writes the compressed contents of src to dst.
+	Compress(dst io.Writer, src io.Reader) error
+}
+
+// Decompressor is implemented by Compressors that can read back the backups
+// they compress, as VerifyHashChain needs to.  The default Compressor is one.
+type Decompressor interface {
+	// Decompress returns a reader of the contents of src, as compressed by
+	// Compress.
+	Decompress(src io.Reader) (io.ReadCloser, error)
+}
+
+// dictSuffix is the extension of backups compressed with a dictionary.
+const dictSuffix = ".zz"
+
+// gzipCompressor is the default Compressor.  A zero level means
+// gzip.DefaultCompression.
+type gzipCompressor struct {
+	level int
+	dict  []byte
+}
+
+// GzipOption configures a Compressor made by NewGzipCompressor.
+type GzipOption func(*gzipCompressor)
+
+// WithDictionary presets the compressor with dict, text that the logs are
+// likely to repeat, such as common JSON keys or line prefixes.  This can
+// greatly improve the ratio for small, highly structured files.  The gzip
+// format has no room for a dictionary, so backups are written in the zlib
+// format instead, which records which dictionary was used, and get the
+// suffix ".zz".  They can only be read with the same dictionary, using
+// NewDictReader; keep the dictionary for as long as the backups.
+func WithDictionary(dict []byte) GzipOption {
+	return func(c *gzipCompressor) {
+		c.dict = dict
+	}
+}
+
+// NewGzipCompressor returns the default Compressor with the given
+// compression level, where zero means gzip.DefaultCompression.
+func NewGzipCompressor(level int, opts ...GzipOption) Compressor {
+	c := gzipCompressor{level: level}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+func (c gzipCompressor) Suffix() string {
+	if len(c.dict) > 0 {
+		return dictSuffix
+	}
+	return compressSuffix
+}
+
+func (c gzipCompressor) Compress(dst io.Writer, src io.Reader) error {
+	level := c.level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	var w io.WriteCloser
+	var err error
+	if len(c.dict) > 0 {
+		w, err = zlib.NewWriterLevelDict(dst, level, c.dict)
+	} else {
+		w, err = gzip.NewWriterLevel(dst, level)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func (c gzipCompressor) Decompress(src io.Reader) (io.ReadCloser, error) {
+	if len(c.dict) > 0 {
+		return zlib.NewReaderDict(src, c.dict)
+	}
+	return gzip.NewReader(src)
+}
+
+// NewDictReader returns a reader of the contents of a backup compressed
+// with WithDictionary(dict).  It fails if the backup was compressed with a
+// different dictionary.
+func NewDictReader(r io.Reader, dict []byte) (io.ReadCloser, error) {
+	return zlib.NewReaderDict(r, dict)
+}
+
+// compressor returns the configured Compressor, or gzip if none is set.
+func (l *Logger) compressor() Compressor {
+	if l.Compressor != nil {
+		return l.Compressor
+	}
+	return gzipCompressor{level: l.CompressLevel}
+}
+
+// startupCompressor returns the Compressor used for backups compressed by
+// Init.
+func (l *Logger) startupCompressor() Compressor {
+	if l.Compressor != nil || l.StartupCompressLevel == 0 {
+		return l.compressor()
+	}
+	return gzipCompressor{level: l.StartupCompressLevel}
+}
+
+// validCompressLevel checks that level, configured by the named field, is a
+// level gzip accepts.
+func validCompressLevel(field string, level int) error {
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		return fmt.Errorf("invalid %s %d: must be between %d and %d",
+			field, level, gzip.HuffmanOnly, gzip.BestCompression)
+	}
+	return nil
+}
+
+// compressedExt returns the extension of backups compressed with c, given
+// ext, that of uncompressed ones.
+func (l *Logger) compressedExt(ext string, c Compressor) string {
+	if l.CompressReplaceExtension {
+		return l.suffixOf(c)
+	}
+	return ext + l.suffixOf(c)
+}
+
+// suffixOf returns the suffix of backups compressed with c: the
+// CompressFileSuffix, if set, or else c's own.
+func (l *Logger) suffixOf(c Compressor) string {
+	if l.CompressFileSuffix != "" {
+		return l.CompressFileSuffix
+	}
+	return c.Suffix()
+}
+
+// tempSuffix returns the extension of temporary files.
+func (l *Logger) tempSuffix() string {
+	if l.TempFileSuffix != "" {
+		return l.TempFileSuffix
+	}
+	return ".tmp"
+}
+
+// backupStem returns the backup name without its extension, compressed or
+// not, so that a backup and its compressed copy share a stem.
+func (l *Logger) backupStem(name string) string {
+	_, ext := l.prefixAndExt()
+	if cext := l.compressedExt(ext, l.compressor()); strings.HasSuffix(name, cext) {
+		return strings.TrimSuffix(name, cext)
+	}
+	return strings.TrimSuffix(name, ext)
+}
+
+// CompressSuffix returns the extension that Logger adds to the backups it
+// compresses, such as ".gz", or the empty string if Compress is off.
+func (l *Logger) CompressSuffix() string {
+	if !l.Compress {
+		return ""
+	}
+	return l.suffixOf(l.compressor())
+}
+
+// IsCompressed reports whether name is a compressed backup, i.e. whether it
+// ends with the configured Compressor's suffix or the CompressFileSuffix.
+func (l *Logger) IsCompressed(name string) bool {
+	return strings.HasSuffix(name, l.suffixOf(l.compressor()))
+}
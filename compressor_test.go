@@ -0,0 +1,491 @@
+package lumberjack
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// upperCompressor "compresses" by upper-casing its input, which makes the
+// output easy to check.
+type upperCompressor struct{}
+
+func (upperCompressor) Suffix() string {
+	return ".up"
+}
+
+func (upperCompressor) Compress(dst io.Writer, src io.Reader) error {
+	b, err := ioutil.ReadAll(src)
+	if err != nil {
+		return err
+	}
+	_, err = dst.Write(bytes.ToUpper(b))
+	return err
+}
+
+func TestCompressSuffix(t *testing.T) {
+	l := &Logger{}
+	equals("", l.CompressSuffix(), t)
+
+	l.Compress = true
+	equals(".gz", l.CompressSuffix(), t)
+	equals(true, l.IsCompressed("foo-2014-05-04T14-44-33.log.gz"), t)
+	equals(false, l.IsCompressed("foo-2014-05-04T14-44-33.log"), t)
+
+	l.Compressor = upperCompressor{}
+	equals(".up", l.CompressSuffix(), t)
+	equals(true, l.IsCompressed("foo-2014-05-04T14-44-33.log.up"), t)
+	equals(false, l.IsCompressed("foo-2014-05-04T14-44-33.log.gz"), t)
+}
+
+func TestFileSuffixes(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestFileSuffixes", t)
+	defer os.RemoveAll(dir)
+
+	l := &Logger{
+		fullPathFileName:   logFile(dir),
+		Compress:           true,
+		CompressFileSuffix: ".gzip",
+		TempFileSuffix:     ".part",
+		CurrentMarker:      true,
+	}
+	defer closeWait(l, t)
+	isNil(l.Validate(), t)
+	equals(".gzip", l.CompressSuffix(), t)
+	_, err := l.Write([]byte("boo!"))
+	isNil(err, t)
+	newFakeTime()
+	err = l.Rotate()
+	isNil(err, t)
+
+	// wait for the files to be compressed on the mill goroutine.
+	l.waitMill()
+	compressed := backupFile(dir) + ".gzip"
+	notExist(backupFile(dir), t)
+	notExist(backupFile(dir)+compressSuffix, t)
+	r, err := os.Open(compressed)
+	isNil(err, t)
+	defer r.Close()
+	gz, err := gzip.NewReader(r)
+	isNil(err, t)
+	b, err := ioutil.ReadAll(gz)
+	isNil(err, t)
+	equals("boo!", string(b), t)
+
+	backups, err := l.Backups()
+	isNil(err, t)
+	equals(1, len(backups), t)
+	equals(true, backups[0].Compressed, t)
+
+	// a temporary file left by a crash is recognized by its suffix.
+	stray := filepath.Join(dir, ".foobar.current123.part")
+	err = ioutil.WriteFile(stray, nil, 0644)
+	isNil(err, t)
+	report, err := l.Reconcile()
+	isNil(err, t)
+	equals(&ReconcileReport{
+		Active:   logFile(dir),
+		Backups:  []string{compressed},
+		Sidecars: []string{filepath.Join(dir, "foobar.current")},
+		Temp:     []string{stray},
+	}, report, t)
+}
+
+func TestInvalidFileSuffixes(t *testing.T) {
+	for _, l := range []*Logger{
+		{CompressFileSuffix: "gz"},
+		{CompressFileSuffix: ".gz/x"},
+		{TempFileSuffix: ".log"},
+		{LogFileSuffix: ".txt", BackupFileSuffix: ".bak", CompressFileSuffix: ".bak"},
+		{TempFileSuffix: ".gz"},
+		{CompressFileSuffix: ".z", TempFileSuffix: ".z"},
+	} {
+		l.LogFileName = "foobar"
+		if l.LogFileSuffix == "" {
+			l.LogFileSuffix = ".log"
+		}
+		notNil(l.Validate(), t)
+	}
+}
+
+func TestCustomCompressor(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestCustomCompressor", t)
+	defer os.RemoveAll(dir)
+
+	filename := logFile(dir)
+	l := &Logger{
+		fullPathFileName: filename,
+		Compress:         true,
+		Compressor:       upperCompressor{},
+	}
+	defer closeWait(l, t)
+	b := []byte("boo!")
+	_, err := l.Write(b)
+	isNil(err, t)
+
+	newFakeTime()
+	err = l.Rotate()
+	isNil(err, t)
+
+	// wait for the files to be compressed on the mill goroutine.
+	l.waitMill()
+
+	existsWithContent(backupFile(dir)+l.CompressSuffix(), []byte("BOO!"), t)
+	notExist(backupFile(dir), t)
+
+	files, err := l.oldLogFiles()
+	isNil(err, t)
+	equals(1, len(files), t)
+}
+
+// gzipLevelFlag returns the XFL header byte of the gzip file at path, which
+// records whether it was written with gzip.BestCompression (2) or
+// gzip.BestSpeed (4).
+func gzipLevelFlag(path string, t testing.TB) byte {
+	b, err := ioutil.ReadFile(path)
+	isNilUp(err, t, 1)
+	assertUp(len(b) > 8, t, 1, "gzip file %s is too short", path)
+	return b[8]
+}
+
+func TestStartupCompressLevel(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestStartupCompressLevel", t)
+	defer os.RemoveAll(dir)
+
+	// a log file left over from three days ago.
+	lastWrite := fakeTime().UTC().Add(-72 * time.Hour).Truncate(time.Second)
+	data := []byte(lastWrite.Format("2006-01-02 15:04:05") + " bye\n")
+	err := ioutil.WriteFile(logFile(dir), data, 0644)
+	isNil(err, t)
+
+	l := &Logger{
+		LogPathName:          dir + string(filepath.Separator),
+		LogFileName:          "foobar",
+		LogFileSuffix:        ".log",
+		LogFileTimeFormat:    "2006-01-02 15:04:05",
+		Compress:             true,
+		CompressLevel:        gzip.BestCompression,
+		StartupCompressLevel: gzip.BestSpeed,
+	}
+	defer closeWait(l, t)
+	err = l.Init()
+	isNil(err, t)
+
+	startup := filepath.Join(dir, "foobar-"+lastWrite.Format(backupTimeFormat)+".log"+compressSuffix)
+	equals(byte(4), gzipLevelFlag(startup, t), t)
+
+	_, err = l.Write([]byte("boo!"))
+	isNil(err, t)
+	newFakeTime()
+	err = l.Rotate()
+	isNil(err, t)
+
+	// wait for the files to be compressed on the mill goroutine.
+	l.waitMill()
+
+	equals(byte(2), gzipLevelFlag(backupFile(dir)+compressSuffix, t), t)
+}
+
+// gatedCompressor is an upperCompressor that reports each backup it starts
+// on and waits to be released before compressing it.
+type gatedCompressor struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (gatedCompressor) Suffix() string {
+	return ".up"
+}
+
+func (c gatedCompressor) Compress(dst io.Writer, src io.Reader) error {
+	c.started <- struct{}{}
+	<-c.release
+	return upperCompressor{}.Compress(dst, src)
+}
+
+func TestStartupCompressAsync(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestStartupCompressAsync", t)
+	defer os.RemoveAll(dir)
+
+	lastWrite := fakeTime().UTC().Add(-72 * time.Hour).Truncate(time.Second)
+	data := []byte(lastWrite.Format("2006-01-02 15:04:05") + " bye\n")
+	err := ioutil.WriteFile(logFile(dir), data, 0644)
+	isNil(err, t)
+
+	c := gatedCompressor{started: make(chan struct{}, 1), release: make(chan struct{})}
+	l := &Logger{
+		LogPathName:          dir + string(filepath.Separator),
+		LogFileName:          "foobar",
+		LogFileSuffix:        ".log",
+		LogFileTimeFormat:    "2006-01-02 15:04:05",
+		Compress:             true,
+		Compressor:           c,
+		StartupCompressAsync: true,
+	}
+	defer closeWait(l, t)
+	// Init would block on the compressor if it compressed the file itself.
+	err = l.Init()
+	isNil(err, t)
+	backup := filepath.Join(dir, "foobar-"+lastWrite.Format(backupTimeFormat)+".log")
+	existsWithContent(backup, data, t)
+	notExist(logFile(dir), t)
+
+	select {
+	case <-c.started:
+	case <-time.After(time.Second):
+		t.Fatal("backup compression didn't start")
+	}
+	close(c.release)
+	waitNotExist(backup, t)
+	existsWithContent(backup+".up", bytes.ToUpper(data), t)
+}
+
+func TestInvalidCompressLevel(t *testing.T) {
+	dir := makeTempDir("TestInvalidCompressLevel", t)
+	defer os.RemoveAll(dir)
+
+	for _, l := range []*Logger{
+		{LogPathName: dir + string(filepath.Separator), LogFileName: "foobar", CompressLevel: 10},
+		{LogPathName: dir + string(filepath.Separator), LogFileName: "foobar", StartupCompressLevel: -3},
+	} {
+		notNil(l.Init(), t)
+	}
+}
+
+func TestCompressMinSize(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestCompressMinSize", t)
+	defer os.RemoveAll(dir)
+
+	small := backupFile(dir)
+	err := ioutil.WriteFile(small, []byte("tiny"), 0644)
+	isNil(err, t)
+	newFakeTime()
+	large := backupFile(dir)
+	err = ioutil.WriteFile(large, bytes.Repeat([]byte("large "), 20), 0644)
+	isNil(err, t)
+
+	l := &Logger{
+		fullPathFileName: logFile(dir),
+		Compress:         true,
+		CompressMinSize:  50,
+	}
+	err = l.millRunOnce()
+	isNil(err, t)
+
+	existsWithContent(small, []byte("tiny"), t)
+	notExist(small+compressSuffix, t)
+	exists(large+compressSuffix, t)
+	notExist(large, t)
+}
+
+func TestCompressAfterDays(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestCompressAfterDays", t)
+	defer os.RemoveAll(dir)
+
+	old := backupFile(dir)
+	err := ioutil.WriteFile(old, []byte("old"), 0644)
+	isNil(err, t)
+	newFakeTime()
+	recent := backupFile(dir)
+	err = ioutil.WriteFile(recent, []byte("recent"), 0644)
+	isNil(err, t)
+
+	l := &Logger{
+		fullPathFileName:  logFile(dir),
+		Compress:          true,
+		CompressAfterDays: 1,
+	}
+	// the backup rotated two days ago is compressed, today's is left.
+	err = l.millRunOnce()
+	isNil(err, t)
+	exists(old+compressSuffix, t)
+	notExist(old, t)
+	existsWithContent(recent, []byte("recent"), t)
+	notExist(recent+compressSuffix, t)
+
+	// and compressed by a pass once it is old enough.
+	newFakeTime()
+	err = l.millRunOnce()
+	isNil(err, t)
+	exists(recent+compressSuffix, t)
+	notExist(recent, t)
+}
+
+// failingCompressor fails every compression.
+type failingCompressor struct{}
+
+func (failingCompressor) Suffix() string {
+	return ".up"
+}
+
+func (failingCompressor) Compress(dst io.Writer, src io.Reader) error {
+	return fmt.Errorf("no room")
+}
+
+func TestCompressConcurrency(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestCompressConcurrency", t)
+	defer os.RemoveAll(dir)
+
+	var backups []string
+	for i := 0; i < 4; i++ {
+		backups = append(backups, backupFile(dir))
+		err := ioutil.WriteFile(backupFile(dir), []byte("boo!"), 0644)
+		isNil(err, t)
+		newFakeTime()
+	}
+
+	c := gatedCompressor{started: make(chan struct{}, len(backups)), release: make(chan struct{})}
+	l := &Logger{
+		fullPathFileName:    logFile(dir),
+		Compress:            true,
+		Compressor:          c,
+		CompressConcurrency: 2,
+	}
+	done := make(chan error, 1)
+	go func() { done <- l.millRunOnce() }()
+
+	// two compressions run at once, and no more.
+	for i := 0; i < 2; i++ {
+		select {
+		case <-c.started:
+		case <-time.After(time.Second):
+			t.Fatalf("only %d compressions running", i)
+		}
+	}
+	select {
+	case <-c.started:
+		t.Fatal("more than 2 compressions running")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(c.release)
+	isNil(<-done, t)
+	for _, b := range backups {
+		existsWithContent(b+".up", []byte("BOO!"), t)
+		notExist(b, t)
+	}
+
+	// the errors of all that failed come back together.
+	for _, b := range backups {
+		err := ioutil.WriteFile(b, []byte("boo!"), 0644)
+		isNil(err, t)
+		err = os.Remove(b + ".up")
+		isNil(err, t)
+	}
+	l.Compressor = failingCompressor{}
+	err := l.millRunOnce()
+	notNil(err, t)
+	assert(strings.Contains(err.Error(), "can't compress 4 backups") && strings.Count(err.Error(), "no room") == 4, t,
+		"expected the errors of all 4 compressions, got %q", err)
+}
+
+func TestGzipDictionary(t *testing.T) {
+	var sample bytes.Buffer
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(&sample, `{"time":"2021-01-02T15:04:%02dZ","level":"info","msg":"request %d served","service":"checkout"}`+"\n", i, i)
+	}
+	dict := []byte(`{"time":"2021-01-02T15:04:00Z","level":"info","msg":"request served","service":"checkout"}` + "\n")
+
+	compress := func(c Compressor) []byte {
+		var out bytes.Buffer
+		err := c.Compress(&out, bytes.NewReader(sample.Bytes()))
+		isNil(err, t)
+		return out.Bytes()
+	}
+	plain := compress(NewGzipCompressor(0))
+	withDict := compress(NewGzipCompressor(0, WithDictionary(dict)))
+	assert(len(withDict) < len(plain), t,
+		"expected the dictionary to help: %d bytes with, %d without", len(withDict), len(plain))
+
+	r, err := NewDictReader(bytes.NewReader(withDict), dict)
+	isNil(err, t)
+	got, err := ioutil.ReadAll(r)
+	isNil(err, t)
+	equals(sample.String(), string(got), t)
+
+	// another dictionary doesn't read it.
+	_, err = NewDictReader(bytes.NewReader(withDict), []byte("something else"))
+	notNil(err, t)
+
+	equals(".gz", NewGzipCompressor(0).Suffix(), t)
+	equals(".zz", NewGzipCompressor(0, WithDictionary(dict)).Suffix(), t)
+}
+
+func TestCompressReplaceExtension(t *testing.T) {
+	for _, replace := range []bool{false, true} {
+		currentTime = fakeTime
+		dir := makeTempDir("TestCompressReplaceExtension", t)
+
+		// compressed returns the compressed name of the backup made now.
+		compressed := func() string {
+			if replace {
+				return strings.TrimSuffix(backupFile(dir), ".log") + compressSuffix
+			}
+			return backupFile(dir) + compressSuffix
+		}
+		other := func() string {
+			if replace {
+				return backupFile(dir) + compressSuffix
+			}
+			return strings.TrimSuffix(backupFile(dir), ".log") + compressSuffix
+		}
+
+		var backups, compressedBackups []string
+		for i := 0; i < 3; i++ {
+			newFakeTime()
+			err := ioutil.WriteFile(backupFile(dir), []byte("old"), 0644)
+			isNil(err, t)
+			backups = append(backups, backupFile(dir))
+			compressedBackups = append(compressedBackups, compressed())
+		}
+		l := &Logger{
+			fullPathFileName:         logFile(dir),
+			Compress:                 true,
+			CompressReplaceExtension: replace,
+			LogMaxSaveQuantity:       2,
+		}
+		err := l.millRunOnce()
+		isNil(err, t)
+
+		notExist(backups[0], t)
+		notExist(compressedBackups[0], t)
+		for i := 1; i < 3; i++ {
+			notExist(backups[i], t)
+			exists(compressedBackups[i], t)
+		}
+		notExist(other(), t)
+		files, err := l.oldLogFiles()
+		isNil(err, t)
+		equals(2, len(files), t)
+
+		// a backup beside its compressed copy counts once.
+		err = ioutil.WriteFile(backups[2], []byte("old"), 0644)
+		isNil(err, t)
+		newFakeTime()
+		err = ioutil.WriteFile(backupFile(dir), []byte("new"), 0644)
+		isNil(err, t)
+		l.Compress = false
+		err = l.millRunOnce()
+		isNil(err, t)
+
+		notExist(compressedBackups[1], t)
+		exists(backups[2], t)
+		exists(compressedBackups[2], t)
+		exists(backupFile(dir), t)
+
+		os.RemoveAll(dir)
+	}
+}
@@ -0,0 +1,557 @@
+package lumberjack
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ValidationError lists every problem Validate found in a Logger's
+// configuration.
+type ValidationError struct {
+	Errors []error
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return "invalid logger configuration: " + strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the individual problems.
+func (e *ValidationError) Unwrap() []error {
+	return e.Errors
+}
+
+// Validate checks the Logger's configuration and returns a *ValidationError
+// listing every problem it finds, or nil if there are none.  It can be called
+// before Init, and doesn't create or modify anything.
+func (l *Logger) Validate() error {
+	var errs []error
+	check := func(err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	nonNegative := func(field string, v int64) {
+		if v < 0 {
+			check(fmt.Errorf("%s must not be negative, got %d", field, v))
+		}
+	}
+
+	nonNegative("LogMaxSize", int64(l.LogMaxSize))
+	nonNegative("LogMaxSaveDay", int64(l.LogMaxSaveDay))
+	nonNegative("LogMaxSaveQuantity", int64(l.LogMaxSaveQuantity))
+	nonNegative("LogMaxTotalSize", int64(l.LogMaxTotalSize))
+	nonNegative("LogSplitDay", int64(l.LogSplitDay))
+	nonNegative("LogSplitHour", int64(l.LogSplitHour))
+	nonNegative("SyncEveryNLines", int64(l.SyncEveryNLines))
+	nonNegative("BufferSize", int64(l.BufferSize))
+	nonNegative("FlushInterval", int64(l.FlushInterval))
+	nonNegative("LockTimeout", int64(l.LockTimeout))
+	nonNegative("HealthCheckSizeSlack", l.HealthCheckSizeSlack)
+	nonNegative("CompressMinSize", l.CompressMinSize)
+	nonNegative("CompressAfterDays", int64(l.CompressAfterDays))
+	nonNegative("CompressConcurrency", int64(l.CompressConcurrency))
+	nonNegative("MinFreeDiskMB", int64(l.MinFreeDiskMB))
+	nonNegative("FallbackBufferBytes", int64(l.FallbackBufferBytes))
+	nonNegative("ThinningPolicy.AfterDays", int64(l.ThinningPolicy.AfterDays))
+	nonNegative("WriteShards", int64(l.WriteShards))
+	nonNegative("MillBatchSize", int64(l.MillBatchSize))
+	nonNegative("RetentionGracePeriod", int64(l.RetentionGracePeriod))
+	nonNegative("NetworkRetry.Retries", int64(l.NetworkRetry.Retries))
+	nonNegative("NetworkRetry.Backoff", int64(l.NetworkRetry.Backoff))
+	nonNegative("NetworkRetry.MaxBackoff", int64(l.NetworkRetry.MaxBackoff))
+	if l.MaxSizePercentFree < 0 || l.MaxSizePercentFree > 100 {
+		check(fmt.Errorf("MaxSizePercentFree must be between 0 and 100, got %v", l.MaxSizePercentFree))
+	}
+	if l.RetentionTimeSource != EmbeddedTimestamp && l.RetentionTimeSource != ModTime {
+		check(fmt.Errorf("invalid RetentionTimeSource %d", l.RetentionTimeSource))
+	}
+	if l.RetentionOrder != RemoveThenCompress && l.RetentionOrder != CompressThenRemove {
+		check(fmt.Errorf("invalid RetentionOrder %d", l.RetentionOrder))
+	}
+	if l.GenerationNaming && l.DailyBackupNaming {
+		check(errors.New("GenerationNaming and DailyBackupNaming can't both be set"))
+	}
+	check(validTimezone(l.Timezone))
+	check(validDayRollover(l.DayRolloverAt))
+	check(validEncoding(l.LogFileEncoding))
+	check(validCompressLevel("CompressLevel", l.CompressLevel))
+	check(validCompressLevel("StartupCompressLevel", l.StartupCompressLevel))
+	if l.FileMode&^os.ModePerm != 0 {
+		check(fmt.Errorf("FileMode %v must only contain permission bits", l.FileMode))
+	}
+	if l.DirMode&^os.ModePerm != 0 {
+		check(fmt.Errorf("DirMode %v must only contain permission bits", l.DirMode))
+	}
+	if l.BackupTimeFormat != "" {
+		check(validTimeLayout("BackupTimeFormat", l.BackupTimeFormat))
+		if strings.ContainsRune(l.BackupTimeFormat, '/') || strings.ContainsRune(l.BackupTimeFormat, filepath.Separator) {
+			check(fmt.Errorf("BackupTimeFormat %q must not contain a path separator", l.BackupTimeFormat))
+		}
+	}
+	if strings.ContainsRune(l.BackupTimeSeparator, '/') || strings.ContainsRune(l.BackupTimeSeparator, filepath.Separator) {
+		check(fmt.Errorf("BackupTimeSeparator %q must not contain a path separator", l.BackupTimeSeparator))
+	}
+	backupExt := filepath.Ext(l.configuredFilename())
+	if l.BackupFileSuffix != "" {
+		backupExt = l.BackupFileSuffix
+	}
+	if l.CompressFileSuffix != "" {
+		check(validFileSuffix("CompressFileSuffix", l.CompressFileSuffix, backupExt))
+	}
+	if l.TempFileSuffix != "" {
+		check(validFileSuffix("TempFileSuffix", l.TempFileSuffix, backupExt))
+	}
+	if l.tempSuffix() == l.suffixOf(l.compressor()) {
+		check(fmt.Errorf("temporary and compressed files must have different suffixes, both are %q", l.tempSuffix()))
+	}
+	if l.SymlinkPath != "" && filepath.Clean(l.SymlinkPath) == filepath.Clean(l.configuredFilename()) {
+		check(fmt.Errorf("SymlinkPath %q must not be the log file", l.SymlinkPath))
+	}
+	if l.LogFileTimeFormat != "" {
+		err := validTimeLayout("LogFileTimeFormat", l.LogFileTimeFormat)
+		check(err)
+		if err == nil && l.LastWriteTimeExtractor == nil {
+			check(l.validTimePrecision())
+		}
+	}
+	if w, ok := l.MetricsSink.(*Logger); ok && w == l {
+		check(errors.New("MetricsSink must not be the Logger itself"))
+	}
+	if l.FileSystem == nil {
+		check(validLogDir(filepath.Dir(l.configuredFilename())))
+	}
+	errs = append(errs, l.validFileSystem()...)
+
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// NewLogger returns a Logger with the settings in cfg, initialized and ready
+// to write.  Unlike a Logger set up by hand, it requires LogPathName and
+// LogFileName, adds the separator LogPathName may lack and the dot
+// LogFileSuffix may lack, and checks the rest with Validate before calling
+// Init.  A configuration problem is returned as a *ValidationError listing
+// every one found.
+func NewLogger(cfg Config) (*Logger, error) {
+	var errs []error
+	if cfg.LogPathName == "" {
+		errs = append(errs, errors.New("LogPathName must be set"))
+	} else if !os.IsPathSeparator(cfg.LogPathName[len(cfg.LogPathName)-1]) {
+		cfg.LogPathName += string(filepath.Separator)
+	}
+	if cfg.LogFileName == "" {
+		errs = append(errs, errors.New("LogFileName must be set"))
+	}
+	if cfg.LogFileSuffix != "" && !strings.HasPrefix(cfg.LogFileSuffix, ".") {
+		cfg.LogFileSuffix = "." + cfg.LogFileSuffix
+	}
+	l := &Logger{}
+	cfg.applyTo(l)
+	if err := l.Validate(); err != nil {
+		errs = append(errs, err.(*ValidationError).Errors...)
+	}
+	if len(errs) > 0 {
+		return nil, &ValidationError{Errors: errs}
+	}
+	if err := l.Init(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// configuredFilename returns the name Init would give the log file.
+func (l *Logger) configuredFilename() string {
+	if l.LogFileName != "" {
+		return l.LogPathName + l.LogFileName + l.LogFileSuffix
+	}
+	return l.filename()
+}
+
+// validFileSuffix checks that suffix, configured by the named field, is a
+// file extension other than backupExt, that of uncompressed backups.
+func validFileSuffix(field, suffix, backupExt string) error {
+	if len(suffix) < 2 || suffix[0] != '.' {
+		return fmt.Errorf("%s %q must be a dot followed by an extension", field, suffix)
+	}
+	if strings.ContainsRune(suffix, '/') || strings.ContainsRune(suffix, filepath.Separator) {
+		return fmt.Errorf("%s %q must not contain a path separator", field, suffix)
+	}
+	if suffix == backupExt {
+		return fmt.Errorf("%s %q must differ from the backup extension", field, suffix)
+	}
+	return nil
+}
+
+// validTimeLayout checks that layout is a time layout that can parse what it
+// formats.
+func validTimeLayout(field, layout string) error {
+	// not the reference time, or every layout would format as itself.
+	ref := time.Date(2021, 11, 22, 13, 14, 15, 0, time.UTC)
+	s := ref.Format(layout)
+	if s == layout {
+		return fmt.Errorf("%s %q contains no time elements", field, layout)
+	}
+	if _, err := time.Parse(layout, s); err != nil {
+		return fmt.Errorf("%s %q is not a usable time layout: %s", field, layout, err)
+	}
+	return nil
+}
+
+// validTimePrecision checks that times read with LogFileTimeFormat keep
+// enough precision to name backups, which Init does after the time of the
+// last line in the log file.  A layout without seconds, say, makes Init name
+// the backup after the start of the minute.
+func (l *Logger) validTimePrecision() error {
+	loc := l.location()
+	ref := time.Date(2021, 11, 22, 13, 14, 15, 0, loc)
+	parsed, err := time.ParseInLocation(l.LogFileTimeFormat, ref.Format(l.LogFileTimeFormat), loc)
+	if err != nil {
+		return fmt.Errorf("LogFileTimeFormat %q can't read back what it writes: %s", l.LogFileTimeFormat, err)
+	}
+	want := ref.Format(l.backupTimeFormat())
+	if got := time.Unix(parsed.Unix(), 0).In(loc).Format(l.backupTimeFormat()); got != want {
+		return fmt.Errorf("LogFileTimeFormat %q is too coarse for backup names: %s would be named %s",
+			l.LogFileTimeFormat, want, got)
+	}
+	return nil
+}
+
+// validLogDir checks that the log directory, or the nearest ancestor that
+// exists if it doesn't yet, can be written to.
+func validLogDir(dir string) error {
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("log directory %s is not a directory", dir)
+			}
+			if err := dirWritable(dir); err != nil {
+				return fmt.Errorf("log directory %s is not writable: %s", dir, err)
+			}
+			return nil
+		}
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("can't check log directory: %s", err)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil
+		}
+		dir = parent
+	}
+}
+
+// Config holds the settings of a Logger that Reconfigure can change.  The
+// fields have the same meaning as the Logger fields of the same name.
+type Config struct {
+	LogMaxSize               int                 `json:"LogMaxSize" yaml:"LogMaxSize"`
+	MaxSizePercentFree       float64             `json:"MaxSizePercentFree" yaml:"MaxSizePercentFree"`
+	LogMaxSaveDay            int                 `json:"LogMaxSaveDay" yaml:"LogMaxSaveDay"`
+	RetentionTimeSource      RetentionTimeSource `json:"RetentionTimeSource" yaml:"RetentionTimeSource"`
+	RetentionGracePeriod     time.Duration       `json:"RetentionGracePeriod" yaml:"RetentionGracePeriod"`
+	LogMaxSaveQuantity       int                 `json:"LogMaxSaveQuantity" yaml:"LogMaxSaveQuantity"`
+	LogMaxTotalSize          int                 `json:"LogMaxTotalSize" yaml:"LogMaxTotalSize"`
+	RetentionOrder           RetentionOrder      `json:"RetentionOrder" yaml:"RetentionOrder"`
+	LocalTime                bool                `json:"LocalTime" yaml:"LocalTime"`
+	Timezone                 string              `json:"Timezone" yaml:"Timezone"`
+	Compress                 bool                `json:"Compress" yaml:"Compress"`
+	CompressReplaceExtension bool                `json:"CompressReplaceExtension" yaml:"CompressReplaceExtension"`
+	CompressMinSize          int64               `json:"CompressMinSize" yaml:"CompressMinSize"`
+	CompressAfterDays        int                 `json:"CompressAfterDays" yaml:"CompressAfterDays"`
+	CompressConcurrency      int                 `json:"CompressConcurrency" yaml:"CompressConcurrency"`
+	CompressLevel            int                 `json:"CompressLevel" yaml:"CompressLevel"`
+	StartupCompressLevel     int                 `json:"StartupCompressLevel" yaml:"StartupCompressLevel"`
+	StartupCompressAsync     bool                `json:"StartupCompressAsync" yaml:"StartupCompressAsync"`
+	LogSplitDay              int                 `json:"LogSplitDay" yaml:"LogSplitDay"`
+	LogSplitHour             int                 `json:"LogSplitHour" yaml:"LogSplitHour"`
+	RotateAtMidnight         bool                `json:"RotateAtMidnight" yaml:"RotateAtMidnight"`
+	DayRolloverAt            string              `json:"DayRolloverAt" yaml:"DayRolloverAt"`
+	LogPathName              string              `json:"LogPathName" yaml:"LogPathName"`
+	LogFileName              string              `json:"LogFileName" yaml:"LogFileName"`
+	LogFileSuffix            string              `json:"LogFileSuffix" yaml:"LogFileSuffix"`
+	BackupFileSuffix         string              `json:"BackupFileSuffix" yaml:"BackupFileSuffix"`
+	CompressFileSuffix       string              `json:"CompressFileSuffix" yaml:"CompressFileSuffix"`
+	TempFileSuffix           string              `json:"TempFileSuffix" yaml:"TempFileSuffix"`
+	BackupTimeFormat         string              `json:"BackupTimeFormat" yaml:"BackupTimeFormat"`
+	BackupTimeSeparator      string              `json:"BackupTimeSeparator" yaml:"BackupTimeSeparator"`
+	CurrentMarker            bool                `json:"CurrentMarker" yaml:"CurrentMarker"`
+	SymlinkPath              string              `json:"SymlinkPath" yaml:"SymlinkPath"`
+	LogFileTimeFormat        string              `json:"LogFileTimeFormat" yaml:"LogFileTimeFormat"`
+	UseModTimeFallback       bool                `json:"UseModTimeFallback" yaml:"UseModTimeFallback"`
+	LogFileEncoding          string              `json:"LogFileEncoding" yaml:"LogFileEncoding"`
+	FileMode                 os.FileMode         `json:"FileMode" yaml:"FileMode"`
+	EnforceFileMode          bool                `json:"EnforceFileMode" yaml:"EnforceFileMode"`
+	CountLinesOnRotate       bool                `json:"CountLinesOnRotate" yaml:"CountLinesOnRotate"`
+	DirMode                  os.FileMode         `json:"DirMode" yaml:"DirMode"`
+	PreserveOwner            *bool               `json:"PreserveOwner" yaml:"PreserveOwner"`
+	ArchiveHardlinkDir       string              `json:"ArchiveHardlinkDir" yaml:"ArchiveHardlinkDir"`
+	FailOpen                 bool                `json:"FailOpen" yaml:"FailOpen"`
+	NetworkRetry             NetworkRetryPolicy  `json:"NetworkRetry" yaml:"NetworkRetry"`
+	SyncEveryNLines          int                 `json:"SyncEveryNLines" yaml:"SyncEveryNLines"`
+	BufferSize               int                 `json:"BufferSize" yaml:"BufferSize"`
+	FlushInterval            time.Duration       `json:"FlushInterval" yaml:"FlushInterval"`
+	ExclusiveLock            bool                `json:"ExclusiveLock" yaml:"ExclusiveLock"`
+	LockTimeout              time.Duration       `json:"LockTimeout" yaml:"LockTimeout"`
+	HealthCheckSizeSlack     int64               `json:"HealthCheckSizeSlack" yaml:"HealthCheckSizeSlack"`
+	HashChain                bool                `json:"HashChain" yaml:"HashChain"`
+	MinFreeDiskMB            int                 `json:"MinFreeDiskMB" yaml:"MinFreeDiskMB"`
+	FallbackBufferBytes      int                 `json:"FallbackBufferBytes" yaml:"FallbackBufferBytes"`
+	FirstFilePreamble        []byte              `json:"FirstFilePreamble" yaml:"FirstFilePreamble"`
+	Footer                   []byte              `json:"Footer" yaml:"Footer"`
+	MillBatchSize            int                 `json:"MillBatchSize" yaml:"MillBatchSize"`
+	LazyMill                 bool                `json:"LazyMill" yaml:"LazyMill"`
+	GenerationNaming         bool                `json:"GenerationNaming" yaml:"GenerationNaming"`
+	DailyBackupNaming        bool                `json:"DailyBackupNaming" yaml:"DailyBackupNaming"`
+	PersistCounters          bool                `json:"PersistCounters" yaml:"PersistCounters"`
+	ThinningPolicy           ThinningPolicy      `json:"ThinningPolicy" yaml:"ThinningPolicy"`
+}
+
+// Config returns the Logger's current settings, for use as a starting point
+// for Reconfigure.
+func (l *Logger) Config() Config {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return Config{
+		LogMaxSize:               l.LogMaxSize,
+		MaxSizePercentFree:       l.MaxSizePercentFree,
+		LogMaxSaveDay:            l.LogMaxSaveDay,
+		RetentionTimeSource:      l.RetentionTimeSource,
+		RetentionGracePeriod:     l.RetentionGracePeriod,
+		LogMaxSaveQuantity:       l.LogMaxSaveQuantity,
+		LogMaxTotalSize:          l.LogMaxTotalSize,
+		RetentionOrder:           l.RetentionOrder,
+		LocalTime:                l.LocalTime,
+		Timezone:                 l.Timezone,
+		Compress:                 l.Compress,
+		CompressReplaceExtension: l.CompressReplaceExtension,
+		CompressMinSize:          l.CompressMinSize,
+		CompressAfterDays:        l.CompressAfterDays,
+		CompressConcurrency:      l.CompressConcurrency,
+		CompressLevel:            l.CompressLevel,
+		StartupCompressLevel:     l.StartupCompressLevel,
+		StartupCompressAsync:     l.StartupCompressAsync,
+		LogSplitDay:              l.LogSplitDay,
+		LogSplitHour:             l.LogSplitHour,
+		RotateAtMidnight:         l.RotateAtMidnight,
+		DayRolloverAt:            l.DayRolloverAt,
+		LogPathName:              l.LogPathName,
+		LogFileName:              l.LogFileName,
+		LogFileSuffix:            l.LogFileSuffix,
+		BackupFileSuffix:         l.BackupFileSuffix,
+		CompressFileSuffix:       l.CompressFileSuffix,
+		TempFileSuffix:           l.TempFileSuffix,
+		BackupTimeFormat:         l.BackupTimeFormat,
+		BackupTimeSeparator:      l.BackupTimeSeparator,
+		CurrentMarker:            l.CurrentMarker,
+		SymlinkPath:              l.SymlinkPath,
+		LogFileTimeFormat:        l.LogFileTimeFormat,
+		UseModTimeFallback:       l.UseModTimeFallback,
+		LogFileEncoding:          l.LogFileEncoding,
+		FileMode:                 l.FileMode,
+		EnforceFileMode:          l.EnforceFileMode,
+		CountLinesOnRotate:       l.CountLinesOnRotate,
+		DirMode:                  l.DirMode,
+		PreserveOwner:            l.PreserveOwner,
+		ArchiveHardlinkDir:       l.ArchiveHardlinkDir,
+		FailOpen:                 l.FailOpen,
+		NetworkRetry:             l.NetworkRetry,
+		SyncEveryNLines:          l.SyncEveryNLines,
+		BufferSize:               l.BufferSize,
+		FlushInterval:            l.FlushInterval,
+		ExclusiveLock:            l.ExclusiveLock,
+		LockTimeout:              l.LockTimeout,
+		HealthCheckSizeSlack:     l.HealthCheckSizeSlack,
+		HashChain:                l.HashChain,
+		MinFreeDiskMB:            l.MinFreeDiskMB,
+		FallbackBufferBytes:      l.FallbackBufferBytes,
+		FirstFilePreamble:        l.FirstFilePreamble,
+		Footer:                   l.Footer,
+		MillBatchSize:            l.MillBatchSize,
+		LazyMill:                 l.LazyMill,
+		GenerationNaming:         l.GenerationNaming,
+		DailyBackupNaming:        l.DailyBackupNaming,
+		PersistCounters:          l.PersistCounters,
+		ThinningPolicy:           l.ThinningPolicy,
+	}
+}
+
+// Clone returns a new Logger with l's settings, including those Config
+// doesn't hold, such as Compressor and ErrorHandler, but none of its state:
+// it has no file open and must be initialized with Init.  Change at least
+// the log file's name before initializing it, since two Loggers can't share
+// one.
+func (l *Logger) Clone() *Logger {
+	c := &Logger{}
+	l.Config().applyTo(c)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c.Clock = l.Clock
+	c.Compressor = l.Compressor
+	c.LastWriteTimeExtractor = l.LastWriteTimeExtractor
+	c.MetricsSink = l.MetricsSink
+	c.AuditLog = l.AuditLog
+	c.ErrorHandler = l.ErrorHandler
+	c.OnOpenFailure = l.OnOpenFailure
+	c.OnRotate = l.OnRotate
+	c.OnCompress = l.OnCompress
+	c.WriteShards = l.WriteShards
+	c.UnlockedAppend = l.UnlockedAppend
+	c.AllowSharedPath = l.AllowSharedPath
+	c.BeforeRotate = l.BeforeRotate
+	return c
+}
+
+// applyTo copies the settings onto l.
+func (c Config) applyTo(l *Logger) {
+	l.LogMaxSize = c.LogMaxSize
+	l.MaxSizePercentFree = c.MaxSizePercentFree
+	l.LogMaxSaveDay = c.LogMaxSaveDay
+	l.RetentionTimeSource = c.RetentionTimeSource
+	l.RetentionGracePeriod = c.RetentionGracePeriod
+	l.LogMaxSaveQuantity = c.LogMaxSaveQuantity
+	l.LogMaxTotalSize = c.LogMaxTotalSize
+	l.RetentionOrder = c.RetentionOrder
+	l.LocalTime = c.LocalTime
+	l.Timezone = c.Timezone
+	l.Compress = c.Compress
+	l.CompressReplaceExtension = c.CompressReplaceExtension
+	l.CompressMinSize = c.CompressMinSize
+	l.CompressAfterDays = c.CompressAfterDays
+	l.CompressConcurrency = c.CompressConcurrency
+	l.CompressLevel = c.CompressLevel
+	l.StartupCompressLevel = c.StartupCompressLevel
+	l.StartupCompressAsync = c.StartupCompressAsync
+	l.LogSplitDay = c.LogSplitDay
+	l.LogSplitHour = c.LogSplitHour
+	l.RotateAtMidnight = c.RotateAtMidnight
+	l.DayRolloverAt = c.DayRolloverAt
+	l.LogPathName = c.LogPathName
+	l.LogFileName = c.LogFileName
+	l.LogFileSuffix = c.LogFileSuffix
+	l.BackupFileSuffix = c.BackupFileSuffix
+	l.CompressFileSuffix = c.CompressFileSuffix
+	l.TempFileSuffix = c.TempFileSuffix
+	l.BackupTimeFormat = c.BackupTimeFormat
+	l.BackupTimeSeparator = c.BackupTimeSeparator
+	l.CurrentMarker = c.CurrentMarker
+	l.SymlinkPath = c.SymlinkPath
+	l.LogFileTimeFormat = c.LogFileTimeFormat
+	l.UseModTimeFallback = c.UseModTimeFallback
+	l.LogFileEncoding = c.LogFileEncoding
+	l.FileMode = c.FileMode
+	l.EnforceFileMode = c.EnforceFileMode
+	l.CountLinesOnRotate = c.CountLinesOnRotate
+	l.DirMode = c.DirMode
+	l.PreserveOwner = c.PreserveOwner
+	l.ArchiveHardlinkDir = c.ArchiveHardlinkDir
+	l.FailOpen = c.FailOpen
+	l.NetworkRetry = c.NetworkRetry
+	l.SyncEveryNLines = c.SyncEveryNLines
+	l.BufferSize = c.BufferSize
+	l.FlushInterval = c.FlushInterval
+	l.ExclusiveLock = c.ExclusiveLock
+	l.LockTimeout = c.LockTimeout
+	l.HealthCheckSizeSlack = c.HealthCheckSizeSlack
+	l.HashChain = c.HashChain
+	l.MinFreeDiskMB = c.MinFreeDiskMB
+	l.FallbackBufferBytes = c.FallbackBufferBytes
+	l.FirstFilePreamble = c.FirstFilePreamble
+	l.Footer = c.Footer
+	l.MillBatchSize = c.MillBatchSize
+	l.LazyMill = c.LazyMill
+	l.GenerationNaming = c.GenerationNaming
+	l.DailyBackupNaming = c.DailyBackupNaming
+	l.PersistCounters = c.PersistCounters
+	l.ThinningPolicy = c.ThinningPolicy
+}
+
+// Reconfigure switches the Logger to cfg without losing or misfiling any
+// write.  The new settings are validated first, and nothing changes if they
+// are invalid.  If the log file's name changes, the current file is closed
+// and finalized under the old settings: it is moved aside as a backup, and
+// old backups are compressed and removed, before writing resumes in the new
+// file.  Otherwise the open file is kept and the new settings apply from the
+// next write.  The settings are switched between cleanup passes, so a pass
+// running in the background finishes under the old ones.
+func (l *Logger) Reconfigure(cfg Config) error {
+	candidate := &Logger{}
+	cfg.applyTo(candidate)
+	if err := candidate.Validate(); err != nil {
+		return err
+	}
+	name := cfg.LogPathName + cfg.LogFileName + cfg.LogFileSuffix
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// what is buffered is written out before the buffer changes, and the
+	// next write makes one of the new size.
+	if cfg.BufferSize != l.BufferSize || cfg.FlushInterval != l.FlushInterval {
+		if err := l.flushBuffer(); err != nil {
+			return err
+		}
+		l.buf = nil
+	}
+	if name != l.fullPathFileName {
+		if l.registered != "" {
+			if err := l.register(candidate.configuredFilename()); err != nil {
+				return err
+			}
+		}
+		if err := l.finalize(); err != nil {
+			return err
+		}
+	}
+	// the mill reads the settings under millMu alone.
+	l.millMu.Lock()
+	cfg.applyTo(l)
+	l.fullPathFileName = name
+	l.millMu.Unlock()
+	if l.file == nil {
+		return l.prepareDir()
+	}
+	return nil
+}
+
+// finalize closes the current file and moves it aside as a backup, then
+// compresses and removes old backups, all under the current settings.
+func (l *Logger) finalize() error {
+	if err := l.writeFooter(); err != nil {
+		return err
+	}
+	if err := l.close(); err != nil {
+		return err
+	}
+	name := l.filename()
+	info, err := l.fs().Stat(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error getting log file info: %s", err)
+	}
+	newname, err := l.newBackupName(name)
+	if err != nil {
+		return err
+	}
+	if err := l.fs().Rename(name, newname); err != nil {
+		return fmt.Errorf("can't rename log file: %w", err)
+	}
+	l.emitRotate(newname, info.Size())
+	l.archive(newname)
+	l.chainRotated(newname)
+	l.notifyRotate(name, newname)
+	l.rotations++
+	return l.millRunOnce()
+}
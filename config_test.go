@@ -0,0 +1,198 @@
+package lumberjack
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	dir := makeTempDir("TestValidate", t)
+	defer os.RemoveAll(dir)
+
+	l := &Logger{
+		LogPathName:       dir + string(filepath.Separator),
+		LogFileName:       "foobar",
+		LogFileSuffix:     ".log",
+		LogFileTimeFormat: "2006-01-02 15:04:05",
+	}
+	isNil(l.Validate(), t)
+
+	// the directory doesn't need to exist yet.
+	l.LogPathName = filepath.Join(dir, "a", "b") + string(filepath.Separator)
+	isNil(l.Validate(), t)
+
+	notDir := filepath.Join(dir, "file")
+	err := ioutil.WriteFile(notDir, []byte("data"), 0644)
+	isNil(err, t)
+
+	bad := &Logger{
+		LogPathName:       notDir + string(filepath.Separator),
+		LogFileName:       "foobar",
+		LogMaxSize:        -1,
+		LogMaxSaveDay:     -2,
+		CompressLevel:     42,
+		LogFileTimeFormat: "timestamp",
+		FileMode:          os.ModeSymlink | 0644,
+	}
+	err = bad.Validate()
+	notNil(err, t)
+	verr, ok := err.(*ValidationError)
+	assert(ok, t, "expected a *ValidationError, got %T", err)
+	equals(6, len(verr.Errors), t)
+}
+
+func TestReconfigure(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestReconfigure", t)
+	defer os.RemoveAll(dir)
+
+	l := &Logger{
+		LogPathName:   dir + string(filepath.Separator),
+		LogFileName:   "foobar",
+		LogFileSuffix: ".log",
+	}
+	isNil(l.Init(), t)
+	defer l.Close()
+	b := []byte("boo!")
+	_, err := l.Write(b)
+	isNil(err, t)
+
+	newFakeTime()
+	cfg := l.Config()
+	cfg.LogFileName = "other"
+	cfg.Compress = true
+	err = l.Reconfigure(cfg)
+	isNil(err, t)
+
+	// the old file was finalized under the old settings, so not compressed.
+	notExist(logFile(dir), t)
+	existsWithContent(backupFile(dir), b, t)
+
+	b2 := []byte("foooooo!")
+	_, err = l.Write(b2)
+	isNil(err, t)
+	existsWithContent(filepath.Join(dir, "other.log"), b2, t)
+	fileCount(dir, 2, t)
+
+	// an invalid configuration changes nothing.
+	cfg.LogMaxSize = -1
+	cfg.LogFileName = "third"
+	notNil(l.Reconfigure(cfg), t)
+	b3 := []byte("baaaaaar!")
+	_, err = l.Write(b3)
+	isNil(err, t)
+	existsWithContent(filepath.Join(dir, "other.log"), append(b2, b3...), t)
+}
+
+func TestReconfigureBufferSize(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestReconfigureBufferSize", t)
+	defer os.RemoveAll(dir)
+
+	l := &Logger{
+		LogPathName:   dir + string(filepath.Separator),
+		LogFileName:   "foobar",
+		LogFileSuffix: ".log",
+		BufferSize:    4096,
+	}
+	isNil(l.Init(), t)
+	defer l.Close()
+	_, err := l.Write([]byte("first\n"))
+	isNil(err, t)
+	existsWithContent(logFile(dir), []byte{}, t)
+
+	// the buffered write goes out before the unbuffered one.
+	cfg := l.Config()
+	cfg.BufferSize = 0
+	isNil(l.Reconfigure(cfg), t)
+	_, err = l.Write([]byte("second\n"))
+	isNil(err, t)
+	existsWithContent(logFile(dir), []byte("first\nsecond\n"), t)
+}
+
+func TestReconfigureDuringCompression(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestReconfigureDuringCompression", t)
+	defer os.RemoveAll(dir)
+
+	c := gatedCompressor{started: make(chan struct{}, 1), release: make(chan struct{})}
+	l := &Logger{
+		LogPathName:   dir + string(filepath.Separator),
+		LogFileName:   "foobar",
+		LogFileSuffix: ".log",
+		Compress:      true,
+		Compressor:    c,
+	}
+	isNil(l.Init(), t)
+	b := []byte("boo!")
+	_, err := l.Write(b)
+	isNil(err, t)
+	isNil(l.Rotate(), t)
+	<-c.started
+
+	// the settings change while the backup is being compressed, which
+	// finishes under the old ones.
+	cfg := l.Config()
+	cfg.Compress = false
+	cfg.LogMaxSaveQuantity = 5
+	done := make(chan error)
+	go func() {
+		done <- l.Reconfigure(cfg)
+	}()
+	close(c.release)
+	isNil(<-done, t)
+	isNil(l.CloseContext(context.Background()), t)
+
+	existsWithContent(backupFile(dir)+".up", bytes.ToUpper(b), t)
+	notExist(backupFile(dir), t)
+	equals(false, l.Compress, t)
+}
+
+func TestValidateTimePrecision(t *testing.T) {
+	l := &Logger{LogFileTimeFormat: "2006-01-02 15:04:05"}
+	isNil(l.Validate(), t)
+
+	l.LogFileTimeFormat = "2006-01-02 15:04"
+	err := l.Validate()
+	notNil(err, t)
+	verr, ok := err.(*ValidationError)
+	assert(ok, t, "expected a *ValidationError, got %T", err)
+	equals(1, len(verr.Errors), t)
+
+	// a custom extractor doesn't use the layout this way.
+	l.LastWriteTimeExtractor = jsonTimeExtractor{}
+	isNil(l.Validate(), t)
+}
+
+func TestNewLogger(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestNewLogger", t)
+	defer os.RemoveAll(dir)
+
+	l, err := NewLogger(Config{
+		LogPathName:       dir,
+		LogFileName:       "foobar",
+		LogFileSuffix:     "log",
+		LogFileTimeFormat: "2006-01-02 15:04:05",
+	})
+	isNil(err, t)
+	defer l.Close()
+	equals(logFile(dir), l.filename(), t)
+	_, err = l.Write([]byte("boo!"))
+	isNil(err, t)
+	existsWithContent(logFile(dir), []byte("boo!"), t)
+
+	_, err = NewLogger(Config{
+		LogMaxSize:        -1,
+		LogSplitDay:       -1,
+		LogFileTimeFormat: "timestamp",
+	})
+	notNil(err, t)
+	verr, ok := err.(*ValidationError)
+	assert(ok, t, "expected a *ValidationError, got %T", err)
+	equals(5, len(verr.Errors), t)
+}
@@ -0,0 +1,69 @@
+package lumberjack
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dailyName returns the name for the next backup of name rotated at t with
+// DailyBackupNaming: prefix-<date>ext for the day's first, then
+// prefix-<date>.<n>ext with n one more than the highest counter on disk.
+func (l *Logger) dailyName(name string, t time.Time) (string, error) {
+	if l.isSplitDay {
+		t = time.Unix(l.yesterdayLastTimestamp, 0)
+	}
+	date := t.In(l.location()).Format(dateFormat)
+	files, err := l.fs().ReadDir(filepath.Dir(name))
+	if err != nil {
+		return "", fmt.Errorf("can't read log file directory: %w", err)
+	}
+	prefix, ext := l.prefixAndExt()
+	cext := l.compressedExt(ext, l.compressor())
+	next := 0
+	for _, f := range files {
+		for _, e := range []string{ext, cext} {
+			day, seq, err := l.dailyFromName(f.Name(), prefix, e)
+			if err == nil && day.Format(dateFormat) == date && seq >= next {
+				next = seq + 1
+			}
+		}
+	}
+	base := prefix + date
+	if next > 0 {
+		base += "." + strconv.Itoa(next)
+	}
+	return filepath.Join(filepath.Dir(name), base+ext), nil
+}
+
+// dailyFromName extracts the day and counter from a backup named with
+// DailyBackupNaming.
+func (l *Logger) dailyFromName(filename, prefix, ext string) (time.Time, int, error) {
+	if !strings.HasPrefix(filename, prefix) {
+		return time.Time{}, 0, errors.New("mismatched prefix")
+	}
+	if !strings.HasSuffix(filename, ext) || len(filename) < len(prefix)+len(ext) {
+		return time.Time{}, 0, errors.New("mismatched extension")
+	}
+	return l.parseDaily(filename[len(prefix) : len(filename)-len(ext)])
+}
+
+// parseDaily parses the <date> or <date>.<n> of a DailyBackupNaming name.
+func (l *Logger) parseDaily(s string) (time.Time, int, error) {
+	date, seq := s, 0
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		n, err := strconv.Atoi(s[i+1:])
+		if err != nil || n < 1 || strconv.Itoa(n) != s[i+1:] {
+			return time.Time{}, 0, errors.New("counter is not a number")
+		}
+		date, seq = s[:i], n
+	}
+	t, err := time.ParseInLocation(dateFormat, date, l.location())
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	return t, seq, nil
+}
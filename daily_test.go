@@ -0,0 +1,65 @@
+package lumberjack
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDailyBackupNaming(t *testing.T) {
+	currentTime = fakeTime
+	megabyte = 1
+	dir := makeTempDir("TestDailyBackupNaming", t)
+	defer os.RemoveAll(dir)
+
+	date := fakeTime().UTC().Format(dateFormat)
+	daily := func(suffix string) string {
+		return filepath.Join(dir, "foobar-"+date+suffix)
+	}
+
+	l := &Logger{
+		fullPathFileName:  logFile(dir),
+		LogMaxSize:        5,
+		DailyBackupNaming: true,
+	}
+	defer l.Close()
+	for _, s := range []string{"one\n", "two\n", "three"} {
+		_, err := l.Write([]byte(s))
+		isNil(err, t)
+	}
+	existsWithContent(daily(".log"), []byte("one\n"), t)
+	existsWithContent(daily(".1.log"), []byte("two\n"), t)
+	existsWithContent(logFile(dir), []byte("three"), t)
+
+	// a compressed backup still holds its number.
+	err := os.Rename(daily(".1.log"), daily(".1.log"+compressSuffix))
+	isNil(err, t)
+	_, err = l.Write([]byte("four\n"))
+	isNil(err, t)
+	existsWithContent(daily(".2.log"), []byte("three"), t)
+
+	files, err := l.oldLogFiles()
+	isNil(err, t)
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	equals([]string{
+		"foobar-" + date + ".2.log",
+		"foobar-" + date + ".1.log" + compressSuffix,
+		"foobar-" + date + ".log",
+	}, names, t)
+
+	// names that only look like the scheme aren't backups.
+	for _, name := range []string{"foobar-" + date + ".01.log", "foobar-" + date + ".x.log", "foobar-" + date + ".0.log"} {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte("other"), 0644)
+		isNil(err, t)
+	}
+	files, err = l.oldLogFiles()
+	isNil(err, t)
+	equals(3, len(files), t)
+
+	l.GenerationNaming = true
+	notNil(l.Validate(), t)
+}
@@ -0,0 +1,85 @@
+package lumberjack
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ErrLowDiskSpace is wrapped by the errors Write returns when MinFreeDiskMB
+// can't be kept free.
+var ErrLowDiskSpace = errors.New("not enough free disk space")
+
+// errFreeSpaceUnsupported is returned by diskFree where free space can't be
+// found.
+var errFreeSpaceUnsupported = errors.New("free space is only available on linux")
+
+// freeSpaceCheckInterval is how long ensureFreeSpace goes by the free space
+// it last found, less what has been written since, before checking again.
+const freeSpaceCheckInterval = time.Second
+
+// ensureFreeSpace makes sure that writing n bytes leaves MinFreeDiskMB free,
+// removing the oldest backups until it does.  It returns an error wrapping
+// ErrLowDiskSpace if removing every backup isn't enough.  The free space is
+// checked at most every freeSpaceCheckInterval, unless the writes since use
+// up what was left.  It assumes l.mu is held.
+func (l *Logger) ensureFreeSpace(n int64) error {
+	if l.MinFreeDiskMB <= 0 {
+		return nil
+	}
+	need := uint64(l.MinFreeDiskMB)*uint64(megabyte) + uint64(n)
+	now := l.timeNow()
+	if !l.freeSpaceAt.IsZero() && now.Sub(l.freeSpaceAt) < freeSpaceCheckInterval && l.freeSpace >= need {
+		l.freeSpace -= uint64(n)
+		return nil
+	}
+	l.freeSpaceAt = time.Time{}
+	free, err := diskFree(l.dir())
+	if err == errFreeSpaceUnsupported {
+		return nil
+	}
+	if err != nil {
+		l.handleError(fmt.Errorf("can't get free space for MinFreeDiskMB: %w", err))
+		return nil
+	}
+	if free < need {
+		// the mill mustn't compress or remove the backups meanwhile.
+		l.millMu.Lock()
+		free, err = l.removeForSpace(free, need)
+		l.millMu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	if free < need {
+		return fmt.Errorf("%w: %d bytes free in %s after removing every backup, but %d bytes must be left after writing %d",
+			ErrLowDiskSpace, free, l.dir(), uint64(l.MinFreeDiskMB)*uint64(megabyte), n)
+	}
+	l.freeSpace = free - uint64(n)
+	l.freeSpaceAt = now
+	return nil
+}
+
+// removeForSpace removes the oldest backups until need bytes are free, or
+// none are left, returning the bytes then free.  It assumes l.millMu is
+// held.
+func (l *Logger) removeForSpace(free, need uint64) (uint64, error) {
+	files, err := l.oldLogFiles()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %d bytes free in %s and can't list backups: %s", ErrLowDiskSpace, free, l.dir(), err)
+	}
+	// files are sorted newest first.
+	for i := len(files) - 1; i >= 0 && free < need; i-- {
+		if err := l.removeBackups(files[i : i+1]); err != nil {
+			if !os.IsNotExist(err) {
+				l.handleError(fmt.Errorf("can't remove backup to free disk space: %w", err))
+			}
+			continue
+		}
+		if free, err = diskFree(l.dir()); err != nil {
+			return 0, fmt.Errorf("%w: can't get free space in %s: %s", ErrLowDiskSpace, l.dir(), err)
+		}
+	}
+	return free, nil
+}
@@ -0,0 +1,93 @@
+package lumberjack
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// Encodings LogFileEncoding accepts.
+const (
+	EncodingUTF8    = "utf-8"
+	EncodingUTF16LE = "utf-16le"
+	EncodingUTF16BE = "utf-16be"
+)
+
+// validEncoding checks that enc, if set, is an encoding LogFileEncoding
+// supports.
+func validEncoding(enc string) error {
+	switch strings.ToLower(enc) {
+	case "", EncodingUTF8, EncodingUTF16LE, EncodingUTF16BE:
+		return nil
+	}
+	return fmt.Errorf("unsupported LogFileEncoding %q: must be %q, %q or %q",
+		enc, EncodingUTF8, EncodingUTF16LE, EncodingUTF16BE)
+}
+
+// lastLine returns the last non-empty line of the log file, decoded from
+// LogFileEncoding.
+func (l *Logger) lastLine(name string) (string, error) {
+	f, err := l.open(name)
+	if err != nil {
+		return "", fmt.Errorf("can't open log file: %w", err)
+	}
+	defer f.Close()
+	switch strings.ToLower(l.LogFileEncoding) {
+	case EncodingUTF16LE:
+		return getLastLineUTF16(f, binary.LittleEndian)
+	case EncodingUTF16BE:
+		return getLastLineUTF16(f, binary.BigEndian)
+	}
+	return readLastLine(f)
+}
+
+// getLastLineUTF16 is readLastLine for UTF-16 files, reading two-byte code
+// units backwards from the end of the file a block at a time.  A byte order
+// mark at the start of the file is dropped.
+func getLastLineUTF16(f File, order binary.ByteOrder) (string, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	// ignore a trailing odd byte, which can't be part of a code unit.
+	cursor := info.Size() &^ 1
+	var units []uint16
+	block := make([]byte, lastLineChunkSize)
+	found := false
+	for cursor > 0 && !found {
+		n := int64(len(block))
+		if cursor < n {
+			n = cursor
+		}
+		cursor -= n
+		if _, err := f.ReadAt(block[:n], cursor); err != nil && err != io.EOF {
+			return "", err
+		}
+		for i := n - 2; i >= 0; i -= 2 {
+			u := order.Uint16(block[i:])
+			if u == '\n' || u == '\r' {
+				if strings.TrimSpace(string(utf16.Decode(units))) != "" {
+					found = true
+					break
+				}
+				units = units[:0]
+				continue
+			}
+			// units are collected backwards and reversed below.
+			units = append(units, u)
+			if 2*len(units) > maxLastLineLength {
+				return "", errNoTimestamp
+			}
+		}
+	}
+	for i, j := 0, len(units)-1; i < j; i, j = i+1, j-1 {
+		units[i], units[j] = units[j], units[i]
+	}
+	if len(units) > 0 && !found && units[0] == 0xFEFF {
+		units = units[1:]
+	}
+	return strings.TrimSpace(string(utf16.Decode(units))), nil
+}
@@ -0,0 +1,71 @@
+package lumberjack
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+// encodeUTF16 returns s in UTF-16 with a byte order mark.
+func encodeUTF16(s string, order binary.ByteOrder) []byte {
+	units := utf16.Encode([]rune("\ufeff" + s))
+	b := make([]byte, 2*len(units))
+	for i, u := range units {
+		order.PutUint16(b[2*i:], u)
+	}
+	return b
+}
+
+func TestLastLineUTF16(t *testing.T) {
+	dir := makeTempDir("TestLastLineUTF16", t)
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "foobar.log")
+
+	long := strings.Repeat("日", 3*lastLineChunkSize/2)
+	blanks := strings.Repeat("\r\n", lastLineChunkSize)
+	tests := []struct {
+		encoding string
+		order    binary.ByteOrder
+		content  string
+		want     string
+	}{
+		{EncodingUTF16LE, binary.LittleEndian, "2021-01-02 15:04:05 first\r\n2021-01-03 10:00:00 second 日志\r\n\r\n", "2021-01-03 10:00:00 second 日志"},
+		{EncodingUTF16BE, binary.BigEndian, "2021-01-02 15:04:05 first\n2021-01-03 10:00:00 second\n", "2021-01-03 10:00:00 second"},
+		{"UTF-16LE", binary.LittleEndian, "2021-01-02 15:04:05 only", "2021-01-02 15:04:05 only"},
+		{EncodingUTF16LE, binary.LittleEndian, "", ""},
+		// lines and blank tails that span blocks.
+		{EncodingUTF16LE, binary.LittleEndian, "first\n" + long + "\n", long},
+		{EncodingUTF16BE, binary.BigEndian, long, long},
+		{EncodingUTF16LE, binary.LittleEndian, "first\nlast" + blanks, "last"},
+	}
+	for _, tt := range tests {
+		err := ioutil.WriteFile(name, encodeUTF16(tt.content, tt.order), 0644)
+		isNil(err, t)
+		l := &Logger{LogFileEncoding: tt.encoding}
+		got, err := l.lastLine(name)
+		isNil(err, t)
+		equals(tt.want, got, t)
+	}
+
+	// a last line past maxLastLineLength isn't read whole.
+	err := ioutil.WriteFile(name, encodeUTF16("first\n"+strings.Repeat("x", maxLastLineLength/2+1), binary.LittleEndian), 0644)
+	isNil(err, t)
+	_, err = (&Logger{LogFileEncoding: EncodingUTF16LE}).lastLine(name)
+	equals(errNoTimestamp, err, t)
+
+	// the decoded line goes to the extractor.
+	err = ioutil.WriteFile(name, encodeUTF16(tests[0].content, binary.LittleEndian), 0644)
+	isNil(err, t)
+	l := &Logger{LogFileEncoding: EncodingUTF16LE, LogFileTimeFormat: "2006-01-02 15:04:05"}
+	got, err := l.getLogFileUpdateTime(name, l.lastWriteTimeExtractor())
+	isNil(err, t)
+	equals(time.Date(2021, 1, 3, 10, 0, 0, 0, time.UTC), got, t)
+
+	l.LogFileEncoding = "latin-1"
+	notNil(l.Validate(), t)
+}
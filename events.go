@@ -0,0 +1,111 @@
+package lumberjack
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Event types reported to MetricsSink.
+const (
+	EventRotate   = "rotate"
+	EventCompress = "compress"
+	EventRemove   = "remove"
+)
+
+// event describes one lifecycle action on a log file.
+type event struct {
+	Type string    `json:"type"`
+	File string    `json:"file"`
+	Size int64     `json:"size"`
+	Time time.Time `json:"time"`
+
+	// Lines is the number of lines the rotated file held, when
+	// CountLinesOnRotate is set.
+	Lines *int64 `json:"lines,omitempty"`
+
+	// sum is the checksum of a removed file, taken before removal, for the
+	// AuditLog.
+	sum string
+}
+
+// emitRotate reports the rotation of a file, now named newname, of the given
+// size, and counts it for Stats.
+func (l *Logger) emitRotate(newname string, size int64) {
+	atomic.AddInt64(&l.totalRotations, 1)
+	if l.MetricsSink == nil && l.AuditLog == nil {
+		return
+	}
+	ev := event{Type: EventRotate, File: newname, Size: size, Time: l.now()}
+	if l.CountLinesOnRotate && l.MetricsSink != nil {
+		lines, err := countLines(l.fs(), newname)
+		if err != nil {
+			l.handleError(fmt.Errorf("can't count lines of rotated file: %s", err))
+		} else {
+			ev.Lines = &lines
+		}
+	}
+	l.emit(ev)
+}
+
+// countLines returns the number of newline-terminated lines in the file in
+// fsys.
+func countLines(fsys FileSystem, name string) (int64, error) {
+	f, err := fsys.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var lines int64
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := f.Read(buf)
+		lines += int64(bytes.Count(buf[:n], []byte{'\n'}))
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// emit reports ev to the MetricsSink and the AuditLog, if any.  Failures are
+// passed to the ErrorHandler rather than returned, since events are
+// best-effort.
+func (l *Logger) emit(ev event) {
+	l.audit(ev)
+	if l.MetricsSink == nil {
+		return
+	}
+	if w, ok := l.MetricsSink.(*Logger); ok && w == l {
+		l.handleError(errors.New("MetricsSink must not be the Logger itself"))
+		return
+	}
+	b, err := json.Marshal(ev)
+	if err != nil {
+		l.handleError(fmt.Errorf("can't encode metrics event: %s", err))
+		return
+	}
+	b = append(b, '\n')
+
+	l.sinkMu.Lock()
+	_, err = l.MetricsSink.Write(b)
+	l.sinkMu.Unlock()
+	if err != nil {
+		l.handleError(fmt.Errorf("can't write metrics event: %s", err))
+	}
+}
+
+// handleError passes err to the ErrorHandler, if any.
+func (l *Logger) handleError(err error) {
+	if err != nil && l.ErrorHandler != nil {
+		l.ErrorHandler(err)
+	}
+}
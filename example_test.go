@@ -1,6 +1,8 @@
 package lumberjack
 
 import (
+	"compress/flate"
+	"io"
 	"log"
 )
 
@@ -15,3 +17,32 @@ func Example() {
 		Compress:           true, // disabled by default
 	})
 }
+
+// deflateCompressor stands in for a third-party encoder, such as zstd from
+// github.com/klauspost/compress, which would be wrapped the same way.
+type deflateCompressor struct{}
+
+func (deflateCompressor) Suffix() string {
+	return ".deflate"
+}
+
+func (deflateCompressor) Compress(dst io.Writer, src io.Reader) error {
+	w, err := flate.NewWriter(dst, flate.BestSpeed)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// Any compression format can be used by implementing Compressor.  Backups
+// are then found by its suffix, here foo-<time>.log.deflate.
+func ExampleCompressor() {
+	log.SetOutput(&Logger{
+		fullPathFileName: "/var/log/myapp/foo.log",
+		Compress:         true,
+		Compressor:       deflateCompressor{},
+	})
+}
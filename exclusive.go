@@ -0,0 +1,103 @@
+package lumberjack
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrLockTimeout is wrapped by the errors Write returns when ExclusiveLock
+// can't take the lock within LockTimeout.
+var ErrLockTimeout = errors.New("timed out waiting for the log file lock")
+
+// errLockUnsupported is returned by tryLock where file locking isn't
+// supported.
+var errLockUnsupported = errors.New("file locking is not supported on this platform")
+
+const (
+	// defaultLockTimeout is how long ExclusiveLock waits for the lock if
+	// LockTimeout isn't set.
+	defaultLockTimeout = 10 * time.Second
+
+	// lockPollInterval is how often ExclusiveLock tries a held lock again.
+	lockPollInterval = 10 * time.Millisecond
+)
+
+// lockFile returns the name of the ExclusiveLock file.
+func (l *Logger) lockFile() string {
+	return filepath.Join(l.dir(), "."+filepath.Base(l.filename())+".lock")
+}
+
+func (l *Logger) lockTimeout() time.Duration {
+	if l.LockTimeout > 0 {
+		return l.LockTimeout
+	}
+	return defaultLockTimeout
+}
+
+// lock takes the ExclusiveLock, if it is set and not already held, and
+// returns the function that releases it.  Where locking isn't supported, the
+// problem goes to ErrorHandler once and Logger carries on without it.  It
+// assumes l.mu is held.
+func (l *Logger) lock() (unlock func(), err error) {
+	noop := func() {}
+	if !l.ExclusiveLock || l.locked != nil || l.lockUnsupported {
+		return noop, nil
+	}
+	if err := os.MkdirAll(l.dir(), l.dirMode()); err != nil {
+		return nil, fmt.Errorf("can't make directories for lock file: %w", err)
+	}
+	f, err := os.OpenFile(l.lockFile(), os.O_CREATE|os.O_RDWR, l.fileMode())
+	if err != nil {
+		return nil, fmt.Errorf("can't open lock file: %w", err)
+	}
+	for waited := time.Duration(0); ; waited += lockPollInterval {
+		ok, err := tryLock(f)
+		if err == errLockUnsupported {
+			f.Close()
+			l.lockUnsupported = true
+			l.handleError(fmt.Errorf("ExclusiveLock disabled: %w", err))
+			return noop, nil
+		}
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("can't lock %s: %w", f.Name(), err)
+		}
+		if ok {
+			break
+		}
+		if waited >= l.lockTimeout() {
+			f.Close()
+			return nil, fmt.Errorf("%w: %s is held by another process after %v", ErrLockTimeout, f.Name(), l.lockTimeout())
+		}
+		sleep(lockPollInterval)
+	}
+	l.locked = f
+	return func() {
+		if err := unlockFile(f); err != nil {
+			l.handleError(fmt.Errorf("can't unlock %s: %w", f.Name(), err))
+		}
+		f.Close()
+		l.locked = nil
+	}, nil
+}
+
+// rotatedElsewhere reports whether, with ExclusiveLock, the open file is no
+// longer the one at the log file's name, because another process rotated it
+// while this one waited for the lock.
+func (l *Logger) rotatedElsewhere() bool {
+	if !l.ExclusiveLock || l.file == nil {
+		return false
+	}
+	open, err := l.file.Stat()
+	if err != nil {
+		return false
+	}
+	info, err := l.fs().Stat(l.filename())
+	if err != nil {
+		return false
+	}
+	return !sameFile(open, info)
+}
@@ -0,0 +1,51 @@
+package lumberjack
+
+import (
+	"regexp"
+	"time"
+)
+
+// LastWriteTimeExtractorFunc adapts a function to a LastWriteTimeExtractor.
+type LastWriteTimeExtractorFunc func(lastLine string) (time.Time, error)
+
+// Extract calls f(lastLine).
+func (f LastWriteTimeExtractorFunc) Extract(lastLine string) (time.Time, error) {
+	return f(lastLine)
+}
+
+// regexpTimeExtractor is the LastWriteTimeExtractor NewRegexpTimeExtractor
+// returns.
+type regexpTimeExtractor struct {
+	re     *regexp.Regexp
+	layout string
+	loc    *time.Location
+}
+
+// NewRegexpTimeExtractor returns a LastWriteTimeExtractor that finds the
+// timestamp in a line with re, taking its first group if it has one and its
+// whole match otherwise, and parses it with layout in loc.  A nil loc means
+// the time zone of the Logger it is set on, as given by Timezone or
+// LocalTime, as for the default extractor; called other than by a Logger,
+// it parses in UTC.  For JSON lines such as
+// {"ts":"2024-06-01T10:00:00Z",...}, that is
+// regexp.MustCompile(`"ts":"([^"]+)"`) with time.RFC3339.  A line re doesn't
+// match is taken to have no timestamp, so Init keeps the file as it is.
+func NewRegexpTimeExtractor(re *regexp.Regexp, layout string, loc *time.Location) LastWriteTimeExtractor {
+	return regexpTimeExtractor{re: re, layout: layout, loc: loc}
+}
+
+func (e regexpTimeExtractor) Extract(lastLine string) (time.Time, error) {
+	m := e.re.FindStringSubmatch(lastLine)
+	if m == nil {
+		return time.Time{}, errNoTimestamp
+	}
+	s := m[0]
+	if len(m) > 1 {
+		s = m[1]
+	}
+	loc := e.loc
+	if loc == nil {
+		loc = time.UTC
+	}
+	return time.ParseInLocation(e.layout, s, loc)
+}
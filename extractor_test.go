@@ -0,0 +1,82 @@
+package lumberjack
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestRegexpTimeExtractor(t *testing.T) {
+	want := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		re     string
+		layout string
+		line   string
+		ok     bool
+	}{
+		{`"ts":"([^"]+)"`, time.RFC3339, `{"msg":"bye","ts":"2024-06-01T10:00:00Z"}`, true},
+		{`\d{4}/\d\d/\d\d \d\d:\d\d:\d\d`, "2006/01/02 15:04:05", "[app] 2024/06/01 10:00:00 bye", true},
+		{`"ts":"([^"]+)"`, time.RFC3339, `{"msg":"bye"}`, false},
+		{`"ts":"([^"]+)"`, time.RFC3339, `{"ts":"yesterday"}`, false},
+	}
+	for _, test := range tests {
+		e := NewRegexpTimeExtractor(regexp.MustCompile(test.re), test.layout, nil)
+		got, err := e.Extract(test.line)
+		equals(test.ok, err == nil, t)
+		if test.ok {
+			equals(want, got, t)
+		}
+	}
+
+	// a line it doesn't match just has no timestamp.
+	_, err := NewRegexpTimeExtractor(regexp.MustCompile(`ts=(\S+)`), time.RFC3339, nil).Extract("bye")
+	equals(errNoTimestamp, err, t)
+
+	// the time is parsed in the zone given.
+	loc := time.FixedZone("UTC+8", 8*60*60)
+	got, err := NewRegexpTimeExtractor(regexp.MustCompile(`^\S+ \S+`), "2006-01-02 15:04:05", loc).Extract("2024-06-01 18:00:00 bye")
+	isNil(err, t)
+	equals(want.Unix(), got.Unix(), t)
+
+	// without one, a Logger has it parse in the Logger's zone.
+	l := &Logger{
+		Timezone:               "Asia/Shanghai",
+		LastWriteTimeExtractor: NewRegexpTimeExtractor(regexp.MustCompile(`^\S+ \S+`), "2006-01-02 15:04:05", nil),
+	}
+	got, err = l.lastWriteTimeExtractor().Extract("2024-06-01 18:00:00 bye")
+	isNil(err, t)
+	equals(want.Unix(), got.Unix(), t)
+}
+
+func TestInitRegexpTimeExtractor(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestInitRegexpTimeExtractor", t)
+	defer os.RemoveAll(dir)
+
+	lastWrite := fakeTime().UTC().Add(-72 * time.Hour).Truncate(time.Second)
+	data := []byte("level=info ts=" + lastWrite.Format("2006/01/02-15:04:05") + " msg=bye\n")
+	err := ioutil.WriteFile(logFile(dir), data, 0644)
+	isNil(err, t)
+
+	var lines []string
+	l := &Logger{
+		LogPathName:   dir + string(filepath.Separator),
+		LogFileName:   "foobar",
+		LogFileSuffix: ".log",
+		LastWriteTimeExtractor: LastWriteTimeExtractorFunc(func(lastLine string) (time.Time, error) {
+			lines = append(lines, lastLine)
+			return NewRegexpTimeExtractor(regexp.MustCompile(`ts=(\S+)`), "2006/01/02-15:04:05", nil).Extract(lastLine)
+		}),
+	}
+	defer l.Close()
+	err = l.Init()
+	isNil(err, t)
+	equals([]string{string(data[:len(data)-1])}, lines, t)
+
+	// the stale file was moved aside using the time from its last line.
+	notExist(logFile(dir), t)
+	existsWithContent(filepath.Join(dir, "foobar-"+lastWrite.Format(backupTimeFormat)+".log"), data, t)
+}
@@ -0,0 +1,17 @@
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package lumberjack
+
+import "os"
+
+// tryLock is a no-op; file locking is only supported on linux,
+// darwin and the BSDs.
+func tryLock(_ *os.File) (bool, error) {
+	return false, errLockUnsupported
+}
+
+// unlockFile is a no-op; file locking is only supported on linux,
+// darwin and the BSDs.
+func unlockFile(_ *os.File) error {
+	return nil
+}
@@ -0,0 +1,23 @@
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package lumberjack
+
+import (
+	"os"
+	"syscall"
+)
+
+// tryLock takes an exclusive flock on f without waiting, reporting whether
+// it got it.
+func tryLock(f *os.File) (bool, error) {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// unlockFile releases the flock on f.
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
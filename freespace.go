@@ -0,0 +1,8 @@
+// +build !linux
+
+package lumberjack
+
+// diskFree exists so it can be mocked out by tests.
+var diskFree = func(_ string) (uint64, error) {
+	return 0, errFreeSpaceUnsupported
+}
@@ -0,0 +1,13 @@
+package lumberjack
+
+import "syscall"
+
+// diskFree returns the bytes available to unprivileged users on the
+// filesystem holding dir.  It is a var so it can be mocked out by tests.
+var diskFree = func(dir string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
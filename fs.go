@@ -0,0 +1,151 @@
+package lumberjack
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// FileSystem is where Logger keeps the log file and its backups.  The
+// default is the operating system's; another, such as the in-memory one in
+// lumberjacktest, lets tests run a Logger without touching the disk.
+type FileSystem interface {
+	// OpenFile opens the named file as os.OpenFile does.
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+
+	// Stat returns the FileInfo of the named file, following symbolic
+	// links.  The FileInfos of a file, from Stat or from File.Stat, should
+	// have the same Sys, and those of different files different ones, as
+	// Logger tells whether the log file has been moved by them.
+	Stat(name string) (os.FileInfo, error)
+
+	// Lstat returns the FileInfo of the named file, without following a
+	// symbolic link.
+	Lstat(name string) (os.FileInfo, error)
+
+	// Rename renames oldpath to newpath, replacing any file already there.
+	Rename(oldpath, newpath string) error
+
+	// Remove removes the named file.
+	Remove(name string) error
+
+	// MkdirAll creates the directory path and any parents it needs.
+	MkdirAll(path string, perm os.FileMode) error
+
+	// ReadDir returns the entries of the directory dirname, sorted by name.
+	ReadDir(dirname string) ([]os.FileInfo, error)
+}
+
+// File is a file opened by a FileSystem.  *os.File is one.  EnforceFileMode
+// uses the file's Chmod method, if it has one as *os.File does.
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Writer
+	io.Closer
+
+	// Name returns the name the file was opened with.
+	Name() string
+
+	// Stat returns the FileInfo of the open file.
+	Stat() (os.FileInfo, error)
+
+	// Sync commits the file's contents to stable storage.
+	Sync() error
+}
+
+// osFS is the operating system's FileSystem.
+type osFS struct{}
+
+func (osFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (osFS) Stat(name string) (os.FileInfo, error) {
+	return osStat(name)
+}
+
+func (osFS) Lstat(name string) (os.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+func (osFS) Rename(oldpath, newpath string) error {
+	return osRename(oldpath, newpath)
+}
+
+func (osFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (osFS) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (osFS) ReadDir(dirname string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(dirname)
+}
+
+// fs returns the FileSystem, or the operating system's if it isn't set.
+func (l *Logger) fs() FileSystem {
+	if l.FileSystem != nil {
+		return l.FileSystem
+	}
+	return osFS{}
+}
+
+// sameFile reports whether a and b describe the same file, as os.SameFile
+// does for the operating system's FileSystem; for another, they must have
+// the same Sys.
+func sameFile(a, b os.FileInfo) bool {
+	if os.SameFile(a, b) {
+		return true
+	}
+	return a.Sys() != nil && a.Sys() == b.Sys()
+}
+
+// chmodFile changes the mode of f, if f has a Chmod method.
+func chmodFile(f File, mode os.FileMode) error {
+	if c, ok := f.(interface{ Chmod(os.FileMode) error }); ok {
+		return c.Chmod(mode)
+	}
+	return nil
+}
+
+// open opens the named file for reading from the FileSystem.
+func (l *Logger) open(name string) (File, error) {
+	return l.fs().OpenFile(name, os.O_RDONLY, 0)
+}
+
+// validFileSystem checks that, with a FileSystem other than the operating
+// system's, none of the features that keep files of their own outside it
+// are set.
+func (l *Logger) validFileSystem() []error {
+	if l.FileSystem == nil {
+		return nil
+	}
+	var errs []error
+	for _, f := range []struct {
+		field string
+		set   bool
+	}{
+		{"ExclusiveLock", l.ExclusiveLock},
+		{"HashChain", l.HashChain},
+		{"CurrentMarker", l.CurrentMarker},
+		{"SymlinkPath", l.SymlinkPath != ""},
+		{"ArchiveHardlinkDir", l.ArchiveHardlinkDir != ""},
+		{"PersistCounters", l.PersistCounters},
+		{"GenerationNaming", l.GenerationNaming},
+		{"MinFreeDiskMB", l.MinFreeDiskMB > 0},
+		{"MaxSizePercentFree", l.MaxSizePercentFree > 0},
+	} {
+		if f.set {
+			errs = append(errs, fmt.Errorf("%s isn't supported with a FileSystem", f.field))
+		}
+	}
+	return errs
+}
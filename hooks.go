@@ -0,0 +1,35 @@
+package lumberjack
+
+import "fmt"
+
+// notifyRotate calls OnRotate, if set, on a goroutine of its own.
+func (l *Logger) notifyRotate(oldPath, backup string) {
+	if l.OnRotate == nil {
+		return
+	}
+	f := l.OnRotate
+	go l.runHook("OnRotate", func() {
+		f(oldPath, backup)
+	})
+}
+
+// runHook calls f, the callback called name, reporting a panic to
+// ErrorHandler rather than letting it end the process.
+func (l *Logger) runHook(name string, f func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			l.handleError(fmt.Errorf("%s panicked: %v", name, r))
+		}
+	}()
+	f()
+}
+
+// notifyCompress calls OnCompress, if set.
+func (l *Logger) notifyCompress(dst string, originalSize, compressedSize int64) {
+	if l.OnCompress == nil {
+		return
+	}
+	l.runHook("OnCompress", func() {
+		l.OnCompress(dst, originalSize, compressedSize)
+	})
+}
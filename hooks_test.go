@@ -0,0 +1,118 @@
+package lumberjack
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOnRotate(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestOnRotate", t)
+	defer os.RemoveAll(dir)
+
+	type rotation struct{ old, backup string }
+	rotations := make(chan rotation)
+	release := make(chan bool)
+	errs := make(chan error, 1)
+	l := &Logger{
+		fullPathFileName: logFile(dir),
+		OnRotate: func(old, backup string) {
+			rotations <- rotation{old, backup}
+			if <-release {
+				panic("boom")
+			}
+		},
+		ErrorHandler: func(err error) {
+			errs <- err
+		},
+	}
+	defer l.Close()
+	_, err := l.Write([]byte("boo!"))
+	isNil(err, t)
+	newFakeTime()
+	err = l.Rotate()
+	isNil(err, t)
+
+	got := <-rotations
+	equals(rotation{logFile(dir), backupFile(dir)}, got, t)
+	existsWithContent(got.backup, []byte("boo!"), t)
+
+	// writes carry on while the callback is busy.
+	done := make(chan error)
+	go func() {
+		_, err := l.Write([]byte("foo"))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		isNil(err, t)
+	case <-time.After(time.Second):
+		t.Fatal("write blocked by OnRotate")
+	}
+
+	// and a panic is reported rather than crashing.
+	release <- true
+	select {
+	case err := <-errs:
+		assert(strings.Contains(err.Error(), "boom"), t, "unexpected error %v", err)
+	case <-time.After(time.Second):
+		t.Fatal("panic in OnRotate not reported")
+	}
+	_, err = l.Write([]byte("bar"))
+	isNil(err, t)
+	existsWithContent(logFile(dir), []byte("foobar"), t)
+}
+
+func TestOnCompress(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestOnCompress", t)
+	defer os.RemoveAll(dir)
+
+	data := []byte(strings.Repeat("boo! ", 100))
+	err := ioutil.WriteFile(backupFile(dir), data, 0644)
+	isNil(err, t)
+
+	var errs []error
+	calls := 0
+	l := &Logger{
+		fullPathFileName: logFile(dir),
+		Compress:         true,
+		OnCompress: func(compressed string, originalSize, compressedSize int64) {
+			calls++
+			equals(backupFile(dir)+compressSuffix, compressed, t)
+			equals(int64(len(data)), originalSize, t)
+			info, err := os.Stat(compressed)
+			isNil(err, t)
+			equals(info.Size(), compressedSize, t)
+			assert(compressedSize < originalSize, t, "expected %d to be smaller than %d", compressedSize, originalSize)
+			// the original is still there.
+			existsWithContent(backupFile(dir), data, t)
+			if calls > 1 {
+				panic("boom")
+			}
+		},
+		ErrorHandler: func(err error) {
+			errs = append(errs, err)
+		},
+	}
+	err = l.millRunOnce()
+	isNil(err, t)
+	equals(1, calls, t)
+	notExist(backupFile(dir), t)
+	exists(backupFile(dir)+compressSuffix, t)
+
+	// a panic is reported and doesn't cost the compressed file.
+	newFakeTime()
+	err = ioutil.WriteFile(backupFile(dir), data, 0644)
+	isNil(err, t)
+	err = l.millRunOnce()
+	isNil(err, t)
+	equals(2, calls, t)
+	equals(1, len(errs), t)
+	assert(strings.Contains(errs[0].Error(), "OnCompress panicked: boom"), t, "unexpected error %v", errs[0])
+	notExist(backupFile(dir), t)
+	exists(backupFile(dir)+compressSuffix, t)
+}
@@ -3,7 +3,9 @@
 package lumberjack
 
 import (
+	"errors"
 	"os"
+	"path/filepath"
 	"syscall"
 	"testing"
 	"time"
@@ -103,7 +105,7 @@ func TestCompressMaintainMode(t *testing.T) {
 		LogMaxSaveQuantity: 1,
 		LogMaxSize:         100, // megabytes
 	}
-	defer l.Close()
+	defer closeWait(l, t)
 	b := []byte("boo!")
 	n, err := l.Write(b)
 	isNil(err, t)
@@ -114,9 +116,8 @@ func TestCompressMaintainMode(t *testing.T) {
 	err = l.Rotate()
 	isNil(err, t)
 
-	// we need to wait a little bit since the files get compressed on a different
-	// goroutine.
-	<-time.After(10 * time.Millisecond)
+	// wait for the files to be compressed on the mill goroutine.
+	l.waitMill()
 
 	// a compressed version of the log file should now exist with the correct
 	// mode.
@@ -153,7 +154,7 @@ func TestCompressMaintainOwner(t *testing.T) {
 		LogMaxSaveQuantity: 1,
 		LogMaxSize:         100, // megabytes
 	}
-	defer l.Close()
+	defer closeWait(l, t)
 	b := []byte("boo!")
 	n, err := l.Write(b)
 	isNil(err, t)
@@ -164,9 +165,8 @@ func TestCompressMaintainOwner(t *testing.T) {
 	err = l.Rotate()
 	isNil(err, t)
 
-	// we need to wait a little bit since the files get compressed on a different
-	// goroutine.
-	<-time.After(10 * time.Millisecond)
+	// wait for the files to be compressed on the mill goroutine.
+	l.waitMill()
 
 	// a compressed version of the log file should now exist with the correct
 	// owner.
@@ -175,6 +175,81 @@ func TestCompressMaintainOwner(t *testing.T) {
 	equals(666, fakeFS.files[filename2+compressSuffix].gid, t)
 }
 
+func TestEnforceFileMode(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestEnforceFileMode", t)
+	defer os.RemoveAll(dir)
+
+	filename := logFile(dir)
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_RDWR, 0600)
+	isNil(err, t)
+	f.Close()
+
+	l := &Logger{
+		fullPathFileName: filename,
+		FileMode:         0644,
+		EnforceFileMode:  true,
+	}
+	defer l.Close()
+	b := []byte("boo!")
+	n, err := l.Write(b)
+	isNil(err, t)
+	equals(len(b), n, t)
+
+	info, err := os.Stat(filename)
+	isNil(err, t)
+	equals(os.FileMode(0644), info.Mode(), t)
+	existsWithContent(filename, b, t)
+}
+
+func TestPreserveOwner(t *testing.T) {
+	// not a permission error, which rotation would work around.
+	osChown = func(string, int, int) error {
+		return errors.New("chown failed")
+	}
+	defer func() { osChown = os.Chown }()
+	currentTime = fakeTime
+	dir := makeTempDir("TestPreserveOwner", t)
+	defer os.RemoveAll(dir)
+
+	filename := logFile(dir)
+	l := &Logger{fullPathFileName: filename}
+	defer closeWait(l, t)
+	b := []byte("boo!")
+	_, err := l.Write(b)
+	isNil(err, t)
+
+	// by default a chown failure aborts the rotation.
+	newFakeTime()
+	err = l.Rotate()
+	notNil(err, t)
+
+	// disabled, the attempt is skipped.
+	preserve := false
+	l.PreserveOwner = &preserve
+	l.Compress = true
+	newFakeTime()
+	err = l.Rotate()
+	isNil(err, t)
+	_, err = l.Write(b)
+	isNil(err, t)
+	existsWithContent(filename, b, t)
+
+	// and compression doesn't fail on it either.
+	newFakeTime()
+	errs := make(chan error, 10)
+	l.ErrorHandler = func(err error) { errs <- err }
+	err = l.Rotate()
+	isNil(err, t)
+	l.waitMill()
+	exists(backupFile(dir)+compressSuffix, t)
+	select {
+	case err := <-errs:
+		t.Fatalf("unexpected error: %v", err)
+	default:
+	}
+}
+
 type fakeFile struct {
 	uid int
 	gid int
@@ -203,3 +278,80 @@ func (fs *fakeFS) Stat(name string) (os.FileInfo, error) {
 	stat.Gid = 666
 	return info, nil
 }
+
+func TestExclusiveLock(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestExclusiveLock", t)
+	defer os.RemoveAll(dir)
+
+	// two Loggers stand in for two processes writing the same file.
+	l1 := &Logger{fullPathFileName: logFile(dir), ExclusiveLock: true}
+	defer l1.Close()
+	l2 := &Logger{fullPathFileName: logFile(dir), ExclusiveLock: true}
+	defer l2.Close()
+	write := func(l *Logger, s string) {
+		_, err := l.Write([]byte(s))
+		isNilUp(err, t, 1)
+	}
+	write(l1, "a")
+	write(l2, "b")
+
+	newFakeTime()
+	err := l1.Rotate()
+	isNil(err, t)
+	// l2 finds the file already rotated and follows l1 to the new one.
+	err = l2.Rotate()
+	isNil(err, t)
+	write(l2, "c")
+	write(l1, "d")
+
+	existsWithContent(backupFile(dir), []byte("ab"), t)
+	existsWithContent(logFile(dir), []byte("cd"), t)
+	// the log file, one backup and the lock file.
+	fileCount(dir, 3, t)
+
+	// l2 follows l1's rotation on its next write, too.
+	newFakeTime()
+	err = l1.Rotate()
+	isNil(err, t)
+	write(l2, "e")
+	write(l1, "f")
+	existsWithContent(backupFile(dir), []byte("cd"), t)
+	existsWithContent(logFile(dir), []byte("ef"), t)
+	fileCount(dir, 4, t)
+}
+
+func TestExclusiveLockTimeout(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestExclusiveLockTimeout", t)
+	defer os.RemoveAll(dir)
+
+	sleeps := 0
+	sleep = func(time.Duration) { sleeps++ }
+	defer func() { sleep = time.Sleep }()
+
+	// another process holds the lock.
+	f, err := os.OpenFile(filepath.Join(dir, ".foobar.log.lock"), os.O_CREATE|os.O_RDWR, 0644)
+	isNil(err, t)
+	defer f.Close()
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+	isNil(err, t)
+
+	l := &Logger{
+		fullPathFileName: logFile(dir),
+		ExclusiveLock:    true,
+		LockTimeout:      50 * time.Millisecond,
+	}
+	defer l.Close()
+	_, err = l.Write([]byte("boo!"))
+	assert(errors.Is(err, ErrLockTimeout), t, "expected ErrLockTimeout, got %v", err)
+	equals(5, sleeps, t)
+	notExist(logFile(dir), t)
+
+	// once it lets go, writes go through.
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	isNil(err, t)
+	_, err = l.Write([]byte("boo!"))
+	isNil(err, t)
+	existsWithContent(logFile(dir), []byte("boo!"), t)
+}
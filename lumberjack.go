@@ -18,24 +18,28 @@
 //
 // Lumberjack assumes that only one process is writing to the output files.
 // Using the same lumberjack configuration from multiple processes on the same
-// machine will result in improper behavior.
+// machine will result in improper behavior, unless ExclusiveLock is set.
 package lumberjack
 
 import (
-	"compress/gzip"
+	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"io/ioutil"
-	"log"
 	"os"
 	"path"
 	"path/filepath"
 	"reflect"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
@@ -73,6 +77,9 @@ var _ io.WriteCloser = (*Logger)(nil)
 // original extension.  For example, if your Logger.fullPathFileName is
 // `/var/log/foo/server.log`, a backup created at 6:30pm on Nov 11 2016 would
 // use the filename `/var/log/foo/server-2016-11-04T18-30-00.000.log`
+// A backup rotated in the same second as an existing one gets a counter after
+// its timestamp, as in `server-2016-11-04T18-30-00-1.log`, rather than
+// replacing it.
 //
 // Cleaning Up Old Log Files
 //
@@ -82,9 +89,27 @@ var _ io.WriteCloser = (*Logger)(nil)
 // with an encoded timestamp older than LogMaxSaveDay days are deleted, regardless of
 // LogMaxSaveQuantity.  Note that the time encoded in the timestamp is the rotation
 // time, which may differ from the last time that file was written to.
+// LogMaxTotalSize then removes the oldest remaining backups while they and
+// the log file take more than that many megabytes between them.
 //
-// If LogMaxSaveQuantity and LogMaxSaveDay are both 0, no old log files will be deleted.
+// If LogMaxSaveQuantity, LogMaxSaveDay and LogMaxTotalSize are all 0, no old log files will be deleted.
 type Logger struct {
+	// size is the size of the open file.  It comes first so that it is
+	// 64-bit aligned for the atomic updates of UnlockedAppend.
+	size int64
+
+	// compressPermille is the size of the last backup compressed, in
+	// thousandths of its original, for RemoveThenCompress to estimate with.
+	// It is updated atomically, and follows size to stay aligned.
+	compressPermille int64
+
+	// totalBytes, totalRotations, totalCompressions and totalRemoved are
+	// the counters of Stats.  They are updated atomically.
+	totalBytes        int64
+	totalRotations    int64
+	totalCompressions int64
+	totalRemoved      int64
+
 	// fullPathFileName is the file to write logs to.  Backup log files will be retained
 	// in the same directory.  It uses <processname>-lumberjack.log in
 	// os.TempDir() if empty.
@@ -93,6 +118,16 @@ type Logger struct {
 	// rotated. It defaults to 100 megabytes.
 	LogMaxSize int `json:"LogMaxSize" yaml:"LogMaxSize"`
 
+	// MaxSizePercentFree, if positive and LogMaxSize isn't set, rotates the
+	// file when it reaches this percentage of the free space on the log
+	// directory's filesystem, so the limit adapts to the volume.  The free
+	// space is measured whenever a file is opened, and the limit then holds
+	// until the next rotation, however the free space changes.  If the
+	// free space can't be found, which is everywhere but Linux, the previous
+	// limit or the default is used and the error goes to ErrorHandler.  It
+	// can't be used with a FileSystem, whose free space it can't measure.
+	MaxSizePercentFree float64 `json:"MaxSizePercentFree" yaml:"MaxSizePercentFree"`
+
 	// LogMaxSaveDay is the maximum number of days to retain old log files based on the
 	// timestamp encoded in their filename.  Note that a day is defined as 24
 	// hours and may not exactly correspond to calendar days due to daylight
@@ -100,23 +135,158 @@ type Logger struct {
 	// based on age.
 	LogMaxSaveDay int `json:"LogMaxSaveDay" yaml:"LogMaxSaveDay"`
 
+	// RetentionTimeSource selects the time LogMaxSaveDay measures a backup's
+	// age from.  The default, EmbeddedTimestamp, uses the time in its name;
+	// ModTime uses its modification time, for when the clock was wrong as
+	// backups were made or they were restored under new names.
+	RetentionTimeSource RetentionTimeSource `json:"RetentionTimeSource" yaml:"RetentionTimeSource"`
+
+	// RetentionGracePeriod keeps any backup modified more recently than this
+	// from being removed, whether LogMaxSaveDay, LogMaxSaveQuantity or
+	// ThinningPolicy would otherwise remove it, so that a slow shipper can
+	// finish reading it.  Such a backup is held, not compressed, and removed
+	// by the first pass after the grace period if it still qualifies, so
+	// there can be more backups than LogMaxSaveQuantity meanwhile.  Zero
+	// disables it.
+	RetentionGracePeriod time.Duration `json:"RetentionGracePeriod" yaml:"RetentionGracePeriod"`
+
 	// LogMaxSaveQuantity is the maximum number of old log files to retain.  The default
 	// is to retain all old log files (though LogMaxSaveDay may still cause them to get
 	// deleted.)
 	LogMaxSaveQuantity int `json:"LogMaxSaveQuantity" yaml:"LogMaxSaveQuantity"`
 
+	// LogMaxTotalSize, if positive, caps in megabytes the space taken by the
+	// log file and its backups together.  It is applied after ThinningPolicy,
+	// LogMaxSaveQuantity and LogMaxSaveDay, removing the oldest of the backups
+	// they keep until the rest and the log file fit, with compressed backups
+	// counted at their size on disk.  RetentionOrder decides how backups the
+	// same pass compresses are counted.  The log file itself is never
+	// removed, so it alone can exceed the cap.
+	LogMaxTotalSize int `json:"LogMaxTotalSize" yaml:"LogMaxTotalSize"`
+
+	// RetentionOrder says whether LogMaxTotalSize is applied before backups
+	// are compressed, RemoveThenCompress (the default), or after,
+	// CompressThenRemove.
+	RetentionOrder RetentionOrder `json:"RetentionOrder" yaml:"RetentionOrder"`
+
 	// LocalTime determines if the time used for formatting the timestamps in
 	// backup files is the computer's local time.  The default is to use UTC
 	// time.
 	LocalTime bool `json:"LocalTime" yaml:"LocalTime"`
 
+	// Timezone, if set, is the IANA name of the time zone, such as
+	// "Asia/Shanghai", used for the timestamps in backup files and to decide
+	// when a day ends.  It takes precedence over LocalTime.
+	Timezone string `json:"Timezone" yaml:"Timezone"`
+
+	// Clock, if set, is used in place of the system clock for everything
+	// Logger times: backup names, day boundaries, retention and events.  It
+	// lets tests simulate days of logging in moments; see the
+	// lumberjacktest package.
+	Clock Clock `json:"-" yaml:"-" toml:"-"`
+
+	// FileSystem, if set, is used in place of the operating system's for
+	// the log file and its backups: writing, rotation, retention,
+	// compression and Init.  Like Clock, it is mostly for tests; see
+	// lumberjacktest.MemFS.  ExclusiveLock, HashChain, CurrentMarker,
+	// SymlinkPath, ArchiveHardlinkDir, PersistCounters, GenerationNaming,
+	// MinFreeDiskMB and MaxSizePercentFree keep files or query the disk
+	// outside it, so they can't be used with it, and PreserveOwner has no
+	// effect.
+	FileSystem FileSystem `json:"-" yaml:"-" toml:"-"`
+
 	// Compress determines if the rotated log files should be compressed
 	// using gzip. The default is not to perform compression.
 	Compress bool `json:"Compress" yaml:"Compress"`
 
+	// Compressor is used to compress rotated log files when Compress is set.
+	// It defaults to gzip.  Backups are recognized by the Compressor's
+	// suffix, so changing it leaves files made by the old one unmanaged.
+	Compressor Compressor `json:"-" yaml:"-" toml:"-"`
+
+	// CompressReplaceExtension makes compressed backups replace the log
+	// file's extension with the Compressor's suffix, as in foo-<time>.gz,
+	// rather than append to it, as in foo-<time>.log.gz, for tools that
+	// expect the former.  Backups are recognized by the chosen scheme only,
+	// so changing it leaves the compressed backups made under the other
+	// unmanaged; Orphans reports them.
+	CompressReplaceExtension bool `json:"CompressReplaceExtension" yaml:"CompressReplaceExtension"`
+
+	// CompressMinSize is the size in bytes below which rotated files are left
+	// uncompressed, since compressing tiny files wastes CPU and can make them
+	// larger.  Uncompressed backups still count towards retention.  The
+	// default of 0 compresses every backup.
+	CompressMinSize int64 `json:"CompressMinSize" yaml:"CompressMinSize"`
+
+	// CompressAfterDays leaves backups uncompressed until they are that many
+	// days old, by the time LogMaxSaveDay goes by, so the most recent stay
+	// plain text for grep; the first cleanup after a backup is old enough,
+	// at a rotation or Prune, compresses it.  The default of 0 compresses
+	// backups as soon as they are made.
+	CompressAfterDays int `json:"CompressAfterDays" yaml:"CompressAfterDays"`
+
+	// CompressConcurrency is how many backups a cleanup compresses at once,
+	// for catching up on a backlog, as after a long downtime, on more than
+	// one core.  SetCompressMemoryBudget still bounds the memory they take
+	// between them.  OnCompress may then be called from several goroutines
+	// at once.  The default of 0, like 1, compresses one backup at a time.
+	CompressConcurrency int `json:"CompressConcurrency" yaml:"CompressConcurrency"`
+
+	// CompressLevel is the gzip compression level, from gzip.HuffmanOnly to
+	// gzip.BestCompression, used by the default Compressor.  Zero means
+	// gzip.DefaultCompression.
+	CompressLevel int `json:"CompressLevel" yaml:"CompressLevel"`
+
+	// StartupCompressLevel is the gzip level used for backups compressed by
+	// Init, where a backlog left by downtime may favor speed over ratio.
+	// Zero means CompressLevel.
+	StartupCompressLevel int `json:"StartupCompressLevel" yaml:"StartupCompressLevel"`
+
+	// StartupCompressAsync makes Init only rename a stale log file, leaving
+	// its compression, along with the removal of old backups, to the
+	// background goroutine, so that a large file left by downtime doesn't
+	// hold up startup.  The backup is then compressed at CompressLevel
+	// rather than StartupCompressLevel, shortly after Init returns.
+	StartupCompressAsync bool `json:"StartupCompressAsync" yaml:"StartupCompressAsync"`
+
 	//日志分割单位：天
 	LogSplitDay int `json:"LogSplitDay" yaml:"LogSplitDay"`
 
+	// LogSplitHour, if positive, rotates the log file every LogSplitHour
+	// hours, on the hour: a file opened at 10:20 with LogSplitHour 1 is
+	// rotated at the first write from 11:00.  With LogSplitDay too, whichever
+	// boundary comes first rotates the file, and the hours count again from
+	// the new file.  Size-based rotation still applies.
+	LogSplitHour int `json:"LogSplitHour" yaml:"LogSplitHour"`
+
+	// RotateAtMidnight makes LogSplitDay rotate the file at midnight, by a
+	// timer started in Init, rather than on the first write of the new day,
+	// so a quiet service's daily files still break at 00:00:00.  Midnight
+	// goes by Timezone or LocalTime, as the day split does.  Close stops the
+	// timer; only Init starts it.  Rotation errors go to ErrorHandler.  It
+	// has no effect without LogSplitDay, and doesn't suit WriteAt, since the
+	// timer follows Clock rather than the times written.
+	RotateAtMidnight bool `json:"RotateAtMidnight" yaml:"RotateAtMidnight"`
+
+	// DayRolloverAt is the time of day, as "15:04:05", at which LogSplitDay
+	// starts a new day, so that a day's logs can follow a business day
+	// rather than the calendar: with "06:00:00", the file is split at the
+	// first write from 06:00, its backup named for 05:59:59, and Init
+	// treats a log file last written before today's 06:00 as stale.
+	// RotateAtMidnight then rotates at that time too.  It goes by Timezone
+	// or LocalTime, and defaults to midnight.
+	DayRolloverAt string `json:"DayRolloverAt" yaml:"DayRolloverAt"`
+
+	// PersistCounters keeps the counters Stats reports in a hidden file next
+	// to the log file, named .<filename>.counters, and restores them in
+	// Init, so they count over the life of the log rather than of the
+	// process, as billing and quotas need.  They are saved on
+	// rotation, on Close and by the first write 10 seconds or more after the
+	// last save; a crash loses what was counted since.  Each save writes and
+	// renames a small file, which is why it isn't done on every write.
+	// UnlockedAppend doesn't apply with it.
+	PersistCounters bool `json:"PersistCounters" yaml:"PersistCounters"`
+
 	//日志保存路径
 	LogPathName string `json:"LogPathName" yaml:"LogPathName"`
 
@@ -126,20 +296,639 @@ type Logger struct {
 	//日志后缀
 	LogFileSuffix string `json:"LogFileSuffix" yaml:"LogFileSuffix"`
 
+	// BackupFileSuffix, if set, is the extension given to backups instead of
+	// the active file's own.  For example, with an active file server.active
+	// and a BackupFileSuffix of ".log", backups are named
+	// server-<timestamp>.log, letting downstream tools tell the live file
+	// apart by its extension.
+	BackupFileSuffix string `json:"BackupFileSuffix" yaml:"BackupFileSuffix"`
+
+	// CompressFileSuffix, if set, is the extension given to compressed
+	// backups instead of the Compressor's, ".gz" by default, for systems
+	// where another process has claimed that extension.  Backups compressed
+	// under another suffix are no longer recognized; see Orphans.
+	CompressFileSuffix string `json:"CompressFileSuffix" yaml:"CompressFileSuffix"`
+
+	// TempFileSuffix is the extension of the temporary files Logger writes
+	// and renames into place, such as the generation record, the
+	// CurrentMarker and PersistCounters files, the SymlinkPath link and
+	// copies made by ArchiveHardlinkDir.  It defaults to ".tmp".
+	TempFileSuffix string `json:"TempFileSuffix" yaml:"TempFileSuffix"`
+
+	// CurrentMarker makes Logger keep a marker file next to the log file,
+	// named after it with the extension replaced by .current, as in
+	// server.current, holding the absolute path of the file being written
+	// and a newline.  It is replaced atomically whenever a log file is
+	// opened, so log collectors can read it to find the live file whatever
+	// the naming scheme.  Retention ignores it.  Failures to write it go to
+	// ErrorHandler.
+	CurrentMarker bool `json:"CurrentMarker" yaml:"CurrentMarker"`
+
+	// SymlinkPath, if set, is kept as a symbolic link to the absolute path
+	// of the log file being written, for tailers that follow one fixed
+	// path.  It is replaced atomically whenever a log file is opened.  On
+	// Windows, where making symlinks takes a privilege, a hard link is made
+	// instead when a symlink can't be; it follows the file it was made for
+	// through a rotation until the next one opens.  Failures go to
+	// ErrorHandler.
+	SymlinkPath string `json:"SymlinkPath" yaml:"SymlinkPath"`
+
+	// BackupTimeFormat, if set, is the time layout used for the timestamp in
+	// backup names in place of 2006-01-02T15-04-05, and to read it back for
+	// retention, so "2006-01-02" gives backups such as server-2024-06-01.log.
+	// A layout coarser than a second can give two rotations the same
+	// timestamp; the later backup then gets a counter after it, as in
+	// server-2024-06-01-1.log, so neither replaces the other, and
+	// DailyBackupNaming numbers a day's backups from the start instead.  It
+	// has no effect with GenerationNaming or DailyBackupNaming, and changing
+	// it leaves backups named under the old layout unmanaged; MigrateBackups
+	// renames them.
+	BackupTimeFormat string `json:"BackupTimeFormat" yaml:"BackupTimeFormat"`
+
+	// BackupTimeSeparator, if set, goes between the log file's name and the
+	// timestamp in backup names in place of "-", so that "." with a
+	// BackupTimeFormat of "2006-01-02" gives backups such as
+	// server.2024-06-01.log.  It applies to DailyBackupNaming too, but not to
+	// GenerationNaming, and changing it leaves backups named under the old
+	// separator unmanaged.
+	BackupTimeSeparator string `json:"BackupTimeSeparator" yaml:"BackupTimeSeparator"`
+
 	//日志中的时间格式
+	// LogFileTimeFormat is the layout of the timestamps that start the log
+	// file's lines, which Init reads from an existing file's last line to
+	// tell whether it was last written before today.  If it is empty, and
+	// there is no LastWriteTimeExtractor, Init goes by the file's
+	// modification time instead.
 	LogFileTimeFormat string `json:"LogFileTimeFormat" yaml:"LogFileTimeFormat"`
 
+	// LastWriteTimeExtractor determines when an existing log file was last
+	// written to from its last non-empty line, so that Init can rotate a file
+	// left over from an earlier day.  The default takes the leading run of
+	// digits, spaces, dashes and colons from the line and parses it with
+	// LogFileTimeFormat.  Set it for formats that don't start with a
+	// timestamp, such as JSON or logfmt; NewRegexpTimeExtractor makes one
+	// from a regular expression and a layout, and
+	// LastWriteTimeExtractorFunc one from a function.
+	LastWriteTimeExtractor LastWriteTimeExtractor `json:"-" yaml:"-" toml:"-"`
+
+	// UseModTimeFallback makes Init go by an existing log file's
+	// modification time when no time can be read from its last line, as
+	// with binary logs, lines without timestamps, a last line over 64KB or
+	// an empty file, rather than keep the file without knowing whether it
+	// is from an earlier day.
+	// A file that can't be read at all is still kept.
+	UseModTimeFallback bool `json:"UseModTimeFallback" yaml:"UseModTimeFallback"`
+
+	// LogFileEncoding is the encoding of an existing log file's text, used to
+	// find and decode its last line at Init: EncodingUTF8 (the default),
+	// EncodingUTF16LE or EncodingUTF16BE.  Case doesn't matter.  It doesn't
+	// change how writes are made; those are written as given.
+	LogFileEncoding string `json:"LogFileEncoding" yaml:"LogFileEncoding"`
+
+	// FileMode is the permission bits used for log files Logger creates.  When
+	// zero, a new file copies the mode of the file it replaces, or uses 0600
+	// if there is none.
+	FileMode os.FileMode `json:"FileMode" yaml:"FileMode"`
+
+	// EnforceFileMode makes Logger chmod an existing log file to FileMode when
+	// it reopens it, so that a file created by an earlier run with different
+	// permissions gets normalized.  It has no effect if FileMode is zero.
+	EnforceFileMode bool `json:"EnforceFileMode" yaml:"EnforceFileMode"`
+
+	// DirMode is the permission bits used when creating the log directory.
+	// It defaults to 0755.
+	DirMode os.FileMode `json:"DirMode" yaml:"DirMode"`
+
+	// PreserveOwner determines whether new log files and compressed backups
+	// are given the owner and group of the file they replace.  This only
+	// happens on Linux, and changing the owner usually needs privileges, so
+	// a process that isn't root can set it to false rather than have
+	// rotation and compression fail.  It defaults to true.
+	PreserveOwner *bool `json:"PreserveOwner" yaml:"PreserveOwner"`
+
+	// ArchiveHardlinkDir, if set, is a directory where each backup is
+	// hardlinked as soon as it is made, under the same name, so that it can
+	// be kept for longer than retention here keeps it without copying any
+	// bytes.  Logger never removes or compresses the links, so the archive
+	// needs a retention of its own, such as a Logger or cron job of its own.
+	// Hardlinks only work within one filesystem; if the link can't be made,
+	// as with EXDEV across filesystems, the backup is copied instead.
+	// Failures go to ErrorHandler and don't stop the rotation.
+	ArchiveHardlinkDir string `json:"ArchiveHardlinkDir" yaml:"ArchiveHardlinkDir"`
+
+	// MetricsSink, if set, receives one JSON object per line for every
+	// rotation, compression and removal of a log file, with the keys "type"
+	// (one of EventRotate, EventCompress or EventRemove), "file", "size" and
+	// "time".  Writes are best-effort: failures go to ErrorHandler.  It must
+	// not be the Logger itself.
+	MetricsSink io.Writer `json:"-" yaml:"-" toml:"-"`
+
+	// AuditLog, if set, receives a durable record of every rotation,
+	// compression and removal of a log file, one JSON object per line with
+	// the keys "time", "action" (as the "type" of MetricsSink events),
+	// "file", "size", "sha256" (the file's checksum; for a removal, taken
+	// just before it) and "prev".  prev is the SHA-256 of the previous record's
+	// line, so that altering or dropping a record breaks the chain; it is
+	// empty for a Logger's first record.  Checksums read the whole file, so
+	// they cost as much as the compression does.  It must not be the Logger
+	// itself.
+	AuditLog io.Writer `json:"-" yaml:"-" toml:"-"`
+
+	// CountLinesOnRotate adds a "lines" key to rotation events with the
+	// number of newline-terminated lines in the rotated file, including any
+	// preamble or footer.  Counting reads the whole file while the Logger's
+	// lock is held, delaying writes by the time it takes to read LogMaxSize
+	// bytes, so it is off by default.  It has no effect without MetricsSink.
+	CountLinesOnRotate bool `json:"CountLinesOnRotate" yaml:"CountLinesOnRotate"`
+
+	// ErrorHandler, if set, is called with errors that Logger can't return to
+	// a caller, such as failures in background compression and cleanup.  It
+	// may be called from the mill goroutine.
+	ErrorHandler func(error) `json:"-" yaml:"-" toml:"-"`
+
+	// OnOpenFailure, if set, is called whenever the log file can't be opened
+	// or created, say for a bad path, a full disk or missing permissions, so
+	// that the application doesn't run blind when its logger drops Write
+	// errors.
+	OnOpenFailure func(error) `json:"-" yaml:"-" toml:"-"`
+
+	// OnRotate, if set, is called after each rotation with the log file's
+	// name and the name of the backup it was moved to, including the backup
+	// Init makes of a file left from an earlier day.  It runs on a goroutine
+	// of its own, so a slow callback doesn't hold up writes, and calls for
+	// successive rotations may overlap or run out of order.  A panic in it is
+	// recovered and reported to ErrorHandler.  With Compress, the backup may
+	// already have been compressed, and renamed, by the time it runs;
+	// OnCompress reports that.
+	OnRotate func(oldPath, backupPath string) `json:"-" yaml:"-" toml:"-"`
+
+	// OnCompress, if set, is called when a backup has been compressed, with
+	// the compressed file's name and its size before and after, just before
+	// the uncompressed backup is removed, so the compressed one can be
+	// shipped elsewhere.  It is called synchronously from whatever does the
+	// compressing, usually the mill goroutine but also Init, Prune and
+	// Reconfigure, so a slow callback holds up cleanup, and, in Reconfigure,
+	// which holds the Logger's lock, writes too.  A panic in it is recovered
+	// and reported to ErrorHandler, and neither file is removed because of
+	// it.
+	OnCompress func(compressedPath string, originalSize, compressedSize int64) `json:"-" yaml:"-" toml:"-"`
+
+	// FailOpen makes the first failure to open the log file stick: that
+	// Write and every later one return an error wrapping ErrOpenFailed,
+	// without trying again, until Close.  An application can check for it on
+	// its first write and refuse to start.  By default each Write tries to
+	// open the file again.
+	FailOpen bool `json:"FailOpen" yaml:"FailOpen"`
+
+	// NetworkRetry retries opening and renaming log files, listing backups
+	// and compressing them when they fail because a network mount such as
+	// NFS or SMB has gone away, with ESTALE, EIO or ENOTCONN.  Retries hold
+	// up writes, so keep the total wait short; {Retries: 5, Backoff:
+	// 100ms, MaxBackoff: 2s} rides out a remount of a few seconds.  If the
+	// mount is still gone after that, Write returns the error, or, with
+	// FallbackBufferBytes, holds failed writes to the open file until it
+	// returns.  The default is not to retry.
+	NetworkRetry NetworkRetryPolicy `json:"NetworkRetry" yaml:"NetworkRetry"`
+
+	// MinFreeDiskMB, if positive, is how many megabytes Write leaves free on
+	// the log directory's filesystem, so that a filling disk doesn't cut a
+	// record short.  Before a write the free space is checked, at most once
+	// a second while the writes since leave enough, and if the write would
+	// leave less, the oldest backups are removed, regardless of the other
+	// retention settings and RetentionGracePeriod, until it wouldn't.  If
+	// removing them all isn't enough, Write writes nothing and returns an
+	// error wrapping ErrLowDiskSpace.  Free space can only be found on
+	// Linux; elsewhere this does nothing.  It doesn't apply to
+	// UnlockedAppend writes, which take the lock instead.
+	MinFreeDiskMB int `json:"MinFreeDiskMB" yaml:"MinFreeDiskMB"`
+
+	// FallbackBufferBytes, if positive, is how many bytes Logger holds in
+	// memory when writing to the file fails with a transient error such as
+	// ENOSPC or EIO.  Such writes report success, and the held bytes are
+	// written ahead of the next write once the disk recovers.  The buffer is
+	// lossy: when it is full the oldest bytes are discarded and the count is
+	// reported to ErrorHandler, and anything still held when the process
+	// exits is lost.
+	FallbackBufferBytes int `json:"FallbackBufferBytes" yaml:"FallbackBufferBytes"`
+
+	// FirstFilePreamble, if set, is written at the start of the very first log
+	// file of a series, such as a UTF-8 byte order mark or a schema line.  A
+	// file counts as the first when neither it nor any backups exist yet; the
+	// files created by later rotations don't get the preamble.
+	FirstFilePreamble []byte `json:"FirstFilePreamble" yaml:"FirstFilePreamble"`
+
+	// Footer, if set, is written at the end of a log file just before it is
+	// rotated, such as an end marker for formats that need a closing token.
+	// It is not written to empty files, nor when the Logger is closed, so
+	// the active file never ends with it.  A footer can take a file past
+	// LogMaxSize by its own length.
+	Footer []byte `json:"Footer" yaml:"Footer"`
+
+	// MillBatchSize, if positive, caps how many backups are compressed or
+	// removed in one pass of the background cleanup.  The rest is left to
+	// further passes, which follow at once, so other maintenance isn't held
+	// up behind a large backlog, say after downtime.  The default is no cap.
+	MillBatchSize int `json:"MillBatchSize" yaml:"MillBatchSize"`
+
+	// LazyMill delays starting the background goroutine that compresses and
+	// removes old log files until the first rotation.  By default it starts,
+	// and runs a cleanup pass, on the first write.  This saves work for
+	// short-lived processes that rarely rotate.
+	LazyMill bool `json:"LazyMill" yaml:"LazyMill"`
+
+	// ThinningPolicy reduces old backups to one per calendar day.  Thinning
+	// runs before the other retention rules, so LogMaxSaveQuantity counts the
+	// backups that survive it and LogMaxSaveDay still removes any that are
+	// too old.
+	ThinningPolicy ThinningPolicy `json:"ThinningPolicy" yaml:"ThinningPolicy"`
+
+	// GenerationNaming names backups with an increasing generation number
+	// instead of a timestamp, as in server.000001.log, server.000002.log and
+	// so on, and orders them by that number for retention.  Since the names
+	// hold no time, LogMaxSaveDay and ThinningPolicy go by the backups'
+	// modification times.  The last number used is kept in a hidden file
+	// next to the log file, named .<filename>.generation, so the sequence
+	// continues across restarts; if that file is lost, numbering resumes
+	// after the highest backup on disk.
+	GenerationNaming bool `json:"GenerationNaming" yaml:"GenerationNaming"`
+
+	// DailyBackupNaming names backups by the day they were rotated rather
+	// than the second, as in server-2024-01-15.log, so a day's backups
+	// group together.  Further backups the same day get a counter, as in
+	// server-2024-01-15.1.log, server-2024-01-15.2.log and so on, which
+	// orders them within the day for retention.  LogMaxSaveDay and
+	// ThinningPolicy count a backup's age from the start of its day.  It
+	// can't be combined with GenerationNaming.
+	DailyBackupNaming bool `json:"DailyBackupNaming" yaml:"DailyBackupNaming"`
+
+	// WriteShards, if positive, makes Write copy p into one of that many
+	// buffers and return at once, leaving a single background goroutine to
+	// write the buffers to the file.  This cuts lock contention when many
+	// goroutines write at a high rate.  Each Write still lands in the file
+	// whole, and the writes of any one goroutine keep their order, but how
+	// writes from different goroutines interleave is unspecified.  Since
+	// Write returns before the data reaches the file, errors go to
+	// ErrorHandler, and only Close guarantees buffered writes are written.
+	// WriteAt and WriteWithInfo are not buffered.
+	WriteShards int `json:"WriteShards" yaml:"WriteShards"`
+
+	// UnlockedAppend lets writes of at most 512 bytes run concurrently rather
+	// than one at a time, relying on the operating system to keep each
+	// O_APPEND write whole and in one place, as POSIX does for regular files.
+	// Rotation, reopening and every other change still take the Logger's
+	// lock, and no write runs while they do.  This is an advanced option: it
+	// only pays off with many goroutines writing small records, it doesn't
+	// apply with LogSplitDay, LogSplitHour or ExclusiveLock, whose writes
+	// take the lock file, and such writes bypass the fallback buffer, so
+	// errors are returned as they happen.  Don't use it on filesystems that
+	// don't honor O_APPEND atomically, such as NFS.
+	UnlockedAppend bool `json:"UnlockedAppend" yaml:"UnlockedAppend"`
+
+	// SyncEveryNLines, if positive, syncs the log file to disk after every
+	// SyncEveryNLines newlines written, so a crash loses at most that many
+	// lines without the cost of syncing each write.  Bytes held by
+	// FallbackBufferBytes count once they reach the file.  Sync failures go
+	// to ErrorHandler.  It doesn't apply to UnlockedAppend writes, which
+	// take the lock instead.
+	SyncEveryNLines int `json:"SyncEveryNLines" yaml:"SyncEveryNLines"`
+
+	// BufferSize, if positive, holds writes in a buffer of that many bytes,
+	// so that many small writes cost one write to the file.  The buffer is
+	// written out when it fills, on rotation, on Sync and Close, before a
+	// SyncEveryNLines sync and every FlushInterval, if set.  Buffered bytes
+	// count towards LogMaxSize like written ones, so rotation isn't
+	// delayed, but a crash, or a kill without Close, loses them, and readers
+	// of the file don't see them until they are written out.  A failed
+	// write out loses what the buffer held.  UnlockedAppend doesn't apply
+	// with it.
+	BufferSize int `json:"BufferSize" yaml:"BufferSize"`
+
+	// FlushInterval is the longest BufferSize holds a write before writing
+	// it out.  Zero leaves bytes in the buffer until one of the other
+	// events.  Failures go to ErrorHandler.
+	FlushInterval time.Duration `json:"FlushInterval" yaml:"FlushInterval"`
+
+	// ExclusiveLock takes an advisory lock on a hidden file next to the log
+	// file, named .<filename>.lock, while opening, writing to and rotating
+	// the log file, for when more than one process writes to it, as during
+	// a rolling restart on a shared directory.  Their writes and rotations
+	// then take turns, and a process that finds, once it has the lock, that
+	// another one has rotated the file reopens it and writes to the new file
+	// instead of rotating again.  Each process still tracks the size of its
+	// own writes to the file it has open.  It works on linux, darwin and the
+	// BSDs; elsewhere it goes to ErrorHandler and is ignored.  UnlockedAppend
+	// doesn't apply with it.
+	ExclusiveLock bool `json:"ExclusiveLock" yaml:"ExclusiveLock"`
+
+	// LockTimeout is how long ExclusiveLock waits for the lock before the
+	// write fails with ErrLockTimeout.  It defaults to 10 seconds.
+	LockTimeout time.Duration `json:"LockTimeout" yaml:"LockTimeout"`
+
+	// HealthCheckSizeSlack is how many bytes the size Logger tracks may be
+	// off from the open file's before HealthCheck reports it.  It defaults
+	// to 0, an exact match, which suits a file only this Logger writes;
+	// where other writers append to it too, as with ExclusiveLock, or a
+	// write may be cut short on a failing disk, it should allow for them.
+	HealthCheckSizeSlack int64 `json:"HealthCheckSizeSlack" yaml:"HealthCheckSizeSlack"`
+
+	// HashChain keeps a hash chain of the lines written, so that later
+	// changes to the log file or its backups can be detected with
+	// VerifyHashChain.  The hash of each line is the SHA-256 of the
+	// previous line's hash, or 32 zero bytes for the first line, followed
+	// by the line with its newline.  The hashes are appended, in hex, one
+	// per line, to a hidden file next to the log file named
+	// .<filename>.chain, where each rotation adds a record "- <backup>"
+	// naming the backup that the hashes since the last such record belong
+	// to, so the chain carries on across files and restarts.  A line left
+	// unfinished by a rotation or Close is hashed as it stands, so writes
+	// should end with a newline.  The chain file grows by 65 bytes a line;
+	// when retention removes backups, their hashes are dropped from it,
+	// leaving a record "= <hash>" of the last of them to chain on from, and
+	// a backup it still names that is missing breaks the chain.  It only
+	// shows tampering if the chain file itself is kept out of reach, say by
+	// shipping it elsewhere.  UnlockedAppend doesn't apply with it.
+	HashChain bool `json:"HashChain" yaml:"HashChain"`
+
+	// AllowSharedPath lets Init go ahead when another Logger in the process
+	// already uses the same log file, reporting the clash to ErrorHandler
+	// instead of failing with ErrPathInUse.  Two Loggers writing one file
+	// corrupt each other's rotation, so this is only for cases where the
+	// clash is known to be harmless.  The check only covers Loggers in the
+	// same process.
+	AllowSharedPath bool `json:"AllowSharedPath" yaml:"AllowSharedPath"`
+
+	// BeforeRotate, if set, is called before every rotation with its reason,
+	// and can return false to cancel it, say to keep a transaction that is
+	// being written in one file.  The write that would have rotated the file
+	// then goes into the current one, which can leave it larger than
+	// LogMaxSize or holding more than one day; the next write tries again.
+	// A cancelled Rotate returns nil.  It is called with the Logger's lock
+	// held, so it must not call the Logger's methods.
+	BeforeRotate func(reason RotateReason) (proceed bool) `json:"-" yaml:"-" toml:"-"`
+
 	//统计过了几天：是否到达需要分割日志的时候
 	splitDayCount int
+	//当前时间
+	// nowTime is the time the day boundaries were last worked out from.
+	nowTime time.Time
+	//当天的23时59分时间戳
+	// It is 0 until Init, WriteAt or the first write starts the day.
+	lastTimestamp int64
+	//昨天的23时59分时间戳
+	yesterdayLastTimestamp int64
+	//执行按天分割操作
+	isSplitDay bool
 	//全路径的日志名
 	fullPathFileName string
 
-	size int64
-	file *os.File
-	mu   sync.Mutex
+	file File
+	// mu is held for writing by everything that changes the Logger's state,
+	// and for reading only by UnlockedAppend writes.
+	mu sync.RWMutex
+
+	// rotations counts completed rotations, so a write can tell whether it
+	// caused one.
+	rotations int64
+
+	// buf is the write buffer of BufferSize, and flushTimer the pending
+	// FlushInterval flush, if any.
+	buf        *bufio.Writer
+	flushTimer *time.Timer
+
+	// locked is the ExclusiveLock file while the lock is held, and
+	// lockUnsupported records that locking failed for lack of support.
+	locked          *os.File
+	lockUnsupported bool
+
+	// freeSpace is the free space MinFreeDiskMB last found, less what has
+	// been written since, and freeSpaceAt when it was found, or zero if it
+	// has to be checked anew.
+	freeSpace   uint64
+	freeSpaceAt time.Time
+
+	// chain is the open HashChain file, chainPrev the hash of the last
+	// line and chainLine the hash of the line being written, if any.  They
+	// are guarded by chainMu, which the mill takes without mu to trim the
+	// chain.
+	chainMu   sync.Mutex
+	chain     *os.File
+	chainPrev []byte
+	chainLine hash.Hash
+
+	// writeTime is the time given to the WriteAt call in progress, and
+	// lastWriteAt the time given to the previous one.
+	writeTime   time.Time
+	lastWriteAt time.Time
+
+	// unsyncedLines counts the newlines written since the file was last
+	// synced for SyncEveryNLines.
+	unsyncedLines int
+
+	// midnight is the RotateAtMidnight goroutine.
+	midnight *midnightTimer
+
+	// hourSplitAt is when LogSplitHour next rotates the file, worked out on
+	// the first write to it.
+	hourSplitAt time.Time
+
+	// fallback holds bytes that couldn't be written; see FallbackBufferBytes.
+	fallback []byte
 
 	millCh    chan bool
 	startMill sync.Once
+	// millMu keeps cleanup passes, from the mill goroutine and Prune, from
+	// overlapping, and Reconfigure from changing the settings under one.
+	millMu sync.Mutex
+	// millQueued counts the passes mill has queued that haven't finished,
+	// guarded by millIdleMu; millIdle is signalled when it drops to zero.
+	millQueued int
+	millIdleMu sync.Mutex
+	millIdle   sync.Cond
+
+	shards      *shardedWriter
+	startShards sync.Once
+
+	// percentMax is the size limit worked out for MaxSizePercentFree.
+	percentMax int64
+
+	// auditPrev is the checksum of the last AuditLog record.
+	auditPrev string
+
+	// countersSavedAt is when PersistCounters last saved the counters.
+	countersSavedAt time.Time
+
+	// openErr is the failure FailOpen keeps returning.
+	openErr error
+
+	// registered is the absolute name this Logger holds in the registry.
+	registered string
+
+	// paused and deferredMill are set atomically, since the mill goroutine
+	// reads them without the lock; deferredRotate is the reason for the
+	// first rotation put off by Pause.
+	paused         int32
+	deferredMill   int32
+	deferredRotate RotateReason
+
+	// sinkMu serializes writes to MetricsSink from the writer and the mill.
+	sinkMu sync.Mutex
+}
+
+// RotateReason says why a log file is being rotated.
+type RotateReason int
+
+const (
+	// RotateSize means the next write would take the file past LogMaxSize.
+	RotateSize RotateReason = iota + 1
+	// RotateDay means LogSplitDay days have passed.
+	RotateDay
+	// RotateManual means Rotate was called.
+	RotateManual
+	// RotateHour means LogSplitHour hours have passed.
+	RotateHour
+)
+
+// String returns the reason's name.
+func (r RotateReason) String() string {
+	switch r {
+	case RotateSize:
+		return "size"
+	case RotateDay:
+		return "day"
+	case RotateManual:
+		return "manual"
+	case RotateHour:
+		return "hour"
+	}
+	return fmt.Sprintf("RotateReason(%d)", int(r))
+}
+
+// ThinningPolicy configures how old backups are thinned out.
+type ThinningPolicy struct {
+	// AfterDays is the age in days, based on the timestamp encoded in the
+	// filename, past which only the newest backup of each calendar day is
+	// kept.  Zero disables thinning.
+	AfterDays int `json:"AfterDays" yaml:"AfterDays"`
+}
+
+// RetentionTimeSource says which time a backup's age is measured from.
+type RetentionTimeSource int
+
+const (
+	// EmbeddedTimestamp is the time formatted in the backup's name.
+	EmbeddedTimestamp RetentionTimeSource = iota
+	// ModTime is the backup's modification time.
+	ModTime
+)
+
+// RetentionOrder says whether a cleanup pass applies LogMaxTotalSize before
+// or after compressing backups.
+type RetentionOrder int
+
+const (
+	// RemoveThenCompress removes the backups over LogMaxTotalSize before
+	// compressing the rest, so a backup about to be removed is never
+	// compressed.  The sizes of backups still to be compressed are
+	// estimated from the ratio of the Logger's last compression, and taken
+	// as they are until it has compressed one.
+	RemoveThenCompress RetentionOrder = iota
+	// CompressThenRemove compresses backups first and then removes those
+	// over LogMaxTotalSize by their compressed sizes, which keeps as many as
+	// fit at the cost of compressing some that are removed at once.
+	CompressThenRemove
+)
+
+// shouldCompress reports whether the backup f is due for compression: it
+// isn't compressed yet, and neither too small, by CompressMinSize, nor too
+// recent, by CompressAfterDays.
+func (l *Logger) shouldCompress(f logInfo) bool {
+	if l.IsCompressed(f.Name()) || f.Size() < l.CompressMinSize {
+		return false
+	}
+	if l.CompressAfterDays > 0 {
+		cutoff := l.timeNow().AddDate(0, 0, -l.CompressAfterDays)
+		return !l.retentionTime(f).After(cutoff)
+	}
+	return true
+}
+
+// compressedSize returns the size f is expected to have once this pass is
+// over: its size as compressed, if the pass compresses it.
+func (l *Logger) compressedSize(f logInfo) int64 {
+	if !l.Compress || !l.shouldCompress(f) {
+		return f.Size()
+	}
+	permille := atomic.LoadInt64(&l.compressPermille)
+	if permille <= 0 {
+		return f.Size()
+	}
+	return f.Size() * permille / 1000
+}
+
+// capTotalSize splits files, sorted newest first, into the newest that fit in
+// LogMaxTotalSize beside the log file and the rest, measuring each with size.
+func (l *Logger) capTotalSize(files []logInfo, size func(logInfo) int64) (keep, over []logInfo) {
+	limit := int64(l.LogMaxTotalSize) * int64(megabyte)
+	var total int64
+	if info, err := l.fs().Stat(l.filename()); err == nil {
+		total = info.Size()
+	}
+	for _, f := range files {
+		total += size(f)
+		if total > limit {
+			over = append(over, f)
+		} else {
+			keep = append(keep, f)
+		}
+	}
+	return keep, over
+}
+
+// pastGrace returns the backups in files that RetentionGracePeriod no longer
+// holds back.
+func (l *Logger) pastGrace(files []logInfo) []logInfo {
+	if l.RetentionGracePeriod <= 0 {
+		return files
+	}
+	var expired []logInfo
+	for _, f := range files {
+		if l.timeNow().Sub(f.ModTime()) >= l.RetentionGracePeriod {
+			expired = append(expired, f)
+		}
+	}
+	return expired
+}
+
+// removeBackups removes files, returning the first error, and drops those
+// removed from the HashChain.
+func (l *Logger) removeBackups(files []logInfo) error {
+	var err error
+	removed := false
+	for _, f := range files {
+		fn := filepath.Join(l.dir(), f.Name())
+		sum := l.auditChecksum(fn)
+		errRemove := l.fs().Remove(fn)
+		if err == nil && errRemove != nil {
+			err = errRemove
+		}
+		if errRemove == nil {
+			removed = true
+			atomic.AddInt64(&l.totalRemoved, 1)
+			l.emit(event{Type: EventRemove, File: fn, Size: f.Size(), Time: l.timeNow(), sum: sum})
+		}
+	}
+	if removed {
+		l.chainRemoved()
+	}
+	return err
+}
+
+// retentionTime returns the time f's age is measured from.
+func (l *Logger) retentionTime(f logInfo) time.Time {
+	if l.RetentionTimeSource == ModTime {
+		return f.ModTime()
+	}
+	return f.timestamp
 }
 
 var (
@@ -149,104 +938,453 @@ var (
 	// os_Stat exists so it can be mocked out by tests.
 	osStat = os.Stat
 
+	// osRename exists so it can be mocked out by tests.
+	osRename = os.Rename
+
+	// sleep exists so it can be mocked out by tests.
+	sleep = time.Sleep
+
+	// fileWrite exists so it can be mocked out by tests.
+	fileWrite = File.Write
+
+	// fileSync exists so it can be mocked out by tests.
+	fileSync = File.Sync
+
 	// megabyte is the conversion factor between LogMaxSize and bytes.  It is a
 	// variable so tests can mock it out and not need to write megabytes of data
 	// to disk.
 	megabyte = 1024 * 1024
-
-	//当前时间
-	nowTime time.Time
-	//当前时间戳
-	nowTimestamp int64
-	//当天的23时59分时间戳
-	lastTimestamp int64
-	//昨天的23时59分时间戳
-	yesterdayLastTimestamp int64
-	//执行按天分割操作
-	isSplitDay bool
 )
 
-func (l *Logger) Init() {
-	updateCurrentTimestamp(l.LocalTime)
-	updateLastTimeOfToday(l.LocalTime)
-	updateYesterdayTime(l.LocalTime)
+// Init builds the log file's name from LogPathName, LogFileName and
+// LogFileSuffix and prepares the Logger for writing.  It creates the log
+// directory and checks that it is writable, returning a descriptive error if
+// not, so that permission problems surface at startup rather than on the
+// first write.  If the existing log file was last written before today it is
+// moved aside as a backup; if its last write time can't be read, it is kept
+// and the error goes to ErrorHandler.  Any other failure on the way, including
+// one to compress and remove backups, is returned rather than ending the
+// process; MustInit panics instead.
+func (l *Logger) Init() (err error) {
+	if err := validTimezone(l.Timezone); err != nil {
+		return err
+	}
+	if err := validEncoding(l.LogFileEncoding); err != nil {
+		return err
+	}
+	if err := validDayRollover(l.DayRolloverAt); err != nil {
+		return err
+	}
+	if errs := l.validFileSystem(); len(errs) > 0 {
+		return errs[0]
+	}
+	l.updateDay(l.timeNow())
 	l.fullPathFileName = l.LogPathName + l.LogFileName + l.LogFileSuffix
-	isSplitDay = false
+	if err := l.register(l.filename()); err != nil {
+		return err
+	}
+	// a Logger that failed to start doesn't keep the name.
+	defer func() {
+		if err != nil {
+			l.unregister()
+		}
+	}()
+	l.isSplitDay = false
+	if err := validCompressLevel("CompressLevel", l.CompressLevel); err != nil {
+		return err
+	}
+	if err := validCompressLevel("StartupCompressLevel", l.StartupCompressLevel); err != nil {
+		return err
+	}
+	if err := l.prepareDir(); err != nil {
+		return err
+	}
 	//若日志文件并非当天的，则执行打包命令
-	isExist, err := pathFileExist(l.fullPathFileName)
+	isExist, err := pathFileExist(l.fs(), l.fullPathFileName)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("can't stat log file: %w", err)
 	}
 	if isExist {
 		//获取日志更新时间
-		logFileUpdateTime := getLogFileUpdateTime(l.fullPathFileName)
+		logFileUpdateTime, err := l.getLogFileUpdateTime(l.fullPathFileName, l.lastWriteTimeExtractor())
+		// a file that can't be read just now is kept as the log file; the
+		// error goes to ErrorHandler.
+		if err != nil && err != errNoTimestamp {
+			l.handleError(fmt.Errorf("can't determine last write time of log file, skipping startup compression: %w", err))
+		}
 		//仅当日志文件的最后一条记录时间 <= 昨天23:29:59，才执行文件压缩
-		if len(logFileUpdateTime) > 0 && l.strTime2TimeStamp(logFileUpdateTime) <= yesterdayLastTimestamp {
+		if err == nil && logFileUpdateTime.Unix() <= l.yesterdayLastTimestamp {
 			//改名字
-			newLogFileName := l.changeFileNameByTime(logFileUpdateTime)
-			//启动时，处理需要上次推出程序未压缩的日志文件
-			_ = l.compressFiles(newLogFileName)
-			//启动时处理文件：压缩、删除
-			_ = l.millRunOnce()
+			newLogFileName, err := l.changeFileNameByTime(logFileUpdateTime)
+			if err != nil {
+				return err
+			}
+			if l.StartupCompressAsync {
+				l.mill()
+			} else {
+				//启动时，处理需要上次推出程序未压缩的日志文件
+				err = l.compressFiles(newLogFileName)
+				//启动时处理文件：压缩、删除
+				if errMill := l.millRunOnceWith(l.startupCompressor); err == nil {
+					err = errMill
+				}
+				if err != nil {
+					return fmt.Errorf("can't process backups at startup: %w", err)
+				}
+			}
 		}
 	}
+	l.restoreCounters()
+	l.startMidnightTimer()
+	return nil
+}
+
+// MustInit is like Init but panics if Init fails.
+func (l *Logger) MustInit() {
+	if err := l.Init(); err != nil {
+		panic(err)
+	}
+}
+
+// probeSeq numbers the probe files of prepareDir, so that no two in a process
+// share a name.
+var probeSeq int64
+
+// prepareDir creates the log directory if needed and checks that files can be
+// created in it by creating and removing a probe file.
+func (l *Logger) prepareDir() error {
+	dir := l.dir()
+	if err := l.fs().MkdirAll(dir, l.dirMode()); err != nil {
+		return fmt.Errorf("can't make directories for logfile: %w", err)
+	}
+	probe := fmt.Sprintf(".%s.probe%d-%d", filepath.Base(l.filename()), os.Getpid(), atomic.AddInt64(&probeSeq, 1))
+	name := filepath.Join(dir, probe)
+	f, err := l.fs().OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("can't write to log directory %s: %w", dir, err)
+	}
+	f.Close()
+	return l.fs().Remove(name)
 }
 
 // Write implements io.Writer.  If a write would cause the log file to be larger
 // than LogMaxSize, the file is closed, renamed to include a timestamp of the
 // current time, and a new log file is created using the original log file name.
 // If the length of the write is greater than LogMaxSize, an error is returned.
+// A write of no bytes returns at once: it never opens, creates or rotates a
+// file.
 func (l *Logger) Write(p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if l.WriteShards > 0 {
+		return l.shardedWrite(p)
+	}
+	if l.UnlockedAppend {
+		if n, ok, err := l.unlockedAppend(p); ok {
+			return n, err
+		}
+	}
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	n, _, err = l.write(p)
+	return n, err
+}
+
+// WriteAt is like Write, but uses t rather than the current time to decide
+// whether the day has changed and to name the backup if the write rotates the
+// file, so that replaying the same writes produces the same files.  The first
+// call to WriteAt starts the current day at t.  Times must not go backwards
+// from one call to the next; if t is before the previous call's time, WriteAt
+// writes nothing and returns an error.  Removal of old backups still uses the
+// current time.
+func (l *Logger) WriteAt(t time.Time, p []byte) (n int, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if t.Before(l.lastWriteAt) {
+		return 0, fmt.Errorf("write time %v is before the previous write time %v", t, l.lastWriteAt)
+	}
+	if l.lastWriteAt.IsZero() {
+		l.updateDay(t)
+	}
+	l.lastWriteAt = t
+	l.writeTime = t
+	defer func() {
+		l.writeTime = time.Time{}
+	}()
+
+	n, _, err = l.write(p)
+	return n, err
+}
+
+// now returns the time of the current write: the time given to WriteAt, or
+// else the current time.  It assumes l.mu is held.
+func (l *Logger) now() time.Time {
+	if !l.writeTime.IsZero() {
+		return l.writeTime
+	}
+	return l.timeNow()
+}
+
+// WriteWithInfo is like Write, but also reports whether the write caused the
+// log file to be rotated before p was written.
+func (l *Logger) WriteWithInfo(p []byte) (n int, rotated bool, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.write(p)
+}
+
+// write performs a Write.  It assumes l.mu is held.
+func (l *Logger) write(p []byte) (n int, rotated bool, err error) {
+	return l.writeRecord(p, false)
+}
+
+// writeRecord writes p to the file, rotating first if it doesn't fit.  If
+// oversize is set, a p longer than the maximum file size is written whole to
+// a file of its own rather than refused.  It assumes l.mu is held.
+func (l *Logger) writeRecord(p []byte, oversize bool) (n int, rotated bool, err error) {
+	if len(p) == 0 {
+		return 0, false, nil
+	}
+	rotations := l.rotations
+	defer func() {
+		rotated = l.rotations != rotations
+	}()
+
 	writeLen := int64(len(p))
-	if writeLen > l.max() {
-		return 0, fmt.Errorf(
+	if writeLen > l.max() && !oversize {
+		return 0, false, fmt.Errorf(
 			"write length %d exceeds maximum file size %d", writeLen, l.max(),
 		)
 	}
 
+	if l.openErr != nil {
+		return 0, false, l.openErr
+	}
+	// with ExclusiveLock, the write, and any rotation it makes, is under the
+	// lock, and goes to the file that now has the log file's name.
+	unlock, err := l.lock()
+	if err != nil {
+		return 0, false, err
+	}
+	defer unlock()
+	if l.rotatedElsewhere() {
+		if err := l.close(); err != nil {
+			return 0, false, err
+		}
+	}
 	if l.file == nil {
-		if err = l.openExistingOrNew(len(p)); err != nil {
-			return 0, err
+		if err = l.openExistingOrNew(); err != nil {
+			return 0, false, l.openFailed(err)
 		}
 	}
 
+	if err := l.splitDay(); err != nil {
+		return 0, false, err
+	}
+
+	if l.LogSplitHour > 0 {
+		if l.hourSplitAt.IsZero() {
+			l.hourSplitAt = l.nextHourSplit(l.now())
+		}
+		if !l.now().Before(l.hourSplitAt) {
+			if err := l.rotate(RotateHour); err != nil {
+				return 0, false, err
+			}
+		}
+	}
+
+	//超过单个文件大小：压缩该文件
+	// an empty file only gets here with an oversize record, which it takes
+	// whole.
+	if l.size > 0 && l.size+writeLen > l.max() {
+		if err := l.rotate(RotateSize); err != nil {
+			return 0, false, err
+		}
+	}
+
+	if err := l.ensureFreeSpace(writeLen); err != nil {
+		return 0, false, err
+	}
+
+	n, err = l.writeFile(p)
+	if l.PersistCounters && !l.timeNow().Before(l.countersSavedAt.Add(persistCountersInterval)) {
+		l.persistCounters()
+	}
+	return n, false, err
+}
+
+// splitDay rotates the file if the day has changed and LogSplitDay days have
+// passed.  It assumes l.mu is held.
+func (l *Logger) splitDay() error {
 	//按天分割日志
-	if l.LogSplitDay > 0 && isNextDay(l.LocalTime) {
-		updateLastTimeOfToday(l.LocalTime)
-		updateYesterdayTime(l.LocalTime)
+	if l.LogSplitDay > 0 && l.lastTimestamp == 0 {
+		// a Logger that wasn't Init'd starts its day at its first write.
+		l.updateDay(l.now())
+		return nil
+	}
+	if l.LogSplitDay > 0 && l.isNextDay(l.now()) {
+		l.updateDay(l.now())
 		l.splitDayCount++
 		//是否达到分割要求
 		if l.LogSplitDay <= l.splitDayCount {
 			l.splitDayCount = 0
-			isSplitDay = true
-			if err := l.rotate(); err != nil {
+			l.isSplitDay = true
+			defer func() {
+				l.isSplitDay = false
+			}()
+			return l.rotate(RotateDay)
+		}
+	}
+	return nil
+}
+
+// writeFile writes p to the current file.  If FallbackBufferBytes is set and
+// the write fails with a transient error, the unwritten bytes are kept in
+// memory and written ahead of the next write, and the write is reported as
+// successful.
+func (l *Logger) writeFile(p []byte) (int, error) {
+	if len(l.fallback) > 0 {
+		if err := l.flushFallback(); err != nil {
+			if l.FallbackBufferBytes <= 0 || !isTransient(err) {
 				return 0, err
 			}
+			l.bufferFallback(p)
+			return len(p), nil
 		}
-		isSplitDay = false
 	}
+	n, err := l.writeOut(p)
+	l.size += int64(n)
+	l.hashLines(p[:n])
+	l.countSyncLines(p[:n])
+	if err != nil && l.FallbackBufferBytes > 0 && isTransient(err) {
+		l.bufferFallback(p[n:])
+		return len(p), nil
+	}
+	return n, err
+}
 
-	//超过单个文件大小：压缩该文件
-	if l.size+writeLen > l.max() {
-		if err := l.rotate(); err != nil {
-			return 0, err
+// writeAll writes all of p to f, writing again whatever a short write
+// leaves until it is written or a write fails, as io.Writer requires.  A
+// write that makes no progress and reports no error fails with
+// io.ErrShortWrite.  The bytes written count towards Stats.
+func (l *Logger) writeAll(f File, p []byte) (n int, err error) {
+	defer func() {
+		atomic.AddInt64(&l.totalBytes, int64(n))
+	}()
+	for n < len(p) {
+		var m int
+		m, err = fileWrite(f, p[n:])
+		n += m
+		if err != nil {
+			return n, err
+		}
+		if m == 0 {
+			return n, io.ErrShortWrite
 		}
 	}
+	return n, nil
+}
 
-	n, err = l.file.Write(p)
+// flushFallback writes out bytes held by the fallback buffer.
+func (l *Logger) flushFallback() error {
+	n, err := l.writeAll(l.file, l.fallback)
 	l.size += int64(n)
+	l.hashLines(l.fallback[:n])
+	l.countSyncLines(l.fallback[:n])
+	l.fallback = l.fallback[n:]
+	if len(l.fallback) == 0 {
+		l.fallback = nil
+	}
+	return err
+}
 
-	return n, err
+// countSyncLines counts the newlines in b, just written, and syncs the file
+// once SyncEveryNLines have been written.
+func (l *Logger) countSyncLines(b []byte) {
+	if l.SyncEveryNLines <= 0 {
+		return
+	}
+	l.unsyncedLines += bytes.Count(b, []byte{'\n'})
+	if l.unsyncedLines < l.SyncEveryNLines {
+		return
+	}
+	l.unsyncedLines = 0
+	if err := l.flushBuffer(); err != nil {
+		l.handleError(err)
+	}
+	if err := fileSync(l.file); err != nil {
+		l.handleError(fmt.Errorf("can't sync log file: %w", err))
+	}
 }
 
-// Close implements io.Closer, and closes the current logfile.
+// bufferFallback adds p to the fallback buffer, discarding the oldest bytes
+// if it would grow past FallbackBufferBytes.
+func (l *Logger) bufferFallback(p []byte) {
+	l.fallback = append(l.fallback, p...)
+	if over := len(l.fallback) - l.FallbackBufferBytes; over > 0 {
+		l.fallback = append([]byte(nil), l.fallback[over:]...)
+		l.handleError(fmt.Errorf("fallback buffer full, discarded %d bytes", over))
+	}
+}
+
+// isTransient reports whether a write error may go away by itself, such as a
+// full or briefly failing disk.
+func isTransient(err error) bool {
+	return errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EIO)
+}
+
+// Close implements io.Closer, and closes the current logfile.  With
+// WriteShards or BufferSize, buffered writes are written first.  Close also
+// gives up the log file's name, so another Logger can be initialized with
+// it.  It doesn't wait for the cleanup of old log files running in the
+// background; see CloseContext.
 func (l *Logger) Close() error {
+	if l.WriteShards > 0 {
+		l.flushShards()
+	}
+	l.stopMidnightTimer()
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	return l.close()
+	l.persistCounters()
+	l.unregister()
+	l.openErr = nil
+	err := l.close()
+	l.closeChain()
+	return err
+}
+
+// Sync writes out whatever Logger holds in memory, from BufferSize,
+// FallbackBufferBytes and WriteShards, and then commits the log file to
+// stable storage, so that a caller can make sure what it logged survives a
+// crash.  With Write, this makes Logger a zapcore.WriteSyncer for
+// go.uber.org/zap.  It does nothing if no file is open.
+func (l *Logger) Sync() error {
+	if l.WriteShards > 0 {
+		l.flushShards()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	if len(l.fallback) > 0 {
+		if err := l.flushFallback(); err != nil {
+			return fmt.Errorf("can't write fallback buffer: %w", err)
+		}
+	}
+	if err := l.flushBuffer(); err != nil {
+		return err
+	}
+	l.unsyncedLines = 0
+	if err := fileSync(l.file); err != nil {
+		return fmt.Errorf("can't sync log file: %w", err)
+	}
+	return nil
 }
 
 // close closes the file if it is open.
@@ -254,122 +1392,550 @@ func (l *Logger) close() error {
 	if l.file == nil {
 		return nil
 	}
-	err := l.file.Close()
-	l.file = nil
-	return err
+	if len(l.fallback) > 0 {
+		if err := l.flushFallback(); err != nil {
+			l.handleError(fmt.Errorf("discarded %d buffered bytes: %s", len(l.fallback), err))
+			l.fallback = nil
+		}
+	}
+	err := l.flushBuffer()
+	if errClose := l.file.Close(); err == nil {
+		err = errClose
+	}
+	l.file = nil
+	return err
+}
+
+// Rotate causes Logger to close the existing log file and immediately create a
+// new one.  This is a helper function for applications that want to initiate
+// rotations outside of the normal rotation rules, such as in response to
+// SIGHUP.  After rotating, this initiates compression and removal of old log
+// files according to the configuration.  When an external tool rotates the
+// logs, use Reopen instead.
+func (l *Logger) Rotate() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rotate(RotateManual)
+}
+
+// Reopen closes the log file and opens whatever file is at its name again,
+// creating it if there is none, without renaming, compressing or removing
+// anything.  It is for when an external tool such as logrotate rotates the
+// logs, renaming the file out from under Logger and signalling the process,
+// typically with SIGHUP, to start a new one; Rotate is for when Logger does
+// the rotating itself, and the two shouldn't be mixed on the same files.
+// Size-based rotation and LogSplitDay still apply to the reopened file, so
+// they are best left off.  HashChain doesn't record external rotations, so
+// VerifyHashChain can't follow them.
+func (l *Logger) Reopen() error {
+	if l.WriteShards > 0 {
+		l.flushShards()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.close(); err != nil {
+		return err
+	}
+	return l.openCurrent()
+}
+
+// openCurrent opens the log file for appending, creating it if it doesn't
+// exist, without moving anything aside.  It assumes l.mu is held.
+func (l *Logger) openCurrent() error {
+	if err := l.fs().MkdirAll(l.dir(), l.dirMode()); err != nil {
+		return fmt.Errorf("can't make directories for logfile: %w", err)
+	}
+	f, err := l.fs().OpenFile(l.filename(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, l.fileMode())
+	if err != nil {
+		return fmt.Errorf("can't open logfile: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("error getting log file info: %w", err)
+	}
+	l.file = f
+	l.size = info.Size()
+	l.hourSplitAt = time.Time{}
+	l.unsyncedLines = 0
+	l.updatePercentMax()
+	l.writeMarker()
+	l.writeSymlink()
+	return nil
+}
+
+// Prune compresses and removes backups according to the configuration, as
+// happens after each rotation, and waits for it to finish.  This suits
+// programs that rarely rotate, at shutdown or on a timer.  While paused, it
+// is held back until Resume like any other cleanup.
+func (l *Logger) Prune() error {
+	if l.isPaused() {
+		atomic.StoreInt32(&l.deferredMill, 1)
+		return nil
+	}
+	return l.millRunOnce()
+}
+
+// HealthCheck verifies that writes are landing in the expected file.  It
+// checks that the open file still refers to the logfile's name (catching an
+// external rename or delete), that the log directory is writable, and that the
+// size Logger tracks for rotation matches the size of the open file, to
+// within HealthCheckSizeSlack.  It
+// returns nil if no file has been opened yet.  HealthCheck does not modify the
+// file or the directory.
+func (l *Logger) HealthCheck() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	openInfo, err := l.file.Stat()
+	if err != nil {
+		return fmt.Errorf("can't stat open log file: %s", err)
+	}
+	name := l.filename()
+	info, err := l.fs().Stat(name)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("log file %s no longer exists", name)
+	}
+	if err != nil {
+		return fmt.Errorf("error getting log file info: %s", err)
+	}
+	if !sameFile(openInfo, info) {
+		return fmt.Errorf("open log file no longer refers to %s", name)
+	}
+	if l.FileSystem == nil {
+		if err := dirWritable(l.dir()); err != nil {
+			return fmt.Errorf("log directory %s is not writable: %s", l.dir(), err)
+		}
+	}
+	size := l.size - l.buffered()
+	if diff := openInfo.Size() - size; diff > l.HealthCheckSizeSlack || -diff > l.HealthCheckSizeSlack {
+		return fmt.Errorf("tracked size %d does not match on-disk size %d", size, openInfo.Size())
+	}
+	return nil
+}
+
+// ResyncSize sets the size Logger tracks for rotation to the size of the log
+// file on disk, as HealthCheck compares them.  It is a manual escape hatch for
+// when another process has appended to or truncated the active file, which
+// isn't supported but happens, leaving rotation to go by the wrong size.  It
+// does nothing if no file is open.
+func (l *Logger) ResyncSize() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	info, err := l.fs().Stat(l.filename())
+	if err != nil {
+		return fmt.Errorf("error getting log file info: %s", err)
+	}
+	l.size = info.Size() + l.buffered()
+	return nil
+}
+
+// Position returns the name of the active log file and the offset in it at
+// which the next write will land, so that a consumer reading the file can
+// checkpoint how far it has got.  The offset counts everything Logger has
+// written to the file, including any preamble, but not bytes still held by
+// the fallback buffer.  With BufferSize, it includes bytes not yet written
+// out.  If no file has been opened yet the offset is zero.
+//
+// The name is always Logger's own filename, so a checkpoint taken before a
+// rotation refers to a file that has since been renamed: if the active file
+// is now shorter than the checkpointed offset, or is no longer the same file,
+// resume from the offset in the newest backup and then continue with the
+// active file from the start.
+func (l *Logger) Position() (file string, offset int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return l.filename(), 0
+	}
+	return l.filename(), l.size
+}
+
+// TargetFile reports, without writing anything, the file the next write of
+// writeLen bytes would land in and whether that write would first rotate the
+// file, going by the current size, time and configuration.  Since the active
+// file keeps its name across rotations, path is always Logger's filename; when
+// willRotate is true, the current contents will have moved to a backup by the
+// time the write lands.  A write longer than LogMaxSize fails instead, which
+// is reported as no rotation.  BeforeRotate is not consulted.
+func (l *Logger) TargetFile(writeLen int) (path string, willRotate bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	name := l.filename()
+	n := int64(writeLen)
+	if n > l.max() {
+		return name, false
+	}
+	size := l.size
+	if l.file == nil {
+		info, err := l.fs().Stat(name)
+		if err != nil {
+			return name, false
+		}
+		size = info.Size()
+	} else if l.LogSplitDay > 0 && l.lastTimestamp != 0 && l.isNextDay(l.now()) && l.LogSplitDay <= l.splitDayCount+1 {
+		return name, true
+	} else if l.LogSplitHour > 0 && !l.hourSplitAt.IsZero() && !l.now().Before(l.hourSplitAt) {
+		return name, true
+	}
+	return name, size+n > l.max()
+}
+
+// rotate closes the current file, moves it aside with a timestamp in the name,
+// (if it exists), opens a new file with the original filename, and then runs
+// post-rotation processing and removal.  If BeforeRotate vetoes the rotation,
+// it keeps the current file, reopening it if it was closed, and so does a
+// rotation while paused, which is put off until Resume.
+func (l *Logger) rotate(reason RotateReason) error {
+	if l.isPaused() {
+		if l.deferredRotate == 0 {
+			l.deferredRotate = reason
+		}
+		if l.file == nil {
+			return l.reopenCurrent()
+		}
+		return nil
+	}
+	if l.BeforeRotate != nil && !l.BeforeRotate(reason) {
+		if l.file == nil {
+			return l.reopenCurrent()
+		}
+		return nil
+	}
+	unlock, err := l.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if l.rotatedElsewhere() {
+		// append to the file the other process made rather than rotate
+		// that one too.
+		if err := l.close(); err != nil {
+			return err
+		}
+		return l.openExistingOrNew()
+	}
+	if err := l.writeFooter(); err != nil {
+		return err
+	}
+	if err := l.close(); err != nil {
+		return err
+	}
+	if err := l.openNew(); err != nil {
+		if !isReadOnly(err) {
+			return l.openFailed(err)
+		}
+		// The directory can't be written to right now.  Rather than leave
+		// nothing to write to, keep appending to the file we already have.
+		if l.reopenCurrent() != nil {
+			return l.openFailed(err)
+		}
+		l.handleError(fmt.Errorf("continuing with the current log file: %s", err))
+		return nil
+	}
+	l.rotations++
+	l.persistCounters()
+	l.mill()
+	return nil
+}
+
+// writeFooter writes the Footer to the open file, unless it is empty.
+func (l *Logger) writeFooter() error {
+	if len(l.Footer) == 0 || l.file == nil || l.size == 0 {
+		return nil
+	}
+	n, err := l.writeOut(l.Footer)
+	l.size += int64(n)
+	l.hashLines(l.Footer[:n])
+	if err != nil {
+		return fmt.Errorf("can't write footer to logfile: %w", err)
+	}
+	return nil
 }
 
-// Rotate causes Logger to close the existing log file and immediately create a
-// new one.  This is a helper function for applications that want to initiate
-// rotations outside of the normal rotation rules, such as in response to
-// SIGHUP.  After rotating, this initiates compression and removal of old log
-// files according to the configuration.
-func (l *Logger) Rotate() error {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	return l.rotate()
+// isReadOnly reports whether err means the filesystem refused a modification,
+// either because it is mounted read-only or because of permissions.
+func isReadOnly(err error) bool {
+	return errors.Is(err, syscall.EROFS) || errors.Is(err, os.ErrPermission)
 }
 
-// rotate closes the current file, moves it aside with a timestamp in the name,
-// (if it exists), opens a new file with the original filename, and then runs
-// post-rotation processing and removal.
-func (l *Logger) rotate() error {
-	if err := l.close(); err != nil {
+// reopenCurrent reopens the existing logfile for appending, without rotating
+// it.
+func (l *Logger) reopenCurrent() error {
+	name := l.filename()
+	info, err := l.fs().Stat(name)
+	if err != nil {
 		return err
 	}
-	if err := l.openNew(); err != nil {
+	f, err := l.fs().OpenFile(name, os.O_APPEND|os.O_WRONLY, l.fileMode())
+	if err != nil {
 		return err
 	}
-	l.mill()
+	l.file = f
+	l.size = info.Size()
 	return nil
 }
 
 // openNew opens a new log file for writing, moving any old log file out of the
 // way.  This methods assumes the file has already been closed.
 func (l *Logger) openNew() error {
-	err := os.MkdirAll(l.dir(), 0755)
+	return l.retryNetwork(l.openNewOnce)
+}
+
+// openNewOnce makes one attempt at openNew.
+func (l *Logger) openNewOnce() error {
+	err := l.fs().MkdirAll(l.dir(), l.dirMode())
 	if err != nil {
-		return fmt.Errorf("can't make directories for new logfile: %s", err)
+		return fmt.Errorf("can't make directories for new logfile: %w", err)
 	}
 
 	name := l.filename()
-	mode := os.FileMode(0600)
-	info, err := osStat(name)
+	mode := l.fileMode()
+	info, err := l.fs().Stat(name)
+	first := false
+	if os.IsNotExist(err) && len(l.FirstFilePreamble) > 0 {
+		backups, errBackups := l.oldLogFiles()
+		first = errBackups == nil && len(backups) == 0
+	}
 	if err == nil {
-		// Copy the mode off the old logfile.
-		mode = info.Mode()
+		// Copy the mode off the old logfile, unless one is configured.
+		if l.FileMode == 0 {
+			mode = info.Mode()
+		}
 		// move the existing file
-		newname := backupName(name, l.LocalTime)
-		if err := os.Rename(name, newname); err != nil {
-			return fmt.Errorf("can't rename log file: %s", err)
+		newname, err := l.newBackupName(name)
+		if err != nil {
+			return err
 		}
+		if err := l.fs().Rename(name, newname); err != nil {
+			return fmt.Errorf("can't rename log file: %w", err)
+		}
+		l.emitRotate(newname, info.Size())
+		l.archive(newname)
+		l.chainRotated(newname)
+		l.notifyRotate(name, newname)
 
 		// this is a no-op anywhere but linux
-		if err := chown(name, info); err != nil {
-			return err
+		if l.preserveOwner() {
+			if err := chown(name, info); err != nil {
+				return err
+			}
 		}
 	}
 
 	// we use truncate here because this should only get called when we've moved
 	// the file ourselves. if someone else creates the file in the meantime,
 	// just wipe out the contents.
-	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	// other writers, in this process or others, append too.
+	if l.UnlockedAppend || l.ExclusiveLock {
+		flag |= os.O_APPEND
+	}
+	f, err := l.fs().OpenFile(name, flag, mode)
 	if err != nil {
-		return fmt.Errorf("can't open new logfile: %s", err)
+		return fmt.Errorf("can't open new logfile: %w", err)
 	}
 	l.file = f
 	l.size = 0
+	l.hourSplitAt = time.Time{}
+	l.unsyncedLines = 0
+	l.updatePercentMax()
+	l.writeMarker()
+	l.writeSymlink()
+	if first {
+		n, err := l.writeAll(f, l.FirstFilePreamble)
+		l.size = int64(n)
+		l.hashLines(l.FirstFilePreamble[:n])
+		if err != nil {
+			return fmt.Errorf("can't write preamble to new logfile: %w", err)
+		}
+	}
 	return nil
 }
 
+// newBackupName returns the name to move the logfile name to when rotating
+// it now.
+func (l *Logger) newBackupName(name string) (string, error) {
+	if l.DailyBackupNaming {
+		return l.dailyName(name, l.now())
+	}
+	if !l.GenerationNaming {
+		return l.uniqueBackupName(l.backupName(name, l.now())), nil
+	}
+	gen, err := l.nextGeneration()
+	if err != nil {
+		return "", err
+	}
+	return l.generationName(name, gen), nil
+}
+
+// generationName creates a new filename from the given name, inserting the
+// generation number between the filename and the extension.
+func (l *Logger) generationName(name string, gen int64) string {
+	dir := filepath.Dir(name)
+	filename := filepath.Base(name)
+	ext := filepath.Ext(filename)
+	prefix := filename[:len(filename)-len(ext)]
+	if l.BackupFileSuffix != "" {
+		ext = l.BackupFileSuffix
+	}
+	return filepath.Join(dir, fmt.Sprintf("%s.%06d%s", prefix, gen, ext))
+}
+
+// generationFile returns the name of the file that records the last
+// generation used.
+func (l *Logger) generationFile() string {
+	return filepath.Join(l.dir(), "."+filepath.Base(l.filename())+".generation")
+}
+
+// nextGeneration reserves and returns the next generation number.  The
+// number is recorded before it is used, so a failed rotation leaves a gap
+// rather than a reused number.
+func (l *Logger) nextGeneration() (int64, error) {
+	sidecar := l.generationFile()
+	var last int64
+	b, err := ioutil.ReadFile(sidecar)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, fmt.Errorf("can't read generation file: %s", err)
+	}
+	if err == nil {
+		last, _ = strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	}
+	// never reuse a number already on disk, in case the record was lost.
+	if files, err := l.oldLogFiles(); err == nil && len(files) > 0 && files[0].generation > last {
+		last = files[0].generation
+	}
+	next := last + 1
+
+	tmp := sidecar + l.tempSuffix()
+	if err := ioutil.WriteFile(tmp, []byte(strconv.FormatInt(next, 10)+"\n"), l.fileMode()); err != nil {
+		return 0, fmt.Errorf("can't write generation file: %w", err)
+	}
+	if err := osRename(tmp, sidecar); err != nil {
+		os.Remove(tmp)
+		return 0, fmt.Errorf("can't write generation file: %w", err)
+	}
+	return next, nil
+}
+
 // backupName creates a new filename from the given name, inserting a timestamp
-// between the filename and the extension, using the local time if requested
-// (otherwise UTC).
-func backupName(name string, local bool) string {
+// for t between the filename and the extension, in the Logger's time zone.
+// The extension is BackupFileSuffix if set.
+func (l *Logger) backupName(name string, t time.Time) string {
 	var timestamp string
 	dir := filepath.Dir(name)
 	filename := filepath.Base(name)
 	ext := filepath.Ext(filename)
 	prefix := filename[:len(filename)-len(ext)]
-	t := currentTime()
-	if !local {
-		t = t.UTC()
+	if l.BackupFileSuffix != "" {
+		ext = l.BackupFileSuffix
 	}
-	if isSplitDay {
-		timestamp = time.Unix(yesterdayLastTimestamp, 0).Format(backupTimeFormat)
+	t = t.In(l.location())
+	if l.isSplitDay {
+		timestamp = time.Unix(l.yesterdayLastTimestamp, 0).In(l.location()).Format(l.backupTimeFormat())
 	} else {
-		timestamp = t.Format(backupTimeFormat)
+		timestamp = t.Format(l.backupTimeFormat())
 	}
-	return filepath.Join(dir, fmt.Sprintf("%s-%s%s", prefix, timestamp, ext))
+	return filepath.Join(dir, prefix+l.backupTimeSeparator()+timestamp+ext)
 }
 
-// openExistingOrNew opens the logfile if it exists and if the current write
-// would not put it over LogMaxSize.  If there is no such file or the write would
-// put it over the LogMaxSize, a new file is created.
-func (l *Logger) openExistingOrNew(writeLen int) error {
-	l.mill()
+// backupTimeSeparator returns what goes between the log file's name and the
+// timestamp in backup names.
+func (l *Logger) backupTimeSeparator() string {
+	if l.BackupTimeSeparator != "" {
+		return l.BackupTimeSeparator
+	}
+	return "-"
+}
+
+// uniqueBackupName returns the backup name, or, if a backup by that name
+// already exists, as it does when two rotations fall in the same second, the
+// name with the lowest counter after its timestamp, prefix-<timestamp>-<n>ext,
+// that no backup has, so that the rename doesn't replace it.  With Compress
+// on, a name is also taken if its compressed backup exists, which compressing
+// the new backup would otherwise overwrite; with it off, a compressed backup
+// by the name doesn't count, since it may be left by a compression cut short,
+// which compressing the new backup finishes.
+func (l *Logger) uniqueBackupName(name string) string {
+	_, ext := l.prefixAndExt()
+	cext := l.compressedExt(ext, l.compressor())
+	stem := strings.TrimSuffix(name, ext)
+	for n := 1; ; n++ {
+		if !l.backupNameTaken(name, ext, cext) {
+			return name
+		}
+		name = stem + "-" + strconv.Itoa(n) + ext
+	}
+}
+
+// backupNameTaken reports whether name, or with Compress on its compressed
+// backup, the name with ext replaced by cext, exists.
+func (l *Logger) backupNameTaken(name, ext, cext string) bool {
+	if _, err := l.fs().Lstat(name); err == nil {
+		return true
+	}
+	if !l.Compress {
+		return false
+	}
+	_, err := l.fs().Lstat(strings.TrimSuffix(name, ext) + cext)
+	return err == nil
+}
+
+// openExistingOrNew opens the logfile if it exists, or else creates a new one.
+// If the current write would put an existing file over LogMaxSize, write
+// rotates it once it is open, asking BeforeRotate just as it would for a file
+// it had open all along.
+func (l *Logger) openExistingOrNew() error {
+	if !l.LazyMill {
+		l.mill()
+	}
+	unlock, err := l.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	filename := l.filename()
-	info, err := osStat(filename)
+	var info os.FileInfo
+	err = l.retryNetwork(func() (err error) {
+		info, err = l.fs().Stat(filename)
+		return err
+	})
 	if os.IsNotExist(err) {
 		return l.openNew()
 	}
 	if err != nil {
-		return fmt.Errorf("error getting log file info: %s", err)
+		return fmt.Errorf("error getting log file info: %w", err)
 	}
 
-	if info.Size()+int64(writeLen) >= l.max() {
-		return l.rotate()
-	}
-
-	file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0644)
+	file, err := l.fs().OpenFile(filename, os.O_APPEND|os.O_WRONLY, l.fileMode())
 	if err != nil {
 		// if we fail to open the old log file for some reason, just ignore
 		// it and open a new log file.
 		return l.openNew()
 	}
+	if l.EnforceFileMode && l.FileMode != 0 && info.Mode().Perm() != l.FileMode.Perm() {
+		if err := chmodFile(file, l.FileMode); err != nil {
+			file.Close()
+			return fmt.Errorf("can't set log file mode: %s", err)
+		}
+	}
 	l.file = file
 	l.size = info.Size()
+	l.hourSplitAt = time.Time{}
+	l.unsyncedLines = 0
+	l.updatePercentMax()
+	l.writeMarker()
+	l.writeSymlink()
 	return nil
 }
 
@@ -387,7 +1953,18 @@ func (l *Logger) filename() string {
 // files are removed, keeping at most l.LogMaxSaveQuantity files, as long as
 // none of them are older than LogMaxSaveDay.
 func (l *Logger) millRunOnce() error {
-	if l.LogMaxSaveQuantity == 0 && l.LogMaxSaveDay == 0 && !l.Compress {
+	return l.millRunOnceWith(l.compressor)
+}
+
+// millRunOnceWith is millRunOnce, compressing with the Compressor compressor
+// returns.
+func (l *Logger) millRunOnceWith(compressor func() Compressor) error {
+	l.millMu.Lock()
+	defer l.millMu.Unlock()
+
+	c := compressor()
+
+	if l.LogMaxSaveQuantity == 0 && l.LogMaxSaveDay == 0 && l.LogMaxTotalSize == 0 && !l.Compress && l.ThinningPolicy.AfterDays == 0 {
 		return nil
 	}
 
@@ -398,16 +1975,38 @@ func (l *Logger) millRunOnce() error {
 
 	var compress, remove []logInfo
 
+	if l.ThinningPolicy.AfterDays > 0 {
+		diff := time.Duration(int64(24*time.Hour) * int64(l.ThinningPolicy.AfterDays))
+		cutoff := l.timeNow().Add(-1 * diff)
+
+		// files are sorted newest first, so the first backup seen for a day
+		// is the one to keep.
+		kept := make(map[string]string)
+		var remaining []logInfo
+		for _, f := range files {
+			if f.timestamp.Unix() >= cutoff.Unix() {
+				remaining = append(remaining, f)
+				continue
+			}
+			fn := l.backupStem(f.Name())
+			day := f.timestamp.Format(dateFormat)
+			if name, ok := kept[day]; ok && name != fn {
+				remove = append(remove, f)
+				continue
+			}
+			kept[day] = fn
+			remaining = append(remaining, f)
+		}
+		files = remaining
+	}
+
 	if l.LogMaxSaveQuantity > 0 && l.LogMaxSaveQuantity < len(files) {
 		preserved := make(map[string]bool)
 		var remaining []logInfo
 		for _, f := range files {
 			// Only count the uncompressed log file or the
 			// compressed log file, not both.
-			fn := f.Name()
-			if strings.HasSuffix(fn, compressSuffix) {
-				fn = fn[:len(fn)-len(compressSuffix)]
-			}
+			fn := l.backupStem(f.Name())
 			preserved[fn] = true
 
 			if len(preserved) > l.LogMaxSaveQuantity {
@@ -420,12 +2019,11 @@ func (l *Logger) millRunOnce() error {
 	}
 	if l.LogMaxSaveDay > 0 {
 		diff := time.Duration(int64(24*time.Hour) * int64(l.LogMaxSaveDay))
-		updateCurrentTimestamp(l.LocalTime)
-		cutoff := nowTime.Add(-1 * diff)
+		cutoff := l.timeNow().Add(-1 * diff)
 
 		var remaining []logInfo
 		for _, f := range files {
-			if f.timestamp.Unix() < cutoff.Unix() {
+			if l.retentionTime(f).Unix() < cutoff.Unix() {
 				remove = append(remove, f)
 			} else {
 				remaining = append(remaining, f)
@@ -433,27 +2031,52 @@ func (l *Logger) millRunOnce() error {
 		}
 		files = remaining
 	}
+	if l.LogMaxTotalSize > 0 && l.RetentionOrder != CompressThenRemove {
+		var over []logInfo
+		files, over = l.capTotalSize(files, l.compressedSize)
+		remove = append(remove, over...)
+	}
+	remove = l.pastGrace(remove)
 
 	if l.Compress {
 		for _, f := range files {
-			if !strings.HasSuffix(f.Name(), compressSuffix) {
+			if l.shouldCompress(f) {
 				compress = append(compress, f)
 			}
 		}
 	}
 
-	for _, f := range remove {
-		errRemove := os.Remove(filepath.Join(l.dir(), f.Name()))
-		if err == nil && errRemove != nil {
-			err = errRemove
+	// leave anything past the batch for another run, which works it out
+	// afresh from the directory.
+	more := false
+	if n := l.MillBatchSize; n > 0 && len(remove)+len(compress) > n {
+		more = true
+		if len(remove) > n {
+			remove = remove[:n]
+		}
+		if len(compress) > n-len(remove) {
+			compress = compress[:n-len(remove)]
 		}
 	}
-	for _, f := range compress {
-		fn := filepath.Join(l.dir(), f.Name())
-		errCompress := compressLogFile(fn, fn+compressSuffix)
-		if err == nil && errCompress != nil {
-			err = errCompress
+
+	err = l.removeBackups(remove)
+	if errCompress := l.compressAll(compress, c); err == nil {
+		err = errCompress
+	}
+	// the compressed backups are on disk now, so the cap can go by their
+	// real sizes.
+	if l.LogMaxTotalSize > 0 && l.RetentionOrder == CompressThenRemove && err == nil {
+		files, err = l.oldLogFiles()
+		if err != nil {
+			return err
 		}
+		_, over := l.capTotalSize(files, logInfo.Size)
+		err = l.removeBackups(l.pastGrace(over))
+	}
+	// stop on errors, so a file that can't be handled doesn't keep the mill
+	// spinning; the next rotation tries again.
+	if more && err == nil {
+		l.mill()
 	}
 
 	return err
@@ -463,20 +2086,45 @@ func (l *Logger) millRunOnce() error {
 // of old log files.
 func (l *Logger) millRun() {
 	for range l.millCh {
-		// what am I going to do, log this?
-		_ = l.millRunOnce()
+		l.runQueuedMill()
+	}
+}
+
+// runQueuedMill runs a pass queued by mill, taken from millCh, and counts it
+// finished.  A follow-up pass the pass queues is counted before this one is
+// done, so waitMill doesn't see the mill idle in between.
+func (l *Logger) runQueuedMill() {
+	l.handleError(l.millRunOnce())
+	l.millIdleMu.Lock()
+	l.millQueued--
+	if l.millQueued == 0 {
+		l.millIdle.Broadcast()
 	}
+	l.millIdleMu.Unlock()
+}
+
+// startMillRun starts the mill goroutine.  It is run once, by startMill.
+func (l *Logger) startMillRun() {
+	l.millCh = make(chan bool, 1)
+	l.millIdle.L = &l.millIdleMu
+	go l.millRun()
 }
 
 // mill performs post-rotation compression and removal of stale log files,
 // starting the mill goroutine if necessary.
 func (l *Logger) mill() {
-	l.startMill.Do(func() {
-		l.millCh = make(chan bool, 1)
-		go l.millRun()
-	})
+	if l.isPaused() {
+		atomic.StoreInt32(&l.deferredMill, 1)
+		return
+	}
+	l.startMill.Do(l.startMillRun)
+	// count the pass under millIdleMu, so that it can't finish before it is
+	// counted.
+	l.millIdleMu.Lock()
+	defer l.millIdleMu.Unlock()
 	select {
 	case l.millCh <- true:
+		l.millQueued++
 	default:
 	}
 }
@@ -484,24 +2132,28 @@ func (l *Logger) mill() {
 // oldLogFiles returns the list of backup log files stored in the same
 // directory as the current log file, sorted by ModTime
 func (l *Logger) oldLogFiles() ([]logInfo, error) {
-	files, err := ioutil.ReadDir(l.dir())
+	var files []os.FileInfo
+	err := l.retryNetwork(func() (err error) {
+		files, err = l.fs().ReadDir(l.dir())
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("can't read log file directory: %s", err)
+		return nil, fmt.Errorf("can't read log file directory: %w", err)
 	}
 	logFiles := []logInfo{}
 
 	prefix, ext := l.prefixAndExt()
 
 	for _, f := range files {
-		if f.IsDir() {
+		if f.IsDir() || l.isMarker(f.Name()) {
 			continue
 		}
-		if t, err := l.timeFromName(f.Name(), prefix, ext); err == nil {
-			logFiles = append(logFiles, logInfo{t, f})
+		if info, err := l.parseBackupName(f, prefix, ext); err == nil {
+			logFiles = append(logFiles, info)
 			continue
 		}
-		if t, err := l.timeFromName(f.Name(), prefix, ext+compressSuffix); err == nil {
-			logFiles = append(logFiles, logInfo{t, f})
+		if info, err := l.parseBackupName(f, prefix, l.compressedExt(ext, l.compressor())); err == nil {
+			logFiles = append(logFiles, info)
 			continue
 		}
 		// error parsing means that the suffix at the end was not generated
@@ -513,94 +2165,319 @@ func (l *Logger) oldLogFiles() ([]logInfo, error) {
 	return logFiles, nil
 }
 
+// parseBackupName reports whether f is a backup by its name, returning its
+// timestamp and, with GenerationNaming, its generation.
+func (l *Logger) parseBackupName(f os.FileInfo, prefix, ext string) (logInfo, error) {
+	if l.DailyBackupNaming {
+		t, seq, err := l.dailyFromName(f.Name(), prefix, ext)
+		if err != nil {
+			return logInfo{}, err
+		}
+		return logInfo{timestamp: t, seq: seq, FileInfo: f}, nil
+	}
+	if !l.GenerationNaming {
+		t, seq, err := l.timeSeqFromName(f.Name(), prefix, ext)
+		if err != nil {
+			return logInfo{}, err
+		}
+		return logInfo{timestamp: t, seq: seq, FileInfo: f}, nil
+	}
+	gen, err := generationFromName(f.Name(), prefix, ext)
+	if err != nil {
+		return logInfo{}, err
+	}
+	return logInfo{timestamp: f.ModTime(), generation: gen, FileInfo: f}, nil
+}
+
+// generationFromName extracts the generation number from the filename by
+// stripping off the filename's prefix and extension.
+func generationFromName(filename, prefix, ext string) (int64, error) {
+	if !strings.HasPrefix(filename, prefix) {
+		return 0, errors.New("mismatched prefix")
+	}
+	if !strings.HasSuffix(filename, ext) || len(filename) < len(prefix)+len(ext) {
+		return 0, errors.New("mismatched extension")
+	}
+	digits := filename[len(prefix) : len(filename)-len(ext)]
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return 0, errors.New("generation is not a number")
+		}
+	}
+	return strconv.ParseInt(digits, 10, 64)
+}
+
 // timeFromName extracts the formatted time from the filename by stripping off
 // the filename's prefix and extension. This prevents someone's filename from
 // confusing time.parse.
 func (l *Logger) timeFromName(filename, prefix, ext string) (time.Time, error) {
+	t, _, err := l.timeSeqFromName(filename, prefix, ext)
+	return t, err
+}
+
+// timeSeqFromName is like timeFromName, but also returns the counter after
+// the timestamp, or 0 if there is none.
+func (l *Logger) timeSeqFromName(filename, prefix, ext string) (time.Time, int, error) {
 	if !strings.HasPrefix(filename, prefix) {
-		return time.Time{}, errors.New("mismatched prefix")
+		return time.Time{}, 0, errors.New("mismatched prefix")
+	}
+	if !strings.HasSuffix(filename, ext) || len(filename) < len(prefix)+len(ext) {
+		return time.Time{}, 0, errors.New("mismatched extension")
+	}
+	return l.parseBackupTime(filename[len(prefix) : len(filename)-len(ext)])
+}
+
+// parseBackupTime parses the timestamp of a backup name, and the counter
+// after it, if any: the <date>.<n> of DailyBackupNaming or the
+// <timestamp>-<n> uniqueBackupName gives backups rotated in the same second.
+func (l *Logger) parseBackupTime(ts string) (time.Time, int, error) {
+	if l.DailyBackupNaming {
+		return l.parseDaily(ts)
 	}
-	if !strings.HasSuffix(filename, ext) {
-		return time.Time{}, errors.New("mismatched extension")
+	if i := strings.LastIndexByte(ts, '-'); i >= 0 {
+		n, err := strconv.Atoi(ts[i+1:])
+		if err == nil && n >= 1 && strconv.Itoa(n) == ts[i+1:] {
+			if t, err := time.ParseInLocation(l.backupTimeFormat(), ts[:i], l.location()); err == nil {
+				return t, n, nil
+			}
+		}
 	}
-	ts := filename[len(prefix) : len(filename)-len(ext)]
-	if l.LocalTime {
-		return time.ParseInLocation(backupTimeFormat, ts, time.Local)
+	t, err := time.ParseInLocation(l.backupTimeFormat(), ts, l.location())
+	return t, 0, err
+}
+
+// backupTimeFormat returns the layout of the timestamps in backup names.
+func (l *Logger) backupTimeFormat() string {
+	if l.BackupTimeFormat != "" {
+		return l.BackupTimeFormat
 	}
-	return time.Parse(backupTimeFormat, ts)
+	return backupTimeFormat
 }
 
 // max returns the maximum size in bytes of log files before rolling.
 func (l *Logger) max() int64 {
 	if l.LogMaxSize == 0 {
+		if l.MaxSizePercentFree > 0 && l.percentMax > 0 {
+			return l.percentMax
+		}
 		return int64(defaultMaxSize * megabyte)
 	}
 	return int64(l.LogMaxSize) * int64(megabyte)
 }
 
+// FreeSpace returns the bytes available on the filesystem holding the log
+// directory.  It is only supported on Linux.
+func (l *Logger) FreeSpace() (uint64, error) {
+	return diskFree(l.dir())
+}
+
+// updatePercentMax works out the size limit for MaxSizePercentFree from the
+// free space now, keeping the previous limit if that can't be found.
+func (l *Logger) updatePercentMax() {
+	if l.MaxSizePercentFree <= 0 || l.LogMaxSize != 0 {
+		return
+	}
+	free, err := l.FreeSpace()
+	if err != nil {
+		l.handleError(fmt.Errorf("can't get free space for MaxSizePercentFree: %s", err))
+		return
+	}
+	if max := int64(float64(free) * l.MaxSizePercentFree / 100); max > 0 {
+		l.percentMax = max
+	}
+}
+
+// fileMode returns the mode to create log files with.
+func (l *Logger) fileMode() os.FileMode {
+	if l.FileMode == 0 {
+		return 0600
+	}
+	return l.FileMode
+}
+
+// preserveOwner reports whether to copy file ownership, which PreserveOwner
+// defaults to.
+func (l *Logger) preserveOwner() bool {
+	if l.FileSystem != nil {
+		return false
+	}
+	return l.PreserveOwner == nil || *l.PreserveOwner
+}
+
+// dirMode returns the mode to create log directories with.
+func (l *Logger) dirMode() os.FileMode {
+	if l.DirMode == 0 {
+		return 0755
+	}
+	return l.DirMode
+}
+
 // dir returns the directory for the current filename.
 func (l *Logger) dir() string {
 	return filepath.Dir(l.filename())
 }
 
-// prefixAndExt returns the filename part and extension part from the Logger's
-// filename.
+// prefixAndExt returns the filename part of the Logger's filename and the
+// extension used by its backups.
 func (l *Logger) prefixAndExt() (prefix, ext string) {
 	filename := filepath.Base(l.filename())
 	ext = filepath.Ext(filename)
-	prefix = filename[:len(filename)-len(ext)] + "-"
+	prefix = filename[:len(filename)-len(ext)] + l.backupTimeSeparator()
+	if l.GenerationNaming {
+		prefix = filename[:len(filename)-len(ext)] + "."
+	}
+	if l.BackupFileSuffix != "" {
+		ext = l.BackupFileSuffix
+	}
 	return prefix, ext
 }
 
-// compressLogFile compresses the given log file, removing the
-// uncompressed log file if successful.
-func compressLogFile(src, dst string) (err error) {
-	f, err := os.Open(src)
+// compressAll compresses the backups files with c, CompressConcurrency at a
+// time.  If any fail, it returns the first error, with the messages of the
+// rest.
+func (l *Logger) compressAll(files []logInfo, c Compressor) error {
+	workers := l.CompressConcurrency
+	if workers > len(files) {
+		workers = len(files)
+	}
+	var errs []error
+	if workers <= 1 {
+		for _, f := range files {
+			if err := l.compress(filepath.Join(l.dir(), f.Name()), c); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return joinCompressErrors(errs)
+	}
+
+	names := make(chan string)
+	results := make(chan error, len(files))
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for fn := range names {
+				results <- l.compress(fn, c)
+			}
+		}()
+	}
+	for _, f := range files {
+		names <- filepath.Join(l.dir(), f.Name())
+	}
+	close(names)
+	wg.Wait()
+	close(results)
+	for err := range results {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return joinCompressErrors(errs)
+}
+
+// joinCompressErrors returns nil for no errors, the error for one, and for
+// more the first, wrapped, with the messages of the rest.
+func joinCompressErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	rest := make([]string, len(errs)-1)
+	for i, err := range errs[1:] {
+		rest[i] = err.Error()
+	}
+	return fmt.Errorf("can't compress %d backups: %w; %s", len(errs), errs[0], strings.Join(rest, "; "))
+}
+
+// compress compresses the backup fn next to itself with c and reports the
+// result.
+func (l *Logger) compress(fn string, c Compressor) error {
+	_, ext := l.prefixAndExt()
+	dst := strings.TrimSuffix(fn, ext) + l.compressedExt(ext, c)
+	var srcSize int64
+	err := l.retryNetwork(func() error {
+		info, err := l.fs().Stat(fn)
+		if err != nil {
+			return fmt.Errorf("failed to stat log file: %w", err)
+		}
+		srcSize = info.Size()
+		return compressLogFile(l.fs(), fn, dst, c, l.preserveOwner(), l.notifyCompress)
+	})
+	if err != nil {
+		return err
+	}
+	var size int64
+	if info, err := l.fs().Stat(dst); err == nil {
+		size = info.Size()
+	}
+	if srcSize > 0 {
+		atomic.StoreInt64(&l.compressPermille, size*1000/srcSize)
+	}
+	atomic.AddInt64(&l.totalCompressions, 1)
+	l.emit(event{Type: EventCompress, File: dst, Size: size, Time: l.timeNow()})
+	return nil
+}
+
+// compressLogFile compresses the given log file in fsys with c, removing
+// the uncompressed log file if successful.  If preserveOwner is set, the
+// compressed file gets the owner of the original.
+func compressLogFile(fsys FileSystem, src, dst string, c Compressor, preserveOwner bool, done func(dst string, originalSize, compressedSize int64)) (err error) {
+	compressBudget.acquire(compressMemoryEstimate)
+	defer compressBudget.release(compressMemoryEstimate)
+
+	f, err := fsys.OpenFile(src, os.O_RDONLY, 0)
 	if err != nil {
-		return fmt.Errorf("failed to open log file: %v", err)
+		return fmt.Errorf("failed to open log file: %w", err)
 	}
 	defer f.Close()
 
-	fi, err := osStat(src)
+	fi, err := fsys.Stat(src)
 	if err != nil {
-		return fmt.Errorf("failed to stat log file: %v", err)
+		return fmt.Errorf("failed to stat log file: %w", err)
 	}
 
-	if err := chown(dst, fi); err != nil {
-		return fmt.Errorf("failed to chown compressed log file: %v", err)
+	if preserveOwner {
+		if err := chown(dst, fi); err != nil {
+			return fmt.Errorf("failed to chown compressed log file: %w", err)
+		}
 	}
 
 	// If this file already exists, we presume it was created by
 	// a previous attempt to compress the log file.
-	gzf, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fi.Mode())
+	gzf, err := fsys.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fi.Mode())
 	if err != nil {
-		return fmt.Errorf("failed to open compressed log file: %v", err)
+		return fmt.Errorf("failed to open compressed log file: %w", err)
 	}
 	defer gzf.Close()
 
-	gz := gzip.NewWriter(gzf)
-
 	defer func() {
 		if err != nil {
-			os.Remove(dst)
-			err = fmt.Errorf("failed to compress log file: %v", err)
+			fsys.Remove(dst)
+			err = fmt.Errorf("failed to compress log file: %w", err)
 		}
 	}()
 
-	if _, err := io.Copy(gz, f); err != nil {
-		return err
-	}
-	if err := gz.Close(); err != nil {
+	if err := c.Compress(gzf, f); err != nil {
 		return err
 	}
 	if err := gzf.Close(); err != nil {
 		return err
 	}
+	if done != nil {
+		var size int64
+		if info, err := fsys.Stat(dst); err == nil {
+			size = info.Size()
+		}
+		done(dst, fi.Size(), size)
+	}
 
 	if err := f.Close(); err != nil {
 		return err
 	}
-	if err := os.Remove(src); err != nil {
+	if err := fsys.Remove(src); err != nil {
 		return err
 	}
 
@@ -608,17 +2485,28 @@ func compressLogFile(src, dst string) (err error) {
 }
 
 // logInfo is a convenience struct to return the filename and its embedded
-// timestamp.
+// timestamp, or generation with GenerationNaming.
 type logInfo struct {
-	timestamp time.Time
+	timestamp  time.Time
+	generation int64
+	// seq is the counter of a backup named with DailyBackupNaming, or of
+	// one rotated in the same second as another.
+	seq int
 	os.FileInfo
 }
 
-// byFormatTime sorts by newest time formatted in the name.
+// byFormatTime sorts by highest generation, then newest time formatted in
+// the name, then highest counter.
 type byFormatTime []logInfo
 
 func (b byFormatTime) Less(i, j int) bool {
-	return b[i].timestamp.After(b[j].timestamp)
+	if b[i].generation != b[j].generation {
+		return b[i].generation > b[j].generation
+	}
+	if !b[i].timestamp.Equal(b[j].timestamp) {
+		return b[i].timestamp.After(b[j].timestamp)
+	}
+	return b[i].seq > b[j].seq
 }
 
 func (b byFormatTime) Swap(i, j int) {
@@ -630,57 +2518,107 @@ func (b byFormatTime) Len() int {
 }
 
 //更新当天的23时59分时间戳
-func updateLastTimeOfToday(local bool) {
-	currTime := time.Unix(nowTimestamp, 0)
-	endDate := currTime.Format(dateFormat) + "_23:59:59"
-	if !local {
-		//UTC
-		endTimeStamp, _ := time.Parse(timeFormat, endDate)
-		lastTimestamp = endTimeStamp.Unix()
-	} else {
-		//local
-		endTimeStamp, _ := time.ParseInLocation(timeFormat, endDate, time.Local)
-		lastTimestamp = endTimeStamp.Unix()
-	}
+// The day ends the second before next, the start of the next day.
+func (l *Logger) updateLastTimeOfToday(next time.Time) {
+	l.lastTimestamp = next.Unix() - 1
 }
 
-func updateYesterdayTime(local bool) {
-	yesterdayTime := time.Unix(nowTimestamp, 0).AddDate(0, 0, -1)
-	yesterdayLastTime := yesterdayTime.Format(dateFormat) + "_23:59:59"
-	if !local {
-		//UTC
-		endTimeStamp, _ := time.Parse(timeFormat, yesterdayLastTime)
-		yesterdayLastTimestamp = endTimeStamp.Unix()
-	} else {
-		//local
-		endTimeStamp, _ := time.ParseInLocation(timeFormat, yesterdayLastTime, time.Local)
-		yesterdayLastTimestamp = endTimeStamp.Unix()
-	}
+// updateYesterdayTime sets the end of the day before the one ending the
+// second before next.
+func (l *Logger) updateYesterdayTime(next time.Time) {
+	l.yesterdayLastTimestamp = next.AddDate(0, 0, -1).Unix() - 1
 }
 
 //更新当前时间戳
-func updateCurrentTimestamp(local bool) {
-	t := currentTime()
-	if !local {
-		t = t.UTC()
-	}
-	nowTime = t
-	nowTimestamp = t.Unix()
+func (l *Logger) updateCurrentTimestamp(t time.Time) {
+	t = t.In(l.location())
+	l.nowTime = t
+}
+
+// nextHourSplit returns the hour LogSplitHour hours after the start of the
+// hour holding t.
+func (l *Logger) nextHourSplit(t time.Time) time.Time {
+	t = t.In(l.location())
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+l.LogSplitHour, 0, 0, 0, t.Location())
 }
 
 //当前时间是否超过0点（进入下一天）
-func isNextDay(local bool) bool {
-	updateCurrentTimestamp(local)
-	return nowTimestamp > lastTimestamp
+// This runs on every write, so it only compares t with the cached end of
+// day; the caller recomputes the boundaries once it has passed.
+func (l *Logger) isNextDay(t time.Time) bool {
+	return t.Unix() > l.lastTimestamp
+}
+
+// LastWriteTimeExtractor extracts the time a log line was written from the
+// line itself.
+type LastWriteTimeExtractor interface {
+	Extract(lastLine string) (time.Time, error)
+}
+
+// errNoTimestamp is returned by the default LastWriteTimeExtractor when the
+// line contains nothing that looks like a timestamp.
+var errNoTimestamp = errors.New("no timestamp found in line")
+
+// defaultTimeExtractor is the LastWriteTimeExtractor used when none is
+// configured.  It parses the leading timestamp-like text of the line with the
+// given layout.
+type defaultTimeExtractor struct {
+	layout string
+	loc    *time.Location
+}
+
+func (e defaultTimeExtractor) Extract(lastLine string) (time.Time, error) {
+	str := getTimeFromStr(lastLine)
+	if len(str) == 0 {
+		return time.Time{}, errNoTimestamp
+	}
+	return time.ParseInLocation(e.layout, str, e.loc)
+}
+
+// lastWriteTimeExtractor returns the configured extractor or the default one,
+// or nil if there is neither an extractor nor a LogFileTimeFormat for the
+// default one to parse with.
+func (l *Logger) lastWriteTimeExtractor() LastWriteTimeExtractor {
+	if e, ok := l.LastWriteTimeExtractor.(regexpTimeExtractor); ok && e.loc == nil {
+		// made without a zone, it goes by the Logger's.
+		e.loc = l.location()
+		return e
+	}
+	if l.LastWriteTimeExtractor != nil {
+		return l.LastWriteTimeExtractor
+	}
+	if l.LogFileTimeFormat == "" {
+		return nil
+	}
+	return defaultTimeExtractor{layout: l.LogFileTimeFormat, loc: l.location()}
 }
 
 //读取日志文件非空的最后一行，并获取时间
-func getLogFileUpdateTime(filePath string) string {
+// With no extractor, or with UseModTimeFallback when the last line is too
+// long to read or the extractor finds no time in it, it is the file's
+// modification time.
+func (l *Logger) getLogFileUpdateTime(filePath string, extractor LastWriteTimeExtractor) (time.Time, error) {
+	if extractor == nil {
+		info, err := l.fs().Stat(filePath)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return info.ModTime(), nil
+	}
 	//读取最后一行
-	lastLine := getLastLineWithSeek(filePath)
+	lastLine, err := l.lastLine(filePath)
+	if err != nil && err != errNoTimestamp {
+		return time.Time{}, err
+	}
 	//获取该行中的时间
-	lastTime := getTimeFromStr(lastLine)
-	return lastTime
+	var t time.Time
+	if err == nil {
+		t, err = extractor.Extract(lastLine)
+	}
+	if err != nil && l.UseModTimeFallback {
+		return l.getLogFileUpdateTime(filePath, nil)
+	}
+	return t, err
 }
 
 func getTimeFromStr(str string) string {
@@ -692,46 +2630,63 @@ func getTimeFromStr(str string) string {
 	return ""
 }
 
-func getLastLineWithSeek(filepath string) string {
-	fileHandle, err := os.Open(filepath)
+// lastLineChunkSize is the size of the blocks readLastLine reads backwards
+// from the end of the file.
+const lastLineChunkSize = 4096
+
+// maxLastLineLength is the longest last line readLastLine reads; a longer
+// one is taken to have no timestamp worth reading.
+const maxLastLineLength = 64 * 1024
+
+// readLastLine returns the last line of the open file that isn't blank,
+// trimmed of surrounding white space, or "" if there is none.  Lines may end
+// in "\n", "\r\n" or "\r".  It reads the file backwards a block at a time,
+// so a large file costs no more than its last lines, and returns
+// errNoTimestamp for a last line longer than maxLastLineLength.
+func readLastLine(fileHandle File) (string, error) {
+	stat, err := fileHandle.Stat()
 	if err != nil {
-		panic("Cannot open file")
-	}
-	defer fileHandle.Close()
-	var line string
-	var cursor int64 = 0
-	stat, _ := fileHandle.Stat()
-	fileSize := stat.Size()
-	for fileSize > 0 {
-		cursor -= 1
-		if _, err := fileHandle.Seek(cursor, io.SeekEnd); err != nil {
-			panic(err)
-		}
-		char := make([]byte, 1)
-		if _, err := fileHandle.Read(char); err != nil {
-			panic(err)
-		}
-		//是否为非空的倒数第一行
-		if cursor != -1 && (char[0] == '\n' || char[0] == '\r') && !strIsNull(line) {
-			break
+		return "", fmt.Errorf("can't stat log file: %w", err)
+	}
+	// blocks holds the line read so far, last block first.
+	var blocks [][]byte
+	length := 0
+	for pos := stat.Size(); pos > 0; {
+		n := int64(lastLineChunkSize)
+		if pos < n {
+			n = pos
 		}
-		line = string(char) + line
-		//遍历到文件开头
-		if cursor == -fileSize {
+		pos -= n
+		chunk := make([]byte, n)
+		if _, err := fileHandle.ReadAt(chunk, pos); err != nil {
+			return "", err
+		}
+		//跳过末尾的空行
+		if len(blocks) == 0 {
+			if chunk = bytes.TrimRight(chunk, " \t\r\n"); len(chunk) == 0 {
+				continue
+			}
+		}
+		i := bytes.LastIndexAny(chunk, "\r\n")
+		chunk = chunk[i+1:]
+		blocks = append(blocks, chunk)
+		if length += len(chunk); length > maxLastLineLength {
+			return "", errNoTimestamp
+		}
+		//返回非空的倒数第一行
+		if i >= 0 {
 			break
 		}
 	}
-	//返回非空的倒数第一行
-	return strings.TrimSpace(line)
-}
-
-func strIsNull(line string) bool {
-	temp := strings.TrimSpace(line)
-	return len(temp) <= 0 || temp == ""
+	line := make([]byte, 0, length)
+	for i := len(blocks) - 1; i >= 0; i-- {
+		line = append(line, blocks[i]...)
+	}
+	return strings.TrimSpace(string(line)), nil
 }
 
-func pathFileExist(filePath string) (bool, error) {
-	_, err := os.Stat(filePath)
+func pathFileExist(fsys FileSystem, filePath string) (bool, error) {
+	_, err := fsys.Stat(filePath)
 	if err == nil {
 		return true, nil
 	}
@@ -741,47 +2696,47 @@ func pathFileExist(filePath string) (bool, error) {
 	return false, err
 }
 
-func (l *Logger) changeFileNameByTime(lastTime string) string {
-	var newFileTime time.Time
-	var err error
-	//时间字符串 =》 当前字符串的时间格式
-	if l.LocalTime {
-		newFileTime, err = time.ParseInLocation(l.LogFileTimeFormat, lastTime, time.Local)
-	} else {
-		newFileTime, err = time.Parse(l.LogFileTimeFormat, lastTime)
+func (l *Logger) changeFileNameByTime(lastTime time.Time) (string, error) {
+	lastTime = lastTime.In(l.location())
+	//新文件名
+	newFileName := l.LogFileName + l.backupTimeSeparator() + lastTime.Format(l.backupTimeFormat())
+	_, ext := l.prefixAndExt()
+	newFileName = filepath.Base(l.uniqueBackupName(filepath.Join(l.dir(), newFileName+ext)))
+	if l.GenerationNaming {
+		gen, err := l.nextGeneration()
+		if err != nil {
+			return "", err
+		}
+		newFileName = filepath.Base(l.generationName(l.filename(), gen))
 	}
+	if l.DailyBackupNaming {
+		name, err := l.dailyName(l.filename(), lastTime)
+		if err != nil {
+			return "", err
+		}
+		newFileName = filepath.Base(name)
+	}
+	info, err := l.fs().Stat(l.filename())
 	if err != nil {
-		log.Fatal(err)
+		return "", fmt.Errorf("error getting log file info: %w", err)
 	}
-	//当前字符串的时间格式 =》 时间戳 =》 log文件的时间格式
-	newFileTimestamp := newFileTime.Unix()
-	//新文件名
-	newFileName := l.LogFileName + "-" + time.Unix(newFileTimestamp, 0).Format(backupTimeFormat)
 	//更改文件名
-	l.changeFileName(l.LogPathName, l.LogFileName+l.LogFileSuffix, newFileName+l.LogFileSuffix)
-	return newFileName + l.LogFileSuffix
-}
-
-func (l *Logger) changeFileName(pathName string, odlFileName string, newFileName string) {
-	err := os.Rename(path.Join(pathName, odlFileName), path.Join(pathName, newFileName))
-	if err != nil {
-		panic(err)
+	if err := l.changeFileName(l.LogPathName, l.LogFileName+l.LogFileSuffix, newFileName); err != nil {
+		return "", err
 	}
+	l.emitRotate(filepath.Join(l.dir(), newFileName), info.Size())
+	l.archive(filepath.Join(l.dir(), newFileName))
+	l.chainRotated(newFileName)
+	l.notifyRotate(l.filename(), filepath.Join(l.dir(), newFileName))
+	return newFileName, nil
 }
 
-//时间字符串 =》 当前字符串的时间格式的时间戳
-func (l *Logger) strTime2TimeStamp(strTime string) int64 {
-	var err error
-	var tmpTime time.Time
-	if l.LocalTime {
-		tmpTime, err = time.ParseInLocation(l.LogFileTimeFormat, strTime, time.Local)
-	} else {
-		tmpTime, err = time.Parse(l.LogFileTimeFormat, strTime)
-	}
+func (l *Logger) changeFileName(pathName string, odlFileName string, newFileName string) error {
+	err := l.fs().Rename(path.Join(pathName, odlFileName), path.Join(pathName, newFileName))
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("can't rename log file: %w", err)
 	}
-	return tmpTime.Unix()
+	return nil
 }
 
 func (l *Logger) compressFiles(fileName string) error {
@@ -794,8 +2749,7 @@ func (l *Logger) compressFiles(fileName string) error {
 
 	if l.LogMaxSaveDay > 0 {
 		diff := time.Duration(int64(24*time.Hour) * int64(l.LogMaxSaveDay))
-		updateCurrentTimestamp(l.LocalTime)
-		cutoff := nowTime.Add(-1 * diff)
+		cutoff := l.timeNow().Add(-1 * diff)
 		for _, f := range files {
 			if f.Name() == fileName && f.timestamp.Unix() > cutoff.Unix() {
 				remaining = f
@@ -806,10 +2760,10 @@ func (l *Logger) compressFiles(fileName string) error {
 
 	if l.Compress {
 		//当前文件需要压缩
-		if !reflect.DeepEqual(remaining, logInfo{}) && !strings.HasSuffix(remaining.Name(), compressSuffix) {
+		if !reflect.DeepEqual(remaining, logInfo{}) && l.shouldCompress(remaining) {
 			//压缩
 			fn := filepath.Join(l.dir(), remaining.Name())
-			errCompress := compressLogFile(fn, fn+compressSuffix)
+			errCompress := l.compress(fn, l.startupCompressor())
 			if errCompress != nil {
 				err = errCompress
 			}
@@ -3,11 +3,16 @@ package lumberjack
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
 
@@ -26,6 +31,9 @@ import (
 // that doesn't change unless we want it to.
 var fakeCurrentTime = time.Now()
 
+// realDiskFree is the unmocked diskFree.
+var realDiskFree = diskFree
+
 func fakeTime() time.Time {
 	return fakeCurrentTime
 }
@@ -208,7 +216,7 @@ func TestMaxBackups(t *testing.T) {
 		LogMaxSize:         10,
 		LogMaxSaveQuantity: 1,
 	}
-	defer l.Close()
+	defer closeWait(l, t)
 	b := []byte("boo!")
 	n, err := l.Write(b)
 	isNil(err, t)
@@ -248,9 +256,8 @@ func TestMaxBackups(t *testing.T) {
 
 	existsWithContent(filename, b3, t)
 
-	// we need to wait a little bit since the files get deleted on a different
-	// goroutine.
-	<-time.After(time.Millisecond * 10)
+	// wait for the files to be deleted on the mill goroutine.
+	l.waitMill()
 
 	// should only have two files in the dir still
 	fileCount(dir, 2, t)
@@ -298,9 +305,8 @@ func TestMaxBackups(t *testing.T) {
 	existsWithContent(fourthFilename, b3, t)
 	existsWithContent(fourthFilename+compressSuffix, []byte("compress"), t)
 
-	// we need to wait a little bit since the files get deleted on a different
-	// goroutine.
-	<-time.After(time.Millisecond * 10)
+	// wait for the files to be deleted on the mill goroutine.
+	l.waitMill()
 
 	// We should have four things in the directory now - the 2 log files, the
 	// not log file, and the directory
@@ -360,7 +366,7 @@ func TestCleanupExistingBackups(t *testing.T) {
 		LogMaxSize:         10,
 		LogMaxSaveQuantity: 1,
 	}
-	defer l.Close()
+	defer closeWait(l, t)
 
 	newFakeTime()
 
@@ -369,9 +375,8 @@ func TestCleanupExistingBackups(t *testing.T) {
 	isNil(err, t)
 	equals(len(b2), n, t)
 
-	// we need to wait a little bit since the files get deleted on a different
-	// goroutine.
-	<-time.After(time.Millisecond * 10)
+	// wait for the files to be deleted on the mill goroutine.
+	l.waitMill()
 
 	// now we should only have 2 files left - the primary and one backup
 	fileCount(dir, 2, t)
@@ -390,7 +395,7 @@ func TestMaxAge(t *testing.T) {
 		LogMaxSize:       10,
 		LogMaxSaveDay:    1,
 	}
-	defer l.Close()
+	defer closeWait(l, t)
 	b := []byte("boo!")
 	n, err := l.Write(b)
 	isNil(err, t)
@@ -408,9 +413,8 @@ func TestMaxAge(t *testing.T) {
 	equals(len(b2), n, t)
 	existsWithContent(backupFile(dir), b, t)
 
-	// we need to wait a little bit since the files get deleted on a different
-	// goroutine.
-	<-time.After(10 * time.Millisecond)
+	// wait for the files to be deleted on the mill goroutine.
+	l.waitMill()
 
 	// We should still have 2 log files, since the most recent backup was just
 	// created.
@@ -430,9 +434,8 @@ func TestMaxAge(t *testing.T) {
 	equals(len(b3), n, t)
 	existsWithContent(backupFile(dir), b2, t)
 
-	// we need to wait a little bit since the files get deleted on a different
-	// goroutine.
-	<-time.After(10 * time.Millisecond)
+	// wait for the files to be deleted on the mill goroutine.
+	l.waitMill()
 
 	// We should have 2 log files - the main log file, and the most recent
 	// backup.  The earlier backup is past the cutoff and should be gone.
@@ -495,6 +498,8 @@ func TestTimeFromName(t *testing.T) {
 	}{
 		{"foo-2014-05-04T14-44-33.555.log", time.Date(2014, 5, 4, 14, 44, 33, 555000000, time.UTC), false},
 		{"foo-2014-05-04T14-44-33.555", time.Time{}, true},
+		{"foo-2014-05-04T14-44-33-2.log", time.Date(2014, 5, 4, 14, 44, 33, 0, time.UTC), false},
+		{"foo-2014-05-04T14-44-33-02.log", time.Time{}, true},
 		{"2014-05-04T14-44-33.555.log", time.Time{}, true},
 		{"foo.log", time.Time{}, true},
 	}
@@ -545,7 +550,7 @@ func TestRotate(t *testing.T) {
 		LogMaxSaveQuantity: 1,
 		LogMaxSize:         100, // megabytes
 	}
-	defer l.Close()
+	defer closeWait(l, t)
 	b := []byte("boo!")
 	n, err := l.Write(b)
 	isNil(err, t)
@@ -559,9 +564,8 @@ func TestRotate(t *testing.T) {
 	err = l.Rotate()
 	isNil(err, t)
 
-	// we need to wait a little bit since the files get deleted on a different
-	// goroutine.
-	<-time.After(10 * time.Millisecond)
+	// wait for the files to be deleted on the mill goroutine.
+	l.waitMill()
 
 	filename2 := backupFile(dir)
 	existsWithContent(filename2, b, t)
@@ -572,9 +576,8 @@ func TestRotate(t *testing.T) {
 	err = l.Rotate()
 	isNil(err, t)
 
-	// we need to wait a little bit since the files get deleted on a different
-	// goroutine.
-	<-time.After(10 * time.Millisecond)
+	// wait for the files to be deleted on the mill goroutine.
+	l.waitMill()
 
 	filename3 := backupFile(dir)
 	existsWithContent(filename3, []byte{}, t)
@@ -603,7 +606,7 @@ func TestCompressOnRotate(t *testing.T) {
 		fullPathFileName: filename,
 		LogMaxSize:       10,
 	}
-	defer l.Close()
+	defer closeWait(l, t)
 	b := []byte("boo!")
 	n, err := l.Write(b)
 	isNil(err, t)
@@ -621,9 +624,8 @@ func TestCompressOnRotate(t *testing.T) {
 	// nothing in it.
 	existsWithContent(filename, []byte{}, t)
 
-	// we need to wait a little bit since the files get compressed on a different
-	// goroutine.
-	<-time.After(300 * time.Millisecond)
+	// wait for the files to be compressed on the mill goroutine.
+	l.waitMill()
 
 	// a compressed version of the log file should now exist and the original
 	// should have been removed.
@@ -652,7 +654,7 @@ func TestCompressOnResume(t *testing.T) {
 		fullPathFileName: filename,
 		LogMaxSize:       10,
 	}
-	defer l.Close()
+	defer closeWait(l, t)
 
 	// Create a backup file and empty "compressed" file.
 	filename2 := backupFile(dir)
@@ -670,9 +672,8 @@ func TestCompressOnResume(t *testing.T) {
 	equals(len(b2), n, t)
 	existsWithContent(filename, b2, t)
 
-	// we need to wait a little bit since the files get compressed on a different
-	// goroutine.
-	<-time.After(300 * time.Millisecond)
+	// wait for the files to be compressed on the mill goroutine.
+	l.waitMill()
 
 	// The write should have started the compression - a compressed version of
 	// the log file should now exist and the original should have been removed.
@@ -751,63 +752,2105 @@ compress = true`[1:]
 	equals(0, len(md.Undecoded()), t)
 }
 
-// makeTempDir creates a file with a semi-unique name in the OS temp directory.
-// It should be based on the name of the test, to keep parallel tests from
-// colliding, and must be cleaned up after the test is finished.
-func makeTempDir(name string, t testing.TB) string {
-	dir := time.Now().Format(name + backupTimeFormat)
-	dir = filepath.Join(os.TempDir(), dir)
-	isNilUp(os.Mkdir(dir, 0700), t, 1)
-	return dir
+func TestHealthCheck(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestHealthCheck", t)
+	defer os.RemoveAll(dir)
+
+	filename := logFile(dir)
+	l := &Logger{
+		fullPathFileName: filename,
+	}
+	defer l.Close()
+
+	// nothing is open yet, so there is nothing to check.
+	isNil(l.HealthCheck(), t)
+
+	b := []byte("boo!")
+	n, err := l.Write(b)
+	isNil(err, t)
+	equals(len(b), n, t)
+	isNil(l.HealthCheck(), t)
+
+	// move the active file out from under the logger.
+	err = os.Rename(filename, filename+".moved")
+	isNil(err, t)
+	notNil(l.HealthCheck(), t)
+
+	// a different file at the expected path is still a discrepancy.
+	err = ioutil.WriteFile(filename, b, 0644)
+	isNil(err, t)
+	notNil(l.HealthCheck(), t)
 }
 
-// existsWithContent checks that the given file exists and has the correct content.
-func existsWithContent(path string, content []byte, t testing.TB) {
-	info, err := os.Stat(path)
-	isNilUp(err, t, 1)
-	equalsUp(int64(len(content)), info.Size(), t, 1)
+func TestResyncSize(t *testing.T) {
+	currentTime = fakeTime
+	megabyte = 1
+	dir := makeTempDir("TestResyncSize", t)
+	defer os.RemoveAll(dir)
 
-	b, err := ioutil.ReadFile(path)
-	isNilUp(err, t, 1)
-	equalsUp(content, b, t, 1)
+	filename := logFile(dir)
+	l := &Logger{
+		fullPathFileName: filename,
+		LogMaxSize:       10,
+	}
+	defer l.Close()
+	// nothing is open yet.
+	isNil(l.ResyncSize(), t)
+
+	_, err := l.Write([]byte("boo!"))
+	isNil(err, t)
+
+	// another process appends behind the logger's back.
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0644)
+	isNil(err, t)
+	_, err = f.Write([]byte("other"))
+	isNil(err, t)
+	f.Close()
+	notNil(l.HealthCheck(), t)
+	// unless that much is allowed for.
+	l.HealthCheckSizeSlack = 5
+	isNil(l.HealthCheck(), t)
+	l.HealthCheckSizeSlack = 4
+	notNil(l.HealthCheck(), t)
+	l.HealthCheckSizeSlack = 0
+
+	err = l.ResyncSize()
+	isNil(err, t)
+	isNil(l.HealthCheck(), t)
+	equals(int64(9), l.CurrentSize(), t)
+
+	// 4 bytes would have fit going by the old size, but not the true one.
+	newFakeTime()
+	_, err = l.Write([]byte("foo!"))
+	isNil(err, t)
+	existsWithContent(backupFile(dir), []byte("boo!other"), t)
+	existsWithContent(filename, []byte("foo!"), t)
 }
 
-// logFile returns the log file name in the given directory for the current fake
-// time.
-func logFile(dir string) string {
-	return filepath.Join(dir, "foobar.log")
+// jsonTimeExtractor reads the "ts" field of a JSON log line.
+type jsonTimeExtractor struct{}
+
+func (jsonTimeExtractor) Extract(lastLine string) (time.Time, error) {
+	var rec struct {
+		TS time.Time `json:"ts"`
+	}
+	if err := json.Unmarshal([]byte(lastLine), &rec); err != nil {
+		return time.Time{}, err
+	}
+	return rec.TS, nil
 }
 
-func backupFile(dir string) string {
-	return filepath.Join(dir, "foobar-"+fakeTime().UTC().Format(backupTimeFormat)+".log")
+func TestInitLastWriteTimeExtractor(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestInitLastWriteTimeExtractor", t)
+	defer os.RemoveAll(dir)
+
+	// the timestamp is not at the start of the line, so the default extractor
+	// can't find it.
+	lastWrite := fakeTime().UTC().Add(-72 * time.Hour).Truncate(time.Second)
+	data := []byte(fmt.Sprintf("{\"msg\":\"bye\",\"ts\":%q}\n\n", lastWrite.Format(time.RFC3339)))
+	filename := logFile(dir)
+	err := ioutil.WriteFile(filename, data, 0644)
+	isNil(err, t)
+
+	l := &Logger{
+		LogPathName:            dir + string(filepath.Separator),
+		LogFileName:            "foobar",
+		LogFileSuffix:          ".log",
+		LastWriteTimeExtractor: jsonTimeExtractor{},
+	}
+	defer l.Close()
+	err = l.Init()
+	isNil(err, t)
+
+	// the stale file was moved aside using the time from its last record.
+	notExist(filename, t)
+	backup := filepath.Join(dir, "foobar-"+lastWrite.Format(backupTimeFormat)+".log")
+	existsWithContent(backup, data, t)
 }
 
-func backupFileLocal(dir string) string {
-	return filepath.Join(dir, "foobar-"+fakeTime().Format(backupTimeFormat)+".log")
+func TestInitModTimeWithoutFormat(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestInitModTimeWithoutFormat", t)
+	defer os.RemoveAll(dir)
+
+	// with no LogFileTimeFormat, the file's lines aren't read for a time.
+	lastWrite := fakeTime().UTC().Add(-72 * time.Hour).Truncate(time.Second)
+	data := []byte("no timestamp here\n")
+	filename := logFile(dir)
+	err := ioutil.WriteFile(filename, data, 0644)
+	isNil(err, t)
+	err = os.Chtimes(filename, lastWrite, lastWrite)
+	isNil(err, t)
+
+	var errs []error
+	l := &Logger{
+		LogPathName:   dir + string(filepath.Separator),
+		LogFileName:   "foobar",
+		LogFileSuffix: ".log",
+		ErrorHandler:  func(err error) { errs = append(errs, err) },
+	}
+	defer l.Close()
+	err = l.Init()
+	isNil(err, t)
+	equals(0, len(errs), t)
+
+	// the stale file was moved aside by its modification time.
+	notExist(filename, t)
+	existsWithContent(filepath.Join(dir, "foobar-"+lastWrite.Format(backupTimeFormat)+".log"), data, t)
+
+	// one written today is kept.
+	err = l.Close()
+	isNil(err, t)
+	err = ioutil.WriteFile(filename, data, 0644)
+	isNil(err, t)
+	err = os.Chtimes(filename, fakeTime(), fakeTime())
+	isNil(err, t)
+	err = l.Init()
+	isNil(err, t)
+	existsWithContent(filename, data, t)
+	fileCount(dir, 2, t)
 }
 
-// logFileLocal returns the log file name in the given directory for the current
-// fake time using the local timezone.
-func logFileLocal(dir string) string {
-	return filepath.Join(dir, fakeTime().Format(backupTimeFormat))
+func TestUseModTimeFallback(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestUseModTimeFallback", t)
+	defer os.RemoveAll(dir)
+
+	lastWrite := fakeTime().UTC().Add(-72 * time.Hour).Truncate(time.Second)
+	data := []byte{0x00, 0x01, 0xfe, '\n'}
+	filename := logFile(dir)
+	init := func(fallback bool) {
+		err := ioutil.WriteFile(filename, data, 0644)
+		isNilUp(err, t, 1)
+		err = os.Chtimes(filename, lastWrite, lastWrite)
+		isNilUp(err, t, 1)
+		l := &Logger{
+			LogPathName:        dir + string(filepath.Separator),
+			LogFileName:        "foobar",
+			LogFileSuffix:      ".log",
+			LogFileTimeFormat:  "2006-01-02 15:04:05",
+			UseModTimeFallback: fallback,
+		}
+		defer l.Close()
+		err = l.Init()
+		isNilUp(err, t, 1)
+	}
+
+	// a binary log's last line has no time in it, so the file is kept...
+	init(false)
+	existsWithContent(filename, data, t)
+
+	// ...unless its modification time can go instead.
+	init(true)
+	notExist(filename, t)
+	backup := filepath.Join(dir, "foobar-"+lastWrite.Format(backupTimeFormat)+".log")
+	existsWithContent(backup, data, t)
+
+	// so it does for a last line too long to read, whatever time it starts
+	// with.
+	isNil(os.Remove(backup), t)
+	data = []byte(lastWrite.Add(-24*time.Hour).Format("2006-01-02 15:04:05") + " " + strings.Repeat("x", maxLastLineLength) + "\n")
+	init(true)
+	notExist(filename, t)
+	existsWithContent(backup, data, t)
 }
 
-// fileCount checks that the number of files in the directory is exp.
-func fileCount(dir string, exp int, t testing.TB) {
-	files, err := ioutil.ReadDir(dir)
-	isNilUp(err, t, 1)
-	// Make sure no other files were created.
-	equalsUp(exp, len(files), t, 1)
+func TestWriteWithInfo(t *testing.T) {
+	currentTime = fakeTime
+	megabyte = 1
+	dir := makeTempDir("TestWriteWithInfo", t)
+	defer os.RemoveAll(dir)
+
+	filename := logFile(dir)
+	l := &Logger{
+		fullPathFileName: filename,
+		LogMaxSize:       10,
+	}
+	defer l.Close()
+
+	b := []byte("boo!")
+	n, rotated, err := l.WriteWithInfo(b)
+	isNil(err, t)
+	equals(len(b), n, t)
+	equals(false, rotated, t)
+
+	newFakeTime()
+
+	// this puts us over the max, so it rotates first.
+	b2 := []byte("foooooo!")
+	n, rotated, err = l.WriteWithInfo(b2)
+	isNil(err, t)
+	equals(len(b2), n, t)
+	equals(true, rotated, t)
+	existsWithContent(backupFile(dir), b, t)
+	existsWithContent(filename, b2, t)
+
+	n, rotated, err = l.WriteWithInfo([]byte("a"))
+	isNil(err, t)
+	equals(1, n, t)
+	equals(false, rotated, t)
 }
 
-// newFakeTime sets the fake "current time" to two days later.
-func newFakeTime() {
-	fakeCurrentTime = fakeCurrentTime.Add(time.Hour * 24 * 2)
+func TestMetricsSink(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestMetricsSink", t)
+	defer os.RemoveAll(dir)
+
+	sink := new(bytes.Buffer)
+	filename := logFile(dir)
+	l := &Logger{
+		fullPathFileName: filename,
+		MetricsSink:      sink,
+	}
+	defer l.Close()
+	b := []byte("boo!")
+	n, err := l.Write(b)
+	isNil(err, t)
+	equals(len(b), n, t)
+	equals(0, sink.Len(), t)
+
+	newFakeTime()
+	err = l.Rotate()
+	isNil(err, t)
+
+	var ev struct {
+		Type string    `json:"type"`
+		File string    `json:"file"`
+		Size int64     `json:"size"`
+		Time time.Time `json:"time"`
+	}
+	line, err := sink.ReadBytes('\n')
+	isNil(err, t)
+	err = json.Unmarshal(line, &ev)
+	isNil(err, t)
+	equals(EventRotate, ev.Type, t)
+	equals(backupFile(dir), ev.File, t)
+	equals(int64(len(b)), ev.Size, t)
+	assert(ev.Time.Equal(fakeTime()), t, "expected event time %v, got %v", fakeTime(), ev.Time)
+	equals(0, sink.Len(), t)
 }
 
-func notExist(path string, t testing.TB) {
-	_, err := os.Stat(path)
-	assertUp(os.IsNotExist(err), t, 1, "expected to get os.IsNotExist, but instead got %v", err)
+func TestMetricsSinkSelf(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestMetricsSinkSelf", t)
+	defer os.RemoveAll(dir)
+
+	var handled []error
+	l := &Logger{
+		fullPathFileName: logFile(dir),
+		ErrorHandler:     func(err error) { handled = append(handled, err) },
+	}
+	l.MetricsSink = l
+	defer l.Close()
+	_, err := l.Write([]byte("boo!"))
+	isNil(err, t)
+
+	newFakeTime()
+
+	// writing the event would recurse into the logger, so it's refused.
+	err = l.Rotate()
+	isNil(err, t)
+	equals(1, len(handled), t)
+	existsWithContent(logFile(dir), []byte{}, t)
+}
+
+func TestMetricsSinkStartupRotation(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestMetricsSinkStartupRotation", t)
+	defer os.RemoveAll(dir)
+
+	lastWrite := fakeTime().UTC().Add(-72 * time.Hour).Truncate(time.Second)
+	data := []byte(lastWrite.Format("2006-01-02 15:04:05") + " bye\n")
+	err := ioutil.WriteFile(logFile(dir), data, 0644)
+	isNil(err, t)
+
+	sink := new(bytes.Buffer)
+	l := &Logger{
+		LogPathName:       dir + string(filepath.Separator),
+		LogFileName:       "foobar",
+		LogFileSuffix:     ".log",
+		LogFileTimeFormat: "2006-01-02 15:04:05",
+		MetricsSink:       sink,
+	}
+	defer l.Close()
+	// Init moves aside the file left from days ago, which is a rotation like
+	// any other.
+	isNil(l.Init(), t)
+	backup := filepath.Join(dir, "foobar-"+lastWrite.Format(backupTimeFormat)+".log")
+	existsWithContent(backup, data, t)
+
+	var ev struct {
+		Type string `json:"type"`
+		File string `json:"file"`
+		Size int64  `json:"size"`
+	}
+	line, err := sink.ReadBytes('\n')
+	isNil(err, t)
+	isNil(json.Unmarshal(line, &ev), t)
+	equals(EventRotate, ev.Type, t)
+	equals(backup, ev.File, t)
+	equals(int64(len(data)), ev.Size, t)
+	equals(0, sink.Len(), t)
+	equals(int64(1), l.Stats().TotalRotations, t)
+}
+
+func TestLazyMill(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestLazyMill", t)
+	defer os.RemoveAll(dir)
+
+	l := &Logger{
+		fullPathFileName: logFile(dir),
+		LazyMill:         true,
+	}
+	defer l.Close()
+	_, err := l.Write([]byte("boo!"))
+	isNil(err, t)
+
+	// nothing has rotated, so the mill goroutine was never started.
+	assert(l.millCh == nil, t, "expected the mill not to be started")
+
+	newFakeTime()
+	err = l.Rotate()
+	isNil(err, t)
+	assert(l.millCh != nil, t, "expected the mill to be started by the rotation")
+}
+
+func TestThinningPolicy(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestThinningPolicy", t)
+	defer os.RemoveAll(dir)
+
+	day := fakeTime().UTC().Truncate(24 * time.Hour)
+	backupAt := func(d time.Time) string {
+		return filepath.Join(dir, "foobar-"+d.Format(backupTimeFormat)+".log")
+	}
+
+	var kept, thinned []string
+	data := []byte("data")
+	for _, daysAgo := range []int{12, 11} {
+		for h := 1; h <= 3; h++ {
+			name := backupAt(day.AddDate(0, 0, -daysAgo).Add(time.Duration(h) * time.Hour))
+			err := ioutil.WriteFile(name, data, 0644)
+			isNil(err, t)
+			if h == 3 {
+				kept = append(kept, name)
+			} else {
+				thinned = append(thinned, name)
+			}
+		}
+	}
+	// several backups from today are recent enough to all be kept.
+	for h := 1; h <= 3; h++ {
+		name := backupAt(fakeTime().UTC().Add(-time.Duration(h) * time.Minute))
+		err := ioutil.WriteFile(name, data, 0644)
+		isNil(err, t)
+		kept = append(kept, name)
+	}
+
+	l := &Logger{
+		fullPathFileName: logFile(dir),
+		ThinningPolicy:   ThinningPolicy{AfterDays: 7},
+	}
+	err := l.millRunOnce()
+	isNil(err, t)
+
+	for _, name := range kept {
+		exists(name, t)
+	}
+	for _, name := range thinned {
+		notExist(name, t)
+	}
+	fileCount(dir, len(kept), t)
+}
+
+func TestRotateReadOnlyFallback(t *testing.T) {
+	currentTime = fakeTime
+	megabyte = 1
+	osRename = func(oldpath, newpath string) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EROFS}
+	}
+	defer func() { osRename = os.Rename }()
+
+	dir := makeTempDir("TestRotateReadOnlyFallback", t)
+	defer os.RemoveAll(dir)
+
+	var handled []error
+	filename := logFile(dir)
+	l := &Logger{
+		fullPathFileName: filename,
+		LogMaxSize:       10,
+		ErrorHandler:     func(err error) { handled = append(handled, err) },
+	}
+	defer l.Close()
+	b := []byte("boo!")
+	n, err := l.Write(b)
+	isNil(err, t)
+	equals(len(b), n, t)
+
+	newFakeTime()
+
+	// this would rotate, but the rename fails, so we keep the current file.
+	b2 := []byte("foooooo!")
+	n, err = l.Write(b2)
+	isNil(err, t)
+	equals(len(b2), n, t)
+	equals(1, len(handled), t)
+
+	existsWithContent(filename, append(b, b2...), t)
+	fileCount(dir, 1, t)
+}
+
+func TestInitCreatesDir(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestInitCreatesDir", t)
+	defer os.RemoveAll(dir)
+
+	logDir := filepath.Join(dir, "a", "b")
+	l := &Logger{
+		LogPathName:   logDir + string(filepath.Separator),
+		LogFileName:   "foobar",
+		LogFileSuffix: ".log",
+		DirMode:       0700,
+	}
+	defer l.Close()
+	err := l.Init()
+	isNil(err, t)
+
+	info, err := os.Stat(logDir)
+	isNil(err, t)
+	equals(os.ModeDir|0700, info.Mode(), t)
+	// the write probe was cleaned up and no log file was created yet.
+	fileCount(logDir, 0, t)
+}
+
+func TestInitUnwritableDir(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestInitUnwritableDir", t)
+	defer os.RemoveAll(dir)
+
+	// a regular file where the log directory should be can never be written
+	// to, even by root.
+	notDir := filepath.Join(dir, "file")
+	err := ioutil.WriteFile(notDir, []byte("data"), 0644)
+	isNil(err, t)
+
+	l := &Logger{
+		LogPathName:   notDir + string(filepath.Separator),
+		LogFileName:   "foobar",
+		LogFileSuffix: ".log",
+	}
+	defer l.Close()
+	err = l.Init()
+	notNil(err, t)
+}
+
+func TestWriteAtReplay(t *testing.T) {
+	currentTime = fakeTime
+
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	times := []time.Time{
+		start,
+		start.Add(6 * time.Hour),
+		start.Add(24 * time.Hour),
+		start.Add(30 * time.Hour),
+	}
+	replay := func(name string) []string {
+		dir := makeTempDir(name, t)
+		defer os.RemoveAll(dir)
+		l := &Logger{
+			fullPathFileName: logFile(dir),
+			LogSplitDay:      1,
+		}
+		defer l.Close()
+		for _, ts := range times {
+			_, err := l.WriteAt(ts, []byte(ts.Format(time.RFC3339)+"\n"))
+			isNilUp(err, t, 1)
+		}
+
+		// time can't go backwards.
+		_, err := l.WriteAt(start, []byte("late\n"))
+		notNilUp(err, t, 1)
+
+		files, err := ioutil.ReadDir(dir)
+		isNilUp(err, t, 1)
+		var names []string
+		for _, f := range files {
+			names = append(names, f.Name())
+		}
+		return names
+	}
+
+	first := replay("TestWriteAtReplay1")
+	newFakeTime()
+	second := replay("TestWriteAtReplay2")
+
+	// one rotation at the day boundary, named after the replayed time, not
+	// the wall clock.
+	equals(2, len(first), t)
+	equals(first, second, t)
+}
+
+func TestFallbackBuffer(t *testing.T) {
+	currentTime = fakeTime
+	failing := true
+	fileWrite = func(f File, p []byte) (int, error) {
+		if failing {
+			return 0, &os.PathError{Op: "write", Path: f.Name(), Err: syscall.ENOSPC}
+		}
+		return f.Write(p)
+	}
+	defer func() { fileWrite = File.Write }()
+
+	dir := makeTempDir("TestFallbackBuffer", t)
+	defer os.RemoveAll(dir)
+
+	var handled []error
+	filename := logFile(dir)
+	l := &Logger{
+		fullPathFileName:    filename,
+		FallbackBufferBytes: 6,
+		ErrorHandler:        func(err error) { handled = append(handled, err) },
+	}
+	defer l.Close()
+
+	for _, line := range []string{"a\n", "b\n", "c\n", "d\n"} {
+		n, err := l.Write([]byte(line))
+		isNil(err, t)
+		equals(len(line), n, t)
+	}
+	// the disk is full, and the oldest line had to make room.
+	existsWithContent(filename, []byte{}, t)
+	equals(1, len(handled), t)
+
+	failing = false
+	n, err := l.Write([]byte("e\n"))
+	isNil(err, t)
+	equals(2, n, t)
+	existsWithContent(filename, []byte("b\nc\nd\ne\n"), t)
+}
+
+func TestPartialWrites(t *testing.T) {
+	currentTime = fakeTime
+	stuck := false
+	calls := 0
+	fileWrite = func(f File, p []byte) (int, error) {
+		calls++
+		if stuck {
+			return 0, nil
+		}
+		// at most 3 bytes at a time, without an error.
+		if len(p) > 3 {
+			p = p[:3]
+		}
+		return f.Write(p)
+	}
+	defer func() { fileWrite = File.Write }()
+
+	dir := makeTempDir("TestPartialWrites", t)
+	defer os.RemoveAll(dir)
+
+	filename := logFile(dir)
+	l := &Logger{fullPathFileName: filename}
+	defer l.Close()
+
+	b := []byte("boo! this is long")
+	n, err := l.Write(b)
+	isNil(err, t)
+	equals(len(b), n, t)
+	equals(6, calls, t)
+	existsWithContent(filename, b, t)
+	equals(int64(len(b)), l.size, t)
+
+	// a write that gets nowhere fails rather than spinning.
+	stuck = true
+	n, err = l.Write([]byte("foo"))
+	equals(0, n, t)
+	equals(io.ErrShortWrite, err, t)
+	existsWithContent(filename, b, t)
+}
+
+func TestBackupFileSuffix(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestBackupFileSuffix", t)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "foobar.active")
+	l := &Logger{
+		fullPathFileName:   filename,
+		BackupFileSuffix:   ".log",
+		LogMaxSaveQuantity: 1,
+	}
+	defer closeWait(l, t)
+	b := []byte("boo!")
+	_, err := l.Write(b)
+	isNil(err, t)
+	existsWithContent(filename, b, t)
+
+	newFakeTime()
+	err = l.Rotate()
+	isNil(err, t)
+	first := backupFile(dir)
+	existsWithContent(first, b, t)
+
+	b2 := []byte("foooooo!")
+	_, err = l.Write(b2)
+	isNil(err, t)
+	newFakeTime()
+	err = l.Rotate()
+	isNil(err, t)
+
+	// wait for the files to be deleted on the mill goroutine.
+	l.waitMill()
+
+	// retention recognized the first backup and removed it.
+	existsWithContent(backupFile(dir), b2, t)
+	notExist(first, t)
+	existsWithContent(filename, []byte{}, t)
+	fileCount(dir, 2, t)
+}
+
+func TestFirstFilePreamble(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestFirstFilePreamble", t)
+	defer os.RemoveAll(dir)
+
+	bom := []byte("\xef\xbb\xbf")
+	filename := logFile(dir)
+	l := &Logger{
+		fullPathFileName:  filename,
+		FirstFilePreamble: bom,
+	}
+	defer l.Close()
+	b := []byte("boo!")
+	n, err := l.Write(b)
+	isNil(err, t)
+	equals(len(b), n, t)
+	existsWithContent(filename, append(bom, b...), t)
+
+	newFakeTime()
+	err = l.Rotate()
+	isNil(err, t)
+	existsWithContent(backupFile(dir), append(bom, b...), t)
+	existsWithContent(filename, []byte{}, t)
+
+	// after a restart with backups around, the series already started.
+	l.Close()
+	err = os.Remove(filename)
+	isNil(err, t)
+	_, err = l.Write(b)
+	isNil(err, t)
+	existsWithContent(filename, b, t)
+}
+
+func TestRotateBoundary(t *testing.T) {
+	currentTime = fakeTime
+	megabyte = 1
+
+	// reopening an existing file: 6 + 4 bytes is exactly the max, so the
+	// file is appended to rather than rotated.
+	dir := makeTempDir("TestRotateBoundaryReopen", t)
+	defer os.RemoveAll(dir)
+	filename := logFile(dir)
+	start := []byte("booooo")
+	err := ioutil.WriteFile(filename, start, 0644)
+	isNil(err, t)
+	l := &Logger{
+		fullPathFileName: filename,
+		LogMaxSize:       10,
+	}
+	defer l.Close()
+	b := []byte("foo!")
+	n, rotated, err := l.WriteWithInfo(b)
+	isNil(err, t)
+	equals(len(b), n, t)
+	equals(false, rotated, t)
+	existsWithContent(filename, append(start, b...), t)
+	fileCount(dir, 1, t)
+
+	// the same boundary in steady state also doesn't rotate.
+	dir2 := makeTempDir("TestRotateBoundarySteady", t)
+	defer os.RemoveAll(dir2)
+	filename2 := logFile(dir2)
+	l2 := &Logger{
+		fullPathFileName: filename2,
+		LogMaxSize:       10,
+	}
+	defer l2.Close()
+	_, rotated, err = l2.WriteWithInfo(start)
+	isNil(err, t)
+	equals(false, rotated, t)
+	_, rotated, err = l2.WriteWithInfo(b)
+	isNil(err, t)
+	equals(false, rotated, t)
+	existsWithContent(filename2, append(start, b...), t)
+	fileCount(dir2, 1, t)
+
+	// one byte past it rotates in both.
+	newFakeTime()
+	_, rotated, err = l.WriteWithInfo([]byte("!"))
+	isNil(err, t)
+	equals(true, rotated, t)
+	_, rotated, err = l2.WriteWithInfo([]byte("!"))
+	isNil(err, t)
+	equals(true, rotated, t)
+}
+
+func TestFooter(t *testing.T) {
+	currentTime = fakeTime
+	megabyte = 1
+	defer func() { megabyte = 1024 * 1024 }()
+	dir := makeTempDir("TestFooter", t)
+	defer os.RemoveAll(dir)
+
+	footer := []byte("END\n")
+	filename := logFile(dir)
+	l := &Logger{
+		fullPathFileName: filename,
+		LogMaxSize:       10,
+		Footer:           footer,
+	}
+	defer l.Close()
+	b := []byte("boo!\n")
+	_, err := l.Write(b)
+	isNil(err, t)
+	existsWithContent(filename, b, t)
+
+	// this write goes over LogMaxSize, so the file rotates and the footer
+	// ends the backup.
+	newFakeTime()
+	b2 := []byte("foooooo!\n")
+	_, err = l.Write(b2)
+	isNil(err, t)
+	first := backupFile(dir)
+	existsWithContent(first, append(b, footer...), t)
+	existsWithContent(filename, b2, t)
+
+	newFakeTime()
+	err = l.Rotate()
+	isNil(err, t)
+	existsWithContent(backupFile(dir), append(b2, footer...), t)
+
+	// the new file is empty, so rotating it again adds no footer.
+	newFakeTime()
+	err = l.Rotate()
+	isNil(err, t)
+	existsWithContent(backupFile(dir), []byte{}, t)
+
+	err = l.Close()
+	isNil(err, t)
+	existsWithContent(filename, []byte{}, t)
+}
+
+func TestPosition(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestPosition", t)
+	defer os.RemoveAll(dir)
+
+	filename := logFile(dir)
+	l := &Logger{fullPathFileName: filename}
+	defer l.Close()
+	name, offset := l.Position()
+	equals(filename, name, t)
+	equals(int64(0), offset, t)
+
+	b := []byte("boo!")
+	_, err := l.Write(b)
+	isNil(err, t)
+	name, offset = l.Position()
+	equals(filename, name, t)
+	equals(int64(len(b)), offset, t)
+
+	_, err = l.Write(b)
+	isNil(err, t)
+	_, offset = l.Position()
+	equals(int64(2*len(b)), offset, t)
+
+	newFakeTime()
+	err = l.Rotate()
+	isNil(err, t)
+	name, offset = l.Position()
+	equals(filename, name, t)
+	equals(int64(0), offset, t)
+}
+
+func TestGenerationNaming(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestGenerationNaming", t)
+	defer os.RemoveAll(dir)
+
+	filename := logFile(dir)
+	gen := func(n int) string {
+		return filepath.Join(dir, fmt.Sprintf("foobar.%06d.log", n))
+	}
+	l := &Logger{
+		fullPathFileName:   filename,
+		GenerationNaming:   true,
+		LogMaxSaveQuantity: 2,
+	}
+	for i := 1; i <= 3; i++ {
+		_, err := l.Write([]byte{byte('0' + i)})
+		isNil(err, t)
+		err = l.Rotate()
+		isNil(err, t)
+		l.waitMill()
+	}
+	notExist(gen(1), t)
+	existsWithContent(gen(2), []byte("2"), t)
+	existsWithContent(gen(3), []byte("3"), t)
+	closeWait(l, t)
+
+	// make the newest backup look the oldest; retention must still go by
+	// generation.
+	old := time.Now().Add(-time.Hour)
+	isNil(os.Chtimes(gen(3), old, old), t)
+
+	// a new Logger continues the sequence.
+	l = &Logger{
+		fullPathFileName:   filename,
+		GenerationNaming:   true,
+		LogMaxSaveQuantity: 2,
+	}
+	defer closeWait(l, t)
+	_, err := l.Write([]byte("4"))
+	isNil(err, t)
+	err = l.Rotate()
+	isNil(err, t)
+	l.waitMill()
+	notExist(gen(2), t)
+	existsWithContent(gen(3), []byte("3"), t)
+	existsWithContent(gen(4), []byte("4"), t)
+
+	// losing the record resumes after the highest backup on disk.
+	isNil(os.Remove(filepath.Join(dir, ".foobar.log.generation")), t)
+	_, err = l.Write([]byte("5"))
+	isNil(err, t)
+	err = l.Rotate()
+	isNil(err, t)
+	existsWithContent(gen(5), []byte("5"), t)
+}
+
+func TestTargetFile(t *testing.T) {
+	currentTime = fakeTime
+	megabyte = 1
+	defer func() { megabyte = 1024 * 1024 }()
+	dir := makeTempDir("TestTargetFile", t)
+	defer os.RemoveAll(dir)
+
+	filename := logFile(dir)
+	l := &Logger{
+		fullPathFileName: filename,
+		LogMaxSize:       10,
+	}
+	defer l.Close()
+
+	// nothing open yet, and the file doesn't exist.
+	name, willRotate := l.TargetFile(10)
+	equals(filename, name, t)
+	equals(false, willRotate, t)
+
+	b := []byte("boo!")
+	_, err := l.Write(b)
+	isNil(err, t)
+
+	name, willRotate = l.TargetFile(6)
+	equals(filename, name, t)
+	equals(false, willRotate, t)
+	name, willRotate = l.TargetFile(7)
+	equals(filename, name, t)
+	equals(true, willRotate, t)
+
+	// predicting doesn't write or rotate.
+	existsWithContent(filename, b, t)
+	fileCount(dir, 1, t)
+
+	// a reopened file is judged by its size on disk.
+	isNil(l.Close(), t)
+	_, willRotate = l.TargetFile(7)
+	equals(true, willRotate, t)
+}
+
+func BenchmarkWriteSplitDay(b *testing.B) {
+	currentTime = time.Now
+	defer func() { currentTime = fakeTime }()
+	dir := makeTempDir("BenchmarkWriteSplitDay", b)
+	defer os.RemoveAll(dir)
+
+	l := &Logger{
+		LogPathName:   dir + string(filepath.Separator),
+		LogFileName:   "foobar",
+		LogFileSuffix: ".log",
+		LogSplitDay:   1,
+		Timezone:      "Asia/Shanghai",
+	}
+	if err := l.Init(); err != nil {
+		b.Fatal(err)
+	}
+	defer l.Close()
+	line := []byte(strings.Repeat("x", 99) + "\n")
+	b.SetBytes(int64(len(line)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Write(line)
+	}
+}
+
+func TestBeforeRotate(t *testing.T) {
+	currentTime = fakeTime
+	megabyte = 1
+	defer func() { megabyte = 1024 * 1024 }()
+	dir := makeTempDir("TestBeforeRotate", t)
+	defer os.RemoveAll(dir)
+
+	filename := logFile(dir)
+	proceed := false
+	var reasons []RotateReason
+	l := &Logger{
+		fullPathFileName: filename,
+		LogMaxSize:       10,
+		BeforeRotate: func(reason RotateReason) bool {
+			reasons = append(reasons, reason)
+			return proceed
+		},
+	}
+	defer l.Close()
+	b := []byte("boo!")
+	_, err := l.Write(b)
+	isNil(err, t)
+
+	// crossing the size threshold with the hook refusing keeps writing to
+	// the same file.
+	b2 := []byte("foooooo!")
+	_, err = l.Write(b2)
+	isNil(err, t)
+	existsWithContent(filename, append(b, b2...), t)
+	fileCount(dir, 1, t)
+	equals([]RotateReason{RotateSize}, reasons, t)
+
+	// a refused Rotate is not an error.
+	err = l.Rotate()
+	isNil(err, t)
+	fileCount(dir, 1, t)
+
+	// so is reopening a file that is already too big.
+	isNil(l.Close(), t)
+	_, err = l.Write(b)
+	isNil(err, t)
+	existsWithContent(filename, append(append(b, b2...), b...), t)
+	equals([]RotateReason{RotateSize, RotateManual, RotateSize}, reasons, t)
+
+	proceed = true
+	newFakeTime()
+	_, err = l.Write(b2)
+	isNil(err, t)
+	existsWithContent(backupFile(dir), append(append(b, b2...), b...), t)
+	existsWithContent(filename, b2, t)
+	equals("size", RotateSize.String(), t)
+}
+
+func TestCountLinesOnRotate(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestCountLinesOnRotate", t)
+	defer os.RemoveAll(dir)
+
+	sink := new(bytes.Buffer)
+	l := &Logger{
+		fullPathFileName:   logFile(dir),
+		MetricsSink:        sink,
+		CountLinesOnRotate: true,
+	}
+	defer l.Close()
+
+	var ev struct {
+		Lines *int64 `json:"lines"`
+	}
+	for _, count := range []int{3, 0, 1} {
+		for i := 0; i < count; i++ {
+			_, err := l.Write([]byte("a record\n"))
+			isNil(err, t)
+		}
+		// an unterminated record isn't counted.
+		_, err := l.Write([]byte("partial"))
+		isNil(err, t)
+
+		newFakeTime()
+		err = l.Rotate()
+		isNil(err, t)
+		line, err := sink.ReadBytes('\n')
+		isNil(err, t)
+		err = json.Unmarshal(line, &ev)
+		isNil(err, t)
+		notNil(ev.Lines, t)
+		equals(int64(count), *ev.Lines, t)
+	}
+}
+
+func TestMillBatchSize(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestMillBatchSize", t)
+	defer os.RemoveAll(dir)
+
+	var backups []string
+	for i := 0; i < 10; i++ {
+		newFakeTime()
+		name := backupFile(dir)
+		err := ioutil.WriteFile(name, []byte("data"), 0644)
+		isNil(err, t)
+		backups = append(backups, name)
+	}
+
+	l := &Logger{
+		fullPathFileName:   logFile(dir),
+		Compress:           true,
+		LogMaxSaveQuantity: 8,
+		MillBatchSize:      3,
+	}
+	defer closeWait(l, t)
+
+	// the first pass removes the two oldest and compresses one.
+	err := l.millRunOnce()
+	isNil(err, t)
+	notExist(backups[0], t)
+	notExist(backups[1], t)
+	compressed := 0
+	for _, name := range backups[2:] {
+		if _, err := os.Stat(name + compressSuffix); err == nil {
+			compressed++
+		}
+	}
+	equals(1, compressed, t)
+
+	// the passes it triggered take care of the rest.
+	l.waitMill()
+	for _, name := range backups[2:] {
+		notExist(name, t)
+		exists(name+compressSuffix, t)
+	}
+	fileCount(dir, 8, t)
+}
+
+func TestMaxSizePercentFree(t *testing.T) {
+	currentTime = fakeTime
+	free := uint64(1000)
+	diskFree = func(string) (uint64, error) { return free, nil }
+	defer func() { diskFree = realDiskFree }()
+	dir := makeTempDir("TestMaxSizePercentFree", t)
+	defer os.RemoveAll(dir)
+
+	filename := logFile(dir)
+	l := &Logger{
+		fullPathFileName:   filename,
+		MaxSizePercentFree: 10,
+	}
+	defer l.Close()
+
+	// 10% of 1000 bytes free.
+	b := make([]byte, 60)
+	_, err := l.Write(b)
+	isNil(err, t)
+	_, err = l.Write(b[:40])
+	isNil(err, t)
+	existsWithContent(filename, make([]byte, 100), t)
+
+	// the limit holds until the next rotation, however the free space
+	// changes.
+	free = 5000
+	newFakeTime()
+	_, err = l.Write(b[:1])
+	isNil(err, t)
+	existsWithContent(backupFile(dir), make([]byte, 100), t)
+
+	// and is worked out anew for the new file.
+	_, err = l.Write(make([]byte, 499))
+	isNil(err, t)
+	existsWithContent(filename, make([]byte, 500), t)
+
+	// an explicit LogMaxSize wins.
+	l.LogMaxSize = 1
+	equals(int64(megabyte), l.max(), t)
+}
+
+func TestRetentionTimeSource(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestRetentionTimeSource", t)
+	defer os.RemoveAll(dir)
+
+	// one backup named four days ago but written just now, as if restored,
+	// and one named now but last written four days ago, as if the clock was
+	// wrong.
+	restored := backupFile(dir)
+	newFakeTime()
+	newFakeTime()
+	skewed := backupFile(dir)
+	old := fakeTime().Add(-4 * 24 * time.Hour)
+	setup := func() {
+		for name, content := range map[string]string{restored: "restored", skewed: "skewed"} {
+			err := ioutil.WriteFile(name, []byte(content), 0644)
+			isNil(err, t)
+		}
+		err := os.Chtimes(restored, fakeTime(), fakeTime())
+		isNil(err, t)
+		err = os.Chtimes(skewed, old, old)
+		isNil(err, t)
+	}
+
+	setup()
+	l := &Logger{
+		fullPathFileName: logFile(dir),
+		LogMaxSaveDay:    1,
+	}
+	err := l.millRunOnce()
+	isNil(err, t)
+	notExist(restored, t)
+	existsWithContent(skewed, []byte("skewed"), t)
+
+	setup()
+	l.RetentionTimeSource = ModTime
+	err = l.millRunOnce()
+	isNil(err, t)
+	existsWithContent(restored, []byte("restored"), t)
+	notExist(skewed, t)
+
+	l.RetentionTimeSource = 2
+	notNil(l.Validate(), t)
+}
+
+func TestRetentionGracePeriod(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestRetentionGracePeriod", t)
+	defer os.RemoveAll(dir)
+
+	older := backupFile(dir)
+	err := ioutil.WriteFile(older, []byte("older"), 0644)
+	isNil(err, t)
+	newFakeTime()
+	newer := backupFile(dir)
+	err = ioutil.WriteFile(newer, []byte("newer"), 0644)
+	isNil(err, t)
+	// the shipper is still reading the older one.
+	for _, name := range []string{older, newer} {
+		err = os.Chtimes(name, fakeTime(), fakeTime().Add(-time.Minute))
+		isNil(err, t)
+	}
+
+	l := &Logger{
+		fullPathFileName:     logFile(dir),
+		LogMaxSaveQuantity:   1,
+		RetentionGracePeriod: time.Hour,
+	}
+	err = l.millRunOnce()
+	isNil(err, t)
+	exists(older, t)
+	exists(newer, t)
+
+	fakeCurrentTime = fakeCurrentTime.Add(time.Hour)
+	err = l.millRunOnce()
+	isNil(err, t)
+	notExist(older, t)
+	exists(newer, t)
+}
+
+func TestInitReturnsErrors(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestInitReturnsErrors", t)
+	defer os.RemoveAll(dir)
+
+	// a file where the log directory should be.
+	logDir := filepath.Join(dir, "logs")
+	err := ioutil.WriteFile(logDir, []byte("not a directory"), 0644)
+	isNil(err, t)
+	newLogger := func() *Logger {
+		return &Logger{
+			LogPathName:       logDir + string(filepath.Separator),
+			LogFileName:       "foobar",
+			LogFileSuffix:     ".log",
+			LogFileTimeFormat: "2006-01-02 15:04:05",
+		}
+	}
+	l := newLogger()
+	defer l.Close()
+	err = l.Init()
+	notNil(err, t)
+	assert(!errors.Is(err, ErrPathInUse), t, "expected a directory error, got %v", err)
+
+	// nor does the failed one keep the name.
+	m := newLogger()
+	defer m.Close()
+	defer func() {
+		err, _ := recover().(error)
+		notNil(err, t)
+		assert(!errors.Is(err, ErrPathInUse), t, "expected a directory error, got %v", err)
+	}()
+	m.MustInit()
+	t.Fatal("MustInit didn't panic")
+}
+
+func TestInitUnreadableLogFile(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestInitUnreadableLogFile", t)
+	defer os.RemoveAll(dir)
+
+	// a directory where the log file should be can't be read.
+	err := os.Mkdir(logFile(dir), 0755)
+	isNil(err, t)
+	var errs []error
+	l := &Logger{
+		LogPathName:       dir + string(filepath.Separator),
+		LogFileName:       "foobar",
+		LogFileSuffix:     ".log",
+		LogFileTimeFormat: "2006-01-02 15:04:05",
+		ErrorHandler:      func(err error) { errs = append(errs, err) },
+	}
+	defer l.Close()
+	err = l.Init()
+	isNil(err, t)
+	equals(1, len(errs), t)
+	exists(logFile(dir), t)
+	fileCount(dir, 1, t)
+}
+
+func TestReadLastLine(t *testing.T) {
+	dir := makeTempDir("TestReadLastLine", t)
+	defer os.RemoveAll(dir)
+
+	readLast := func(name string) (string, error) {
+		f, err := os.Open(name)
+		isNilUp(err, t, 1)
+		defer f.Close()
+		return readLastLine(f)
+	}
+	long := strings.Repeat("x", 3*lastLineChunkSize)
+	blanks := strings.Repeat("\r\n", lastLineChunkSize)
+	for content, want := range map[string]string{
+		"":                            "",
+		" \n\n \t\n":                  "",
+		"first\nlast\n\n  \n":         "last",
+		"only":                        "only",
+		"only\n":                      "only",
+		"  only  \n\n":                "only",
+		"first\r\nlast\r\n":           "last",
+		"first\r\nlast\r\n\r\n \r\n":  "last",
+		"first\rlast\r":               "last",
+		"first\n" + long + "\n":       long,
+		"first\n" + long:              long,
+		"first\nlast" + blanks:        "last",
+		long + "\nlast\n" + blanks:    "last",
+		"\n\nfirst\n\n\n" + blanks:    "first",
+		"2024-06-01 10:00:00 a\r\n\n": "2024-06-01 10:00:00 a",
+	} {
+		name := filepath.Join(dir, "last.log")
+		err := ioutil.WriteFile(name, []byte(content), 0644)
+		isNil(err, t)
+		line, err := readLast(name)
+		isNil(err, t)
+		equals(want, line, t)
+	}
+
+	_, err := (&Logger{}).lastLine(filepath.Join(dir, "missing.log"))
+	notNil(err, t)
+
+	// a last line past maxLastLineLength isn't read whole.
+	name := filepath.Join(dir, "long.log")
+	err = ioutil.WriteFile(name, []byte("first\n"+strings.Repeat("x", maxLastLineLength+1)+"\n"), 0644)
+	isNil(err, t)
+	_, err = readLast(name)
+	equals(errNoTimestamp, err, t)
+}
+
+func TestEmptyWrite(t *testing.T) {
+	currentTime = fakeTime
+	megabyte = 1
+	dir := makeTempDir("TestEmptyWrite", t)
+	defer os.RemoveAll(dir)
+
+	l := &Logger{
+		LogPathName:   dir + string(filepath.Separator),
+		LogFileName:   "foobar",
+		LogFileSuffix: ".log",
+		LogMaxSize:    4,
+		LogSplitDay:   1,
+	}
+	defer l.Close()
+	err := l.Init()
+	isNil(err, t)
+	for _, p := range [][]byte{nil, {}} {
+		n, err := l.Write(p)
+		isNil(err, t)
+		equals(0, n, t)
+		_, rotated, err := l.WriteWithInfo(p)
+		isNil(err, t)
+		equals(false, rotated, t)
+	}
+	fileCount(dir, 0, t)
+
+	b := []byte("boo!")
+	_, err = l.Write(b)
+	isNil(err, t)
+	// neither a full file nor the next day makes an empty write rotate.
+	newFakeTime()
+	_, rotated, err := l.WriteWithInfo(nil)
+	isNil(err, t)
+	equals(false, rotated, t)
+	_, err = l.Write(nil)
+	isNil(err, t)
+	existsWithContent(logFile(dir), b, t)
+	fileCount(dir, 1, t)
+}
+
+func TestPrune(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestPrune", t)
+	defer os.RemoveAll(dir)
+
+	var backups []string
+	for i := 0; i < 3; i++ {
+		err := ioutil.WriteFile(backupFile(dir), []byte("old"), 0644)
+		isNil(err, t)
+		backups = append(backups, backupFile(dir))
+		newFakeTime()
+	}
+	l := &Logger{
+		fullPathFileName:   logFile(dir),
+		LogMaxSaveQuantity: 2,
+		Compress:           true,
+	}
+	defer closeWait(l, t)
+
+	err := l.Prune()
+	isNil(err, t)
+	notExist(backups[0], t)
+	exists(backups[1]+compressSuffix, t)
+	exists(backups[2]+compressSuffix, t)
+	fileCount(dir, 2, t)
+
+	// while paused, it waits for Resume.
+	err = ioutil.WriteFile(backupFile(dir), []byte("new"), 0644)
+	isNil(err, t)
+	l.Pause()
+	err = l.Prune()
+	isNil(err, t)
+	fileCount(dir, 3, t)
+	err = l.Resume()
+	isNil(err, t)
+	l.waitMill()
+	notExist(backups[1]+compressSuffix, t)
+	exists(backupFile(dir)+compressSuffix, t)
+	fileCount(dir, 2, t)
+}
+
+func TestLogSplitHour(t *testing.T) {
+	currentTime = fakeTime
+	defer func(t time.Time) { fakeCurrentTime = t }(fakeCurrentTime)
+	fakeCurrentTime = time.Date(2021, 3, 4, 10, 20, 0, 0, time.UTC)
+	megabyte = 1
+	dir := makeTempDir("TestLogSplitHour", t)
+	defer os.RemoveAll(dir)
+
+	l := &Logger{
+		fullPathFileName: logFile(dir),
+		LogSplitHour:     1,
+		LogMaxSize:       12,
+	}
+	defer l.Close()
+	write := func(s string) bool {
+		_, rotated, err := l.WriteWithInfo([]byte(s))
+		isNilUp(err, t, 1)
+		return rotated
+	}
+	equals(false, write("a\n"), t)
+	fakeCurrentTime = fakeCurrentTime.Add(39 * time.Minute)
+	equals(false, write("b\n"), t)
+	_, willRotate := l.TargetFile(2)
+	equals(false, willRotate, t)
+
+	// on the hour, not an hour after the first write.
+	fakeCurrentTime = fakeCurrentTime.Add(time.Minute)
+	_, willRotate = l.TargetFile(2)
+	equals(true, willRotate, t)
+	equals(true, write("c\n"), t)
+	existsWithContent(backupFile(dir), []byte("a\nb\n"), t)
+
+	// size still rotates, and the hours count from the new file.
+	fakeCurrentTime = fakeCurrentTime.Add(30 * time.Minute)
+	equals(false, write("dddd\n"), t)
+	equals(true, write("eeeeeeee\n"), t)
+	existsWithContent(backupFile(dir), []byte("c\ndddd\n"), t)
+	fakeCurrentTime = fakeCurrentTime.Add(20 * time.Minute)
+	equals(false, write("f\n"), t)
+	fakeCurrentTime = fakeCurrentTime.Add(10 * time.Minute)
+	equals(true, write("g\n"), t)
+	existsWithContent(backupFile(dir), []byte("eeeeeeee\nf\n"), t)
+	existsWithContent(logFile(dir), []byte("g\n"), t)
+}
+
+func TestSyncEveryNLines(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestSyncEveryNLines", t)
+	defer os.RemoveAll(dir)
+
+	syncs := 0
+	fileSync = func(f File) error {
+		syncs++
+		return f.Sync()
+	}
+	defer func() { fileSync = File.Sync }()
+
+	l := &Logger{
+		fullPathFileName: logFile(dir),
+		SyncEveryNLines:  3,
+		UnlockedAppend:   true,
+	}
+	defer l.Close()
+	write := func(s string) {
+		_, err := l.Write([]byte(s))
+		isNilUp(err, t, 1)
+	}
+	write("one\ntwo\n")
+	equals(0, syncs, t)
+	write("three")
+	equals(0, syncs, t)
+	write(" and a half\nfour\n")
+	equals(1, syncs, t)
+	write("five\nsix\nseven\n")
+	equals(2, syncs, t)
+
+	// a new file starts counting afresh.
+	write("eight\n")
+	err := l.Rotate()
+	isNil(err, t)
+	write("nine\nten\n")
+	equals(2, syncs, t)
+	write("eleven\n")
+	equals(3, syncs, t)
+}
+
+func TestBackupTimeFormat(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestBackupTimeFormat", t)
+	defer os.RemoveAll(dir)
+
+	dated := func() string {
+		return filepath.Join(dir, "foobar-"+fakeTime().UTC().Format("2006-01-02")+".log")
+	}
+	l := &Logger{
+		fullPathFileName:   logFile(dir),
+		BackupTimeFormat:   "2006-01-02",
+		LogMaxSaveQuantity: 2,
+	}
+	defer closeWait(l, t)
+
+	var backups []string
+	for i := 0; i < 3; i++ {
+		_, err := l.Write([]byte("boo!"))
+		isNil(err, t)
+		newFakeTime()
+		backups = append(backups, dated())
+		err = l.Rotate()
+		isNil(err, t)
+		existsWithContent(dated(), []byte("boo!"), t)
+		notExist(backupFile(dir), t)
+	}
+
+	// wait for the files to be removed on the mill goroutine.
+	l.waitMill()
+
+	// retention finds the backups by the same layout.
+	notExist(backups[0], t)
+	exists(backups[1], t)
+	exists(backups[2], t)
+	files, err := l.oldLogFiles()
+	isNil(err, t)
+	equals(2, len(files), t)
+	equals(backups[2], filepath.Join(dir, files[0].Name()), t)
+
+	for _, layout := range []string{"daily", "2006/01/02"} {
+		l := &Logger{fullPathFileName: logFile(dir), BackupTimeFormat: layout}
+		notNil(l.Validate(), t)
+	}
+}
+
+func TestBackupTimeSeparator(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestBackupTimeSeparator", t)
+	defer os.RemoveAll(dir)
+
+	dated := func() string {
+		return filepath.Join(dir, "foobar."+fakeTime().UTC().Format("2006-01-02")+".log")
+	}
+	l := &Logger{
+		fullPathFileName:    logFile(dir),
+		BackupTimeFormat:    "2006-01-02",
+		BackupTimeSeparator: ".",
+	}
+	defer l.Close()
+
+	var backups []string
+	for i := 0; i < 2; i++ {
+		_, err := l.Write([]byte("boo!"))
+		isNil(err, t)
+		newFakeTime()
+		backups = append(backups, dated())
+		err = l.Rotate()
+		isNil(err, t)
+		existsWithContent(dated(), []byte("boo!"), t)
+	}
+
+	// retention finds the backups by the same separator.
+	pruner := &Logger{
+		fullPathFileName:    logFile(dir),
+		BackupTimeFormat:    "2006-01-02",
+		BackupTimeSeparator: ".",
+		LogMaxSaveQuantity:  1,
+	}
+	err := pruner.Prune()
+	isNil(err, t)
+	notExist(backups[0], t)
+	exists(backups[1], t)
+
+	l = &Logger{fullPathFileName: logFile(dir), BackupTimeSeparator: "a/b"}
+	notNil(l.Validate(), t)
+}
+
+func TestLogMaxTotalSize(t *testing.T) {
+	currentTime = fakeTime
+	megabyte = 1
+	dir := makeTempDir("TestLogMaxTotalSize", t)
+	defer os.RemoveAll(dir)
+
+	var backups []string
+	for i := 0; i < 4; i++ {
+		err := ioutil.WriteFile(backupFile(dir), []byte("old!"), 0644)
+		isNil(err, t)
+		backups = append(backups, backupFile(dir))
+		newFakeTime()
+	}
+	err := ioutil.WriteFile(logFile(dir), []byte("new"), 0644)
+	isNil(err, t)
+
+	// 3 bytes of log file and two backups of 4 fit in 11.
+	l := &Logger{
+		fullPathFileName: logFile(dir),
+		LogMaxTotalSize:  11,
+	}
+	err = l.millRunOnce()
+	isNil(err, t)
+	notExist(backups[0], t)
+	notExist(backups[1], t)
+	exists(backups[2], t)
+	exists(backups[3], t)
+
+	// the cap applies to what the other rules keep.
+	l.LogMaxTotalSize = 100
+	l.LogMaxSaveQuantity = 1
+	err = l.millRunOnce()
+	isNil(err, t)
+	notExist(backups[2], t)
+	exists(backups[3], t)
+
+	// the log file alone can be over the cap.
+	l.LogMaxTotalSize = 2
+	err = l.millRunOnce()
+	isNil(err, t)
+	notExist(backups[3], t)
+	existsWithContent(logFile(dir), []byte("new"), t)
+}
+
+func TestMinFreeDiskMB(t *testing.T) {
+	currentTime = fakeTime
+	megabyte = 1
+	dir := makeTempDir("TestMinFreeDiskMB", t)
+	defer os.RemoveAll(dir)
+
+	// a 40 byte disk holding only the log directory.
+	diskFree = func(string) (uint64, error) {
+		files, err := ioutil.ReadDir(dir)
+		isNilUp(err, t, 1)
+		used := int64(0)
+		for _, f := range files {
+			used += f.Size()
+		}
+		return uint64(40 - used), nil
+	}
+	defer func() { diskFree = realDiskFree }()
+
+	var backups []string
+	for i := 0; i < 3; i++ {
+		err := ioutil.WriteFile(backupFile(dir), make([]byte, 10), 0644)
+		isNil(err, t)
+		backups = append(backups, backupFile(dir))
+		newFakeTime()
+	}
+	l := &Logger{
+		fullPathFileName: logFile(dir),
+		MinFreeDiskMB:    10,
+	}
+	defer l.Close()
+
+	// 10 bytes are free, so the write needs the oldest backup gone.
+	_, err := l.Write([]byte("hello"))
+	isNil(err, t)
+	existsWithContent(logFile(dir), []byte("hello"), t)
+	notExist(backups[0], t)
+	exists(backups[1], t)
+	exists(backups[2], t)
+
+	// with every backup gone there still isn't room.
+	_, err = l.Write(make([]byte, 26))
+	notNil(err, t)
+	assert(errors.Is(err, ErrLowDiskSpace), t, "expected ErrLowDiskSpace, got %v", err)
+	notExist(backups[1], t)
+	notExist(backups[2], t)
+	existsWithContent(logFile(dir), []byte("hello"), t)
+
+	_, err = l.Write(make([]byte, 25))
+	isNil(err, t)
+}
+
+func TestMinFreeDiskMBCached(t *testing.T) {
+	currentTime = fakeTime
+	megabyte = 1
+	defer func() { megabyte = 1024 * 1024 }()
+	dir := makeTempDir("TestMinFreeDiskMBCached", t)
+	defer os.RemoveAll(dir)
+
+	checks := 0
+	diskFree = func(string) (uint64, error) {
+		checks++
+		return 100, nil
+	}
+	defer func() { diskFree = realDiskFree }()
+	l := &Logger{
+		fullPathFileName: logFile(dir),
+		MinFreeDiskMB:    10,
+	}
+	defer l.Close()
+
+	// writes go by the free space found by the first until a second has
+	// passed...
+	for i := 0; i < 3; i++ {
+		_, err := l.Write(make([]byte, 20))
+		isNil(err, t)
+	}
+	equals(1, checks, t)
+	fakeCurrentTime = fakeCurrentTime.Add(freeSpaceCheckInterval)
+	_, err := l.Write(make([]byte, 20))
+	isNil(err, t)
+	equals(2, checks, t)
+
+	// or they would use up what it left.
+	_, err = l.Write(make([]byte, 75))
+	isNil(err, t)
+	equals(3, checks, t)
+}
+
+func TestRetentionOrder(t *testing.T) {
+	for _, order := range []RetentionOrder{RemoveThenCompress, CompressThenRemove} {
+		currentTime = fakeTime
+		megabyte = 1
+		dir := makeTempDir("TestRetentionOrder", t)
+
+		// writeBackups writes n backups of 1000 bytes that compress to a
+		// few dozen.
+		writeBackups := func(n int) []string {
+			var names []string
+			for i := 0; i < n; i++ {
+				newFakeTime()
+				err := ioutil.WriteFile(backupFile(dir), bytes.Repeat([]byte("abcd"), 250), 0644)
+				isNil(err, t)
+				names = append(names, backupFile(dir))
+			}
+			return names
+		}
+		var events bytes.Buffer
+		l := &Logger{
+			fullPathFileName: logFile(dir),
+			Compress:         true,
+			LogMaxTotalSize:  2500,
+			RetentionOrder:   order,
+			MetricsSink:      &events,
+		}
+		backups := writeBackups(4)
+		err := l.millRunOnce()
+		isNil(err, t)
+		compressed := strings.Count(events.String(), `"type":"compress"`)
+
+		if order == RemoveThenCompress {
+			// nothing has been compressed yet to estimate with, so only two
+			// of the backups fit, and the two removed aren't compressed
+			// first.
+			equals(2, compressed, t)
+			for _, name := range backups[:2] {
+				notExist(name, t)
+				notExist(name+compressSuffix, t)
+			}
+			for _, name := range backups[2:] {
+				exists(name+compressSuffix, t)
+			}
+
+			// now the backups to compress are counted at their estimated
+			// compressed size.
+			backups = writeBackups(4)
+			err = l.millRunOnce()
+			isNil(err, t)
+			equals(6, strings.Count(events.String(), `"type":"compress"`), t)
+			equals(2, strings.Count(events.String(), `"type":"remove"`), t)
+			for _, name := range backups {
+				exists(name+compressSuffix, t)
+			}
+		} else {
+			// every backup is compressed, and then they all fit.
+			equals(4, compressed, t)
+			for _, name := range backups {
+				exists(name+compressSuffix, t)
+			}
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestSync(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestSync", t)
+	defer os.RemoveAll(dir)
+
+	syncs := 0
+	fileSync = func(f File) error {
+		syncs++
+		return f.Sync()
+	}
+	defer func() { fileSync = File.Sync }()
+
+	l := &Logger{
+		fullPathFileName: logFile(dir),
+		BufferSize:       100,
+	}
+	defer l.Close()
+	// nothing is open yet.
+	isNil(l.Sync(), t)
+	equals(0, syncs, t)
+
+	_, err := l.Write([]byte("boo!"))
+	isNil(err, t)
+	existsWithContent(logFile(dir), []byte{}, t)
+	err = l.Sync()
+	isNil(err, t)
+	equals(1, syncs, t)
+	existsWithContent(logFile(dir), []byte("boo!"), t)
+
+	fileSync = func(File) error { return errors.New("sync failed") }
+	notNil(l.Sync(), t)
+}
+
+func TestDayRolloverAt(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestDayRolloverAt", t)
+	defer os.RemoveAll(dir)
+
+	l := &Logger{
+		fullPathFileName: logFile(dir),
+		LogSplitDay:      1,
+		DayRolloverAt:    "06:00:00",
+	}
+	defer l.Close()
+	start := time.Date(2020, 1, 2, 5, 0, 0, 0, time.UTC)
+	for _, ts := range []time.Time{start, start.Add(59*time.Minute + 59*time.Second)} {
+		_, err := l.WriteAt(ts, []byte("boo!"))
+		isNil(err, t)
+	}
+	// midnight didn't split the day, and nor did the last second before the
+	// rollover.
+	fileCount(dir, 1, t)
+	equals(time.Date(2020, 1, 1, 5, 59, 59, 0, time.UTC).Unix(), l.yesterdayLastTimestamp, t)
+
+	_, err := l.WriteAt(start.Add(time.Hour), []byte("foo"))
+	isNil(err, t)
+	backup := filepath.Join(dir, "foobar-"+start.Add(time.Hour-time.Second).Format(backupTimeFormat)+".log")
+	existsWithContent(backup, []byte("boo!boo!"), t)
+	existsWithContent(logFile(dir), []byte("foo"), t)
+	equals(time.Date(2020, 1, 2, 5, 59, 59, 0, time.UTC).Unix(), l.yesterdayLastTimestamp, t)
+
+	// the next midnight doesn't split it either.
+	_, err = l.WriteAt(time.Date(2020, 1, 3, 0, 30, 0, 0, time.UTC), []byte("bar"))
+	isNil(err, t)
+	fileCount(dir, 2, t)
+	existsWithContent(logFile(dir), []byte("foobar"), t)
+
+	l.DayRolloverAt = "6am"
+	notNil(l.Validate(), t)
+}
+
+func TestSameSecondRotations(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestSameSecondRotations", t)
+	defer os.RemoveAll(dir)
+
+	l := &Logger{fullPathFileName: logFile(dir)}
+	defer closeWait(l, t)
+	// three rotations in the same second keep every backup.
+	for _, s := range []string{"one", "two", "three"} {
+		_, err := l.Write([]byte(s))
+		isNil(err, t)
+		err = l.Rotate()
+		isNil(err, t)
+	}
+	stem := strings.TrimSuffix(backupFile(dir), ".log")
+	existsWithContent(backupFile(dir), []byte("one"), t)
+	existsWithContent(stem+"-1.log", []byte("two"), t)
+	existsWithContent(stem+"-2.log", []byte("three"), t)
+
+	// the counter orders them, newest first.
+	files, err := l.oldLogFiles()
+	isNil(err, t)
+	equals(3, len(files), t)
+	equals(filepath.Base(stem+"-2.log"), files[0].Name(), t)
+	equals(filepath.Base(stem+"-1.log"), files[1].Name(), t)
+	equals(filepath.Base(backupFile(dir)), files[2].Name(), t)
+	pruner := &Logger{
+		fullPathFileName:   logFile(dir),
+		LogMaxSaveQuantity: 2,
+	}
+	err = pruner.Prune()
+	isNil(err, t)
+	notExist(backupFile(dir), t)
+	exists(stem+"-2.log", t)
+
+	cdir := makeTempDir("TestSameSecondRotationsCompressed", t)
+	defer os.RemoveAll(cdir)
+	compressed := make(chan string, 2)
+	cl := &Logger{
+		fullPathFileName: logFile(cdir),
+		Compress:         true,
+		OnCompress: func(path string, _, _ int64) {
+			compressed <- path
+		},
+	}
+	defer closeWait(cl, t)
+	// with Compress, the second rotation doesn't reuse the name of the
+	// first's backup, already compressed, and so doesn't overwrite it.
+	for _, s := range []string{"one", "two"} {
+		_, err := cl.Write([]byte(s))
+		isNil(err, t)
+		err = cl.Rotate()
+		isNil(err, t)
+		select {
+		case path := <-compressed:
+			// OnCompress comes before the backup is removed.
+			waitNotExist(strings.TrimSuffix(path, compressSuffix), t)
+		case <-time.After(5 * time.Second):
+			t.Fatal("backup not compressed")
+		}
+	}
+	stem = strings.TrimSuffix(backupFile(cdir), ".log")
+	for name, content := range map[string]string{
+		stem + ".log" + compressSuffix:   "one",
+		stem + "-1.log" + compressSuffix: "two",
+	} {
+		bc := new(bytes.Buffer)
+		gz := gzip.NewWriter(bc)
+		_, err := gz.Write([]byte(content))
+		isNil(err, t)
+		isNil(gz.Close(), t)
+		existsWithContent(name, bc.Bytes(), t)
+	}
+}
+
+func TestSplitDayPerLogger(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestSplitDayPerLogger", t)
+	defer os.RemoveAll(dir)
+
+	utc := &Logger{
+		fullPathFileName: filepath.Join(dir, "utc.log"),
+		LogSplitDay:      1,
+	}
+	defer utc.Close()
+	kathmandu := &Logger{
+		fullPathFileName: filepath.Join(dir, "kathmandu.log"),
+		LogSplitDay:      1,
+		Timezone:         "Asia/Kathmandu",
+	}
+	defer kathmandu.Close()
+
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	_, err := utc.WriteAt(start, []byte("boo!"))
+	isNil(err, t)
+	// the other Logger starting its day, in its own zone, doesn't move this
+	// one's.
+	_, err = kathmandu.WriteAt(start.Add(8*time.Hour), []byte("foo"))
+	isNil(err, t)
+	_, err = utc.WriteAt(start.Add(12*time.Hour+30*time.Minute), []byte("bar"))
+	isNil(err, t)
+	existsWithContent(filepath.Join(dir, "utc-2020-01-01T23-59-59.log"), []byte("boo!"), t)
+	existsWithContent(filepath.Join(dir, "utc.log"), []byte("bar"), t)
+	existsWithContent(filepath.Join(dir, "kathmandu.log"), []byte("foo"), t)
+	fileCount(dir, 3, t)
+}
+
+func TestConcurrentLoggersLocalTime(t *testing.T) {
+	currentTime = fakeTime
+	saved := time.Local
+	time.Local = time.FixedZone("UTC+8", 8*60*60)
+	defer func() { time.Local = saved }()
+	dir := makeTempDir("TestConcurrentLoggersLocalTime", t)
+	defer os.RemoveAll(dir)
+
+	const days = 20
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	run := func(l *Logger, nextDay time.Duration, done chan<- error) {
+		defer l.Close()
+		for i := 0; i < days; i++ {
+			day := start.Add(time.Duration(i) * 24 * time.Hour)
+			for _, ts := range []time.Time{day, day.Add(nextDay)} {
+				if _, err := l.WriteAt(ts, []byte(ts.Format(time.RFC3339)+"\n")); err != nil {
+					done <- err
+					return
+				}
+			}
+		}
+		done <- nil
+	}
+	done := make(chan error, 2)
+	// 12:00 UTC is 20:00 local, so five hours on is the next local day but
+	// not yet the next UTC one.
+	go run(&Logger{fullPathFileName: filepath.Join(dir, "local.log"), LogSplitDay: 1, LocalTime: true}, 5*time.Hour, done)
+	go run(&Logger{fullPathFileName: filepath.Join(dir, "utc.log"), LogSplitDay: 1}, 13*time.Hour, done)
+	isNil(<-done, t)
+	isNil(<-done, t)
+
+	// each day's backup holds the write after the previous split and the
+	// first of the loop's day.
+	for i := 0; i < days; i++ {
+		day := start.Add(time.Duration(i) * 24 * time.Hour)
+		date := day.Format(dateFormat)
+		local, utc := "", ""
+		if i > 0 {
+			local = day.Add(-19*time.Hour).Format(time.RFC3339) + "\n"
+			utc = day.Add(-11*time.Hour).Format(time.RFC3339) + "\n"
+		}
+		existsWithContent(filepath.Join(dir, "local-"+date+"T23-59-59.log"), []byte(local+day.Format(time.RFC3339)+"\n"), t)
+		existsWithContent(filepath.Join(dir, "utc-"+date+"T23-59-59.log"), []byte(utc+day.Format(time.RFC3339)+"\n"), t)
+	}
+	fileCount(dir, 2*days+2, t)
+}
+
+func TestReopen(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestReopen", t)
+	defer os.RemoveAll(dir)
+
+	filename := logFile(dir)
+	l := &Logger{
+		fullPathFileName:   filename,
+		Compress:           true,
+		LogMaxSaveQuantity: 1,
+	}
+	defer l.Close()
+	_, err := l.Write([]byte("boo!"))
+	isNil(err, t)
+
+	// an external tool renames the file, then asks for a new one.
+	rotated := filename + ".1"
+	err = os.Rename(filename, rotated)
+	isNil(err, t)
+	err = l.Reopen()
+	isNil(err, t)
+	existsWithContent(filename, []byte{}, t)
+	_, err = l.Write([]byte("foo"))
+	isNil(err, t)
+	existsWithContent(filename, []byte("foo"), t)
+
+	// nothing was renamed, compressed or removed.
+	l.waitMill()
+	existsWithContent(rotated, []byte("boo!"), t)
+	fileCount(dir, 2, t)
+
+	// with the file still there, it carries on appending to it.
+	err = l.Reopen()
+	isNil(err, t)
+	_, err = l.Write([]byte("bar"))
+	isNil(err, t)
+	existsWithContent(filename, []byte("foobar"), t)
+	fileCount(dir, 2, t)
+}
+
+// makeTempDir creates a file with a semi-unique name in the OS temp directory.
+// It should be based on the name of the test, to keep parallel tests from
+// colliding, and must be cleaned up after the test is finished.
+func makeTempDir(name string, t testing.TB) string {
+	dir := time.Now().Format(name + backupTimeFormat)
+	dir = filepath.Join(os.TempDir(), dir)
+	isNilUp(os.Mkdir(dir, 0700), t, 1)
+	return dir
+}
+
+// existsWithContent checks that the given file exists and has the correct content.
+func existsWithContent(path string, content []byte, t testing.TB) {
+	info, err := os.Stat(path)
+	isNilUp(err, t, 1)
+	equalsUp(int64(len(content)), info.Size(), t, 1)
+
+	b, err := ioutil.ReadFile(path)
+	isNilUp(err, t, 1)
+	equalsUp(content, b, t, 1)
+}
+
+// logFile returns the log file name in the given directory for the current fake
+// time.
+func logFile(dir string) string {
+	return filepath.Join(dir, "foobar.log")
+}
+
+func backupFile(dir string) string {
+	return filepath.Join(dir, "foobar-"+fakeTime().UTC().Format(backupTimeFormat)+".log")
+}
+
+func backupFileLocal(dir string) string {
+	return filepath.Join(dir, "foobar-"+fakeTime().Format(backupTimeFormat)+".log")
+}
+
+// logFileLocal returns the log file name in the given directory for the current
+// fake time using the local timezone.
+func logFileLocal(dir string) string {
+	return filepath.Join(dir, fakeTime().Format(backupTimeFormat))
+}
+
+// fileCount checks that the number of files in the directory is exp.
+func fileCount(dir string, exp int, t testing.TB) {
+	files, err := ioutil.ReadDir(dir)
+	isNilUp(err, t, 1)
+	// Make sure no other files were created.
+	equalsUp(exp, len(files), t, 1)
+}
+
+// newFakeTime sets the fake "current time" to two days later.
+func newFakeTime() {
+	fakeCurrentTime = fakeCurrentTime.Add(time.Hour * 24 * 2)
+}
+
+func notExist(path string, t testing.TB) {
+	_, err := os.Stat(path)
+	assertUp(os.IsNotExist(err), t, 1, "expected to get os.IsNotExist, but instead got %v", err)
+}
+
+// waitNotExist waits up to five seconds for path to be removed, as the mill
+// goroutine removes backups, and fails if it isn't.
+func waitNotExist(path string, t testing.TB) {
+	deadline := time.Now().Add(5 * time.Second)
+	_, err := os.Stat(path)
+	for !os.IsNotExist(err) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+		_, err = os.Stat(path)
+	}
+	assertUp(os.IsNotExist(err), t, 1, "expected to get os.IsNotExist, but instead got %v", err)
+}
+
+// closeWait closes l once its cleanup has finished, so that the mill
+// goroutine doesn't outlive the test and race with the next one over the
+// mocked globals.
+func closeWait(l *Logger, t testing.TB) {
+	isNilUp(l.CloseContext(context.Background()), t, 1)
 }
 
 func exists(path string, t testing.TB) {
@@ -0,0 +1,95 @@
+package lumberjacktest_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	lumberjack "github.com/chriszhangmq/loglumber"
+	"github.com/chriszhangmq/loglumber/lumberjacktest"
+)
+
+// Three days of logging with a file per day, simulated in moments.
+func Example() {
+	dir, err := ioutil.TempDir("", "lumberjacktest")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	clock := lumberjacktest.NewFakeClock(time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC))
+	l := &lumberjack.Logger{
+		LogPathName:   dir + string(filepath.Separator),
+		LogFileName:   "app",
+		LogFileSuffix: ".log",
+		LogSplitDay:   1,
+		Clock:         clock,
+	}
+	if err := l.Init(); err != nil {
+		panic(err)
+	}
+	defer l.Close()
+	for day := 1; day <= 3; day++ {
+		fmt.Fprintf(l, "day %d\n", day)
+		clock.Advance(24 * time.Hour)
+	}
+
+	files, err := lumberjacktest.Files(dir)
+	if err != nil {
+		panic(err)
+	}
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%s: %q\n", name, files[name])
+	}
+	// Output:
+	// app-2021-01-01T23-59-59.log: "day 1\n"
+	// app-2021-01-02T23-59-59.log: "day 2\n"
+	// app.log: "day 3\n"
+}
+
+// Three days of logging in memory, with nothing left on disk.
+func ExampleMemFS() {
+	clock := lumberjacktest.NewFakeClock(time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC))
+	fs := lumberjacktest.NewMemFS(clock)
+	l := &lumberjack.Logger{
+		LogPathName:   "/var/log/app/",
+		LogFileName:   "app",
+		LogFileSuffix: ".log",
+		LogSplitDay:   1,
+		Clock:         clock,
+		FileSystem:    fs,
+	}
+	if err := l.Init(); err != nil {
+		panic(err)
+	}
+	defer l.Close()
+	for day := 1; day <= 3; day++ {
+		fmt.Fprintf(l, "day %d\n", day)
+		clock.Advance(24 * time.Hour)
+	}
+
+	files, err := fs.Files("/var/log/app")
+	if err != nil {
+		panic(err)
+	}
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%s: %q\n", name, files[name])
+	}
+	// Output:
+	// app-2021-01-01T23-59-59.log: "day 1\n"
+	// app-2021-01-02T23-59-59.log: "day 2\n"
+	// app.log: "day 3\n"
+}
@@ -0,0 +1,169 @@
+// Package lumberjacktest helps test code that logs through a
+// lumberjack.Logger, by simulating the passing of time and checking the files
+// the Logger leaves behind.
+//
+// Set a FakeClock as the Logger's Clock, advance it between writes, and
+// compare the log directory with AssertFiles:
+//
+//	clock := lumberjacktest.NewFakeClock(time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC))
+//	l := &lumberjack.Logger{LogPathName: dir + "/", LogFileName: "app", LogFileSuffix: ".log", LogSplitDay: 1, Clock: clock}
+//
+// Such a Logger writes real files, so tests should give it a temporary
+// directory.  To keep off the disk altogether, give it a MemFS as its
+// FileSystem as well, and check the files with AssertMemFiles:
+//
+//	fs := lumberjacktest.NewMemFS(clock)
+//	l := &lumberjack.Logger{LogPathName: "/logs/", LogFileName: "app", LogFileSuffix: ".log", LogSplitDay: 1, Clock: clock, FileSystem: fs}
+package lumberjacktest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// FakeClock is a Clock that only moves when told to.  It is safe for
+// concurrent use.
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFakeClock returns a FakeClock set to t.
+func NewFakeClock(t time.Time) *FakeClock {
+	return &FakeClock{now: t}
+}
+
+// Now returns the clock's time.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Set moves the clock to t.
+func (c *FakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
+
+// Files returns the contents of the regular files in dir, by name.  Files in
+// subdirectories aren't included.
+func Files(dir string) (map[string]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]string)
+	for _, info := range infos {
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, info.Name()))
+		if err != nil {
+			return nil, err
+		}
+		files[info.Name()] = string(b)
+	}
+	return files, nil
+}
+
+// AssertFiles fails the test unless the regular files in dir are exactly
+// those in want, by name, with the given contents.
+func AssertFiles(t testing.TB, dir string, want map[string]string) {
+	t.Helper()
+	got, err := Files(dir)
+	if err != nil {
+		t.Fatalf("can't read %s: %v", dir, err)
+	}
+	assertFiles(t, dir, got, want)
+}
+
+// AssertMemFiles is AssertFiles for the directory dir of fs.
+func AssertMemFiles(t testing.TB, fs *MemFS, dir string, want map[string]string) {
+	t.Helper()
+	got, err := fs.Files(dir)
+	if err != nil {
+		t.Fatalf("can't read %s: %v", dir, err)
+	}
+	assertFiles(t, dir, got, want)
+}
+
+// assertFiles fails the test unless got, the files in dir, are want.
+func assertFiles(t testing.TB, dir string, got, want map[string]string) {
+	t.Helper()
+	if diff := diff(got, want); diff != "" {
+		t.Errorf("files in %s differ from those expected:\n%s", dir, diff)
+	}
+}
+
+// AssertFileNames fails the test unless the regular files in dir have
+// exactly the given names, whatever their contents.
+func AssertFileNames(t testing.TB, dir string, names ...string) {
+	t.Helper()
+	got, err := Files(dir)
+	if err != nil {
+		t.Fatalf("can't read %s: %v", dir, err)
+	}
+	assertFileNames(t, dir, got, names)
+}
+
+// AssertMemFileNames is AssertFileNames for the directory dir of fs.
+func AssertMemFileNames(t testing.TB, fs *MemFS, dir string, names ...string) {
+	t.Helper()
+	got, err := fs.Files(dir)
+	if err != nil {
+		t.Fatalf("can't read %s: %v", dir, err)
+	}
+	assertFileNames(t, dir, got, names)
+}
+
+// assertFileNames fails the test unless got, the files in dir, have exactly
+// the given names.
+func assertFileNames(t testing.TB, dir string, got map[string]string, names []string) {
+	t.Helper()
+	gotNames := make([]string, 0, len(got))
+	for name := range got {
+		gotNames = append(gotNames, name)
+	}
+	sort.Strings(gotNames)
+	want := append([]string(nil), names...)
+	sort.Strings(want)
+	if strings.Join(gotNames, "\n") != strings.Join(want, "\n") {
+		t.Errorf("files in %s are %q, expected %q", dir, gotNames, want)
+	}
+}
+
+// diff describes how got differs from want, or returns "" if they match.
+func diff(got, want map[string]string) string {
+	var lines []string
+	for name, content := range want {
+		g, ok := got[name]
+		switch {
+		case !ok:
+			lines = append(lines, fmt.Sprintf("missing %s", name))
+		case g != content:
+			lines = append(lines, fmt.Sprintf("%s contains %q, expected %q", name, g, content))
+		}
+	}
+	for name := range got {
+		if _, ok := want[name]; !ok {
+			lines = append(lines, fmt.Sprintf("unexpected %s", name))
+		}
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,232 @@
+package lumberjacktest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	lumberjack "github.com/chriszhangmq/loglumber"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := NewFakeClock(start)
+	if got := c.Now(); !got.Equal(start) {
+		t.Fatalf("Now() = %v, expected %v", got, start)
+	}
+	c.Advance(36 * time.Hour)
+	if got, want := c.Now(), start.Add(36*time.Hour); !got.Equal(want) {
+		t.Fatalf("Now() = %v after Advance, expected %v", got, want)
+	}
+	c.Set(start)
+	if got := c.Now(); !got.Equal(start) {
+		t.Fatalf("Now() = %v after Set, expected %v", got, start)
+	}
+}
+
+func TestAssertFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestAssertFiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, content := range map[string]string{"a.log": "a", "b.log": "b"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	AssertFiles(t, dir, map[string]string{"a.log": "a", "b.log": "b"})
+	AssertFileNames(t, dir, "b.log", "a.log")
+
+	got, _ := Files(dir)
+	want := "a.log contains \"a\", expected \"x\"\nmissing c.log\nunexpected b.log"
+	if d := diff(got, map[string]string{"a.log": "x", "c.log": "c"}); d != want {
+		t.Errorf("diff = %q, expected %q", d, want)
+	}
+}
+
+func TestMemFS(t *testing.T) {
+	start := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	fs := NewMemFS(clock)
+
+	if _, err := fs.OpenFile("/logs/a.log", os.O_CREATE|os.O_WRONLY, 0644); !os.IsNotExist(err) {
+		t.Fatalf("OpenFile without the directory = %v, expected a not-exist error", err)
+	}
+	if err := fs.MkdirAll("/logs/old", 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := fs.OpenFile("/logs/a.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Hour)
+	f.Write([]byte("one\n"))
+	f.Write([]byte("two\n"))
+	if _, err := f.Read(make([]byte, 1)); err == nil {
+		t.Error("Read of a file opened write-only succeeded")
+	}
+	info, err := fs.Stat("/logs/a.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 8 || info.Mode() != 0640 || !info.ModTime().Equal(start.Add(time.Hour)) {
+		t.Errorf("Stat = %d %v %v, expected 8 -rw-r----- %v", info.Size(), info.Mode(), info.ModTime(), start.Add(time.Hour))
+	}
+	if fi, _ := f.Stat(); fi.Sys() != info.Sys() {
+		t.Error("the FileInfos of the open file and its name differ in Sys")
+	}
+	if _, err := fs.OpenFile("/logs/a.log", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644); !os.IsExist(err) {
+		t.Errorf("OpenFile with O_EXCL = %v, expected an exist error", err)
+	}
+
+	// a rename keeps the file, and writes through the open file follow it.
+	if err := fs.WriteFile("/logs/b.log", []byte("replaced"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Rename("/logs/a.log", "/logs/b.log"); err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("three\n"))
+	f.Close()
+	if _, err := f.Write([]byte("four\n")); err == nil {
+		t.Error("Write after Close succeeded")
+	}
+	if b, _ := fs.ReadFile("/logs/b.log"); string(b) != "one\ntwo\nthree\n" {
+		t.Errorf("b.log contains %q after the rename", b)
+	}
+	renamed, _ := fs.Stat("/logs/b.log")
+	if renamed.Sys() != info.Sys() {
+		t.Error("the renamed file has a different Sys")
+	}
+	if err := fs.Chtimes("/logs/b.log", start); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := fs.Stat("/logs/b.log"); !info.ModTime().Equal(start) {
+		t.Errorf("ModTime = %v after Chtimes, expected %v", info.ModTime(), start)
+	}
+
+	r, err := fs.OpenFile("/logs/b.log", os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 6)
+	if n, err := r.ReadAt(buf, 8); n != 6 || err != nil || string(buf) != "three\n" {
+		t.Errorf("ReadAt = %d, %v, %q", n, err, buf[:n])
+	}
+	if n, err := r.ReadAt(buf, 12); n != 2 || err == nil {
+		t.Errorf("ReadAt past the end = %d, %v, expected 2 and io.EOF", n, err)
+	}
+	r.Close()
+
+	infos, err := fs.ReadDir("/logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	if got := strings.Join(names, " "); got != "b.log old" {
+		t.Errorf("ReadDir = %q, expected \"b.log old\"", got)
+	}
+	AssertMemFiles(t, fs, "/logs", map[string]string{"b.log": "one\ntwo\nthree\n"})
+	AssertMemFileNames(t, fs, "/logs", "b.log")
+
+	if err := fs.Remove("/logs"); err == nil {
+		t.Error("Remove of a directory that isn't empty succeeded")
+	}
+	if err := fs.Remove("/logs/b.log"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat("/logs/b.log"); !os.IsNotExist(err) {
+		t.Errorf("Stat after Remove = %v, expected a not-exist error", err)
+	}
+	if err := fs.Remove("/logs/b.log"); !os.IsNotExist(err) {
+		t.Errorf("second Remove = %v, expected a not-exist error", err)
+	}
+}
+
+func TestMemFSLogger(t *testing.T) {
+	clock := NewFakeClock(time.Date(2021, 1, 3, 12, 0, 0, 0, time.UTC))
+	fs := NewMemFS(clock)
+	// a log file left by a run two days ago is moved aside at startup.
+	if err := fs.MkdirAll("/logs", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.WriteFile("/logs/app.log", []byte("2021-01-01 10:00:00 old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	l := &lumberjack.Logger{
+		LogPathName:       "/logs/",
+		LogFileName:       "app",
+		LogFileSuffix:     ".log",
+		LogSplitDay:       1,
+		LogMaxSize:        1,
+		LogFileTimeFormat: "2006-01-02 15:04:05",
+		Clock:             clock,
+		FileSystem:        fs,
+	}
+	if errs := l.Validate(); errs != nil {
+		t.Fatalf("Validate = %v", errs)
+	}
+	if err := l.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if _, err := l.Write([]byte("new\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.HealthCheck(); err != nil {
+		t.Errorf("HealthCheck = %v", err)
+	}
+	if err := l.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Write([]byte("newer\n")); err != nil {
+		t.Fatal(err)
+	}
+	AssertMemFiles(t, fs, "/logs", map[string]string{
+		"app-2021-01-01T10-00-00.log": "2021-01-01 10:00:00 old\n",
+		"app-2021-01-03T12-00-00.log": "new\n",
+		"app.log":                     "newer\n",
+	})
+
+	// the log file is moved away behind the Logger's back.
+	if err := fs.Rename("/logs/app.log", "/logs/moved.log"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.HealthCheck(); err == nil {
+		t.Error("HealthCheck passed with the log file moved away")
+	}
+}
+
+func TestMemFSUnsupported(t *testing.T) {
+	l := &lumberjack.Logger{
+		LogPathName:        "/logs/",
+		LogFileName:        "app",
+		LogFileSuffix:      ".log",
+		ArchiveHardlinkDir: "/archive",
+		FileSystem:         NewMemFS(nil),
+	}
+	if err := l.Validate(); err == nil || !strings.Contains(err.Error(), "ArchiveHardlinkDir") {
+		t.Errorf("Validate = %v, expected it to reject ArchiveHardlinkDir", err)
+	}
+	if err := l.Init(); err == nil || !strings.Contains(err.Error(), "ArchiveHardlinkDir") {
+		t.Errorf("Init = %v, expected it to reject ArchiveHardlinkDir", err)
+	}
+
+	// the free space MaxSizePercentFree measures is the real disk's.
+	l.ArchiveHardlinkDir = ""
+	l.MaxSizePercentFree = 10
+	if err := l.Validate(); err == nil || !strings.Contains(err.Error(), "MaxSizePercentFree") {
+		t.Errorf("Validate = %v, expected it to reject MaxSizePercentFree", err)
+	}
+}
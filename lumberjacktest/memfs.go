@@ -0,0 +1,457 @@
+package lumberjacktest
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	lumberjack "github.com/chriszhangmq/loglumber"
+)
+
+// MemFS is a lumberjack.FileSystem kept in memory, so a Logger given it as
+// its FileSystem leaves nothing on disk.  Paths are cleaned with
+// filepath.Clean; the root and "." always exist, and other directories must
+// be made, as the Logger does, before files are created in them.  It is
+// safe for concurrent use.  The zero value is an empty MemFS whose files
+// take their modification times from the system clock.
+type MemFS struct {
+	// Clock, if set, gives the modification times of files, so that they
+	// follow a FakeClock shared with the Logger.
+	Clock lumberjack.Clock
+
+	mu    sync.Mutex
+	nodes map[string]*memNode
+}
+
+var _ lumberjack.FileSystem = (*MemFS)(nil)
+
+// NewMemFS returns an empty MemFS whose files take their modification times
+// from clock, or from the system clock if clock is nil.
+func NewMemFS(clock lumberjack.Clock) *MemFS {
+	return &MemFS{Clock: clock}
+}
+
+// memNode is a file or directory in a MemFS.  Its address is the Sys of its
+// FileInfos, which tells the Logger whether two of them are the same file.
+type memNode struct {
+	dir     bool
+	mode    os.FileMode
+	modTime time.Time
+	data    []byte
+}
+
+var (
+	errIsDir    = errors.New("is a directory")
+	errNotDir   = errors.New("not a directory")
+	errNotEmpty = errors.New("directory not empty")
+)
+
+// now returns the time to give files written now.
+func (m *MemFS) now() time.Time {
+	if m.Clock != nil {
+		return m.Clock.Now()
+	}
+	return time.Now()
+}
+
+// lookup returns the node at the cleaned path name, with m.mu held.
+func (m *MemFS) lookup(name string) (*memNode, bool) {
+	if name == "." || name == string(filepath.Separator) || filepath.Dir(name) == name {
+		return &memNode{dir: true, mode: os.ModeDir | 0755}, true
+	}
+	n, ok := m.nodes[name]
+	return n, ok
+}
+
+// parentDir checks, with m.mu held, that the directory to hold name exists.
+func (m *MemFS) parentDir(op, name string) error {
+	n, ok := m.lookup(filepath.Dir(name))
+	if !ok {
+		return &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	if !n.dir {
+		return &os.PathError{Op: op, Path: name, Err: errNotDir}
+	}
+	return nil
+}
+
+// set adds n at the cleaned path name, with m.mu held.
+func (m *MemFS) set(name string, n *memNode) {
+	if m.nodes == nil {
+		m.nodes = make(map[string]*memNode)
+	}
+	m.nodes[name] = n
+}
+
+// OpenFile opens the named file as os.OpenFile does, honouring O_CREATE,
+// O_EXCL, O_TRUNC and O_APPEND.  Directories can't be opened.
+func (m *MemFS) OpenFile(name string, flag int, perm os.FileMode) (lumberjack.File, error) {
+	clean := filepath.Clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, ok := m.lookup(clean)
+	switch {
+	case ok && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	case ok && n.dir:
+		return nil, &os.PathError{Op: "open", Path: name, Err: errIsDir}
+	case !ok && flag&os.O_CREATE == 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	case !ok:
+		if err := m.parentDir("open", clean); err != nil {
+			return nil, err
+		}
+		n = &memNode{mode: perm.Perm(), modTime: m.now()}
+		m.set(clean, n)
+	}
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	if writable && flag&os.O_TRUNC != 0 {
+		n.data = nil
+		n.modTime = m.now()
+	}
+	return &memFile{
+		fs:       m,
+		node:     n,
+		name:     name,
+		readable: flag&os.O_WRONLY == 0,
+		writable: writable,
+		append:   flag&os.O_APPEND != 0,
+	}, nil
+}
+
+// Stat returns the FileInfo of the named file or directory.
+func (m *MemFS) Stat(name string) (os.FileInfo, error) {
+	clean := filepath.Clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, ok := m.lookup(clean)
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return n.info(filepath.Base(clean)), nil
+}
+
+// Lstat is Stat, as a MemFS has no symbolic links.
+func (m *MemFS) Lstat(name string) (os.FileInfo, error) {
+	fi, err := m.Stat(name)
+	if err != nil {
+		err.(*os.PathError).Op = "lstat"
+	}
+	return fi, err
+}
+
+// Rename renames oldpath to newpath, replacing a file, but not a directory,
+// already there.  A directory is renamed with everything in it.
+func (m *MemFS) Rename(oldpath, newpath string) error {
+	oldClean, newClean := filepath.Clean(oldpath), filepath.Clean(newpath)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, ok := m.nodes[oldClean]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrNotExist}
+	}
+	if err := m.parentDir("rename", newClean); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err.(*os.PathError).Err}
+	}
+	if oldClean == newClean {
+		return nil
+	}
+	if target, ok := m.nodes[newClean]; ok && target.dir {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: errIsDir}
+	}
+	if n.dir {
+		if strings.HasPrefix(newClean, oldClean+string(filepath.Separator)) {
+			return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: errors.New("invalid argument")}
+		}
+		prefix := oldClean + string(filepath.Separator)
+		for name, child := range m.nodes {
+			if strings.HasPrefix(name, prefix) {
+				delete(m.nodes, name)
+				m.nodes[newClean+string(filepath.Separator)+strings.TrimPrefix(name, prefix)] = child
+			}
+		}
+	}
+	delete(m.nodes, oldClean)
+	m.nodes[newClean] = n
+	return nil
+}
+
+// Remove removes the named file or empty directory.
+func (m *MemFS) Remove(name string) error {
+	clean := filepath.Clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, ok := m.nodes[clean]
+	if !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	if n.dir && len(m.children(clean)) > 0 {
+		return &os.PathError{Op: "remove", Path: name, Err: errNotEmpty}
+	}
+	delete(m.nodes, clean)
+	return nil
+}
+
+// MkdirAll creates the directory path and any parents it needs.
+func (m *MemFS) MkdirAll(path string, perm os.FileMode) error {
+	clean := filepath.Clean(path)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var missing []string
+	for dir := clean; ; dir = filepath.Dir(dir) {
+		n, ok := m.lookup(dir)
+		if ok {
+			if !n.dir {
+				return &os.PathError{Op: "mkdir", Path: dir, Err: errNotDir}
+			}
+			break
+		}
+		missing = append(missing, dir)
+	}
+	for _, dir := range missing {
+		m.set(dir, &memNode{dir: true, mode: os.ModeDir | perm.Perm(), modTime: m.now()})
+	}
+	return nil
+}
+
+// ReadDir returns the entries of the directory dirname, sorted by name.
+func (m *MemFS) ReadDir(dirname string) ([]os.FileInfo, error) {
+	clean := filepath.Clean(dirname)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, ok := m.lookup(clean)
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: dirname, Err: os.ErrNotExist}
+	}
+	if !n.dir {
+		return nil, &os.PathError{Op: "readdirent", Path: dirname, Err: errNotDir}
+	}
+	names := m.children(clean)
+	infos := make([]os.FileInfo, len(names))
+	for i, name := range names {
+		infos[i] = m.nodes[filepath.Join(clean, name)].info(name)
+	}
+	return infos, nil
+}
+
+// children returns the sorted names of the entries of the cleaned directory
+// dir, with m.mu held.
+func (m *MemFS) children(dir string) []string {
+	var names []string
+	for name := range m.nodes {
+		if name != dir && filepath.Dir(name) == dir {
+			names = append(names, filepath.Base(name))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ReadFile returns the contents of the named file.
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	clean := filepath.Clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, ok := m.lookup(clean)
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	if n.dir {
+		return nil, &os.PathError{Op: "read", Path: name, Err: errIsDir}
+	}
+	return append([]byte(nil), n.data...), nil
+}
+
+// WriteFile writes data to the named file, creating it with perm if it
+// doesn't exist, as ioutil.WriteFile does.  It is handy for leaving files
+// from an earlier run for the Logger to find.
+func (m *MemFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	f, err := m.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Chtimes sets the modification time of the named file or directory.
+func (m *MemFS) Chtimes(name string, mtime time.Time) error {
+	clean := filepath.Clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, ok := m.nodes[clean]
+	if !ok {
+		return &os.PathError{Op: "chtimes", Path: name, Err: os.ErrNotExist}
+	}
+	n.modTime = mtime
+	return nil
+}
+
+// Files returns the contents of the regular files in dir, by name, as Files
+// does for the disk.
+func (m *MemFS) Files(dir string) (map[string]string, error) {
+	clean := filepath.Clean(dir)
+	infos, err := m.ReadDir(clean)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	files := make(map[string]string)
+	for _, info := range infos {
+		// the file may have gone since ReadDir.
+		if n, ok := m.nodes[filepath.Join(clean, info.Name())]; ok && !n.dir {
+			files[info.Name()] = string(n.data)
+		}
+	}
+	return files, nil
+}
+
+// info returns the FileInfo of n under the given name.
+func (n *memNode) info(name string) os.FileInfo {
+	return memInfo{name: name, size: int64(len(n.data)), mode: n.mode, modTime: n.modTime, node: n}
+}
+
+// memInfo is the os.FileInfo of a memNode.
+type memInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+	node    *memNode
+}
+
+func (fi memInfo) Name() string       { return fi.name }
+func (fi memInfo) Size() int64        { return fi.size }
+func (fi memInfo) Mode() os.FileMode  { return fi.mode }
+func (fi memInfo) ModTime() time.Time { return fi.modTime }
+func (fi memInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi memInfo) Sys() interface{}   { return fi.node }
+
+// memFile is a file opened from a MemFS.
+type memFile struct {
+	fs       *MemFS
+	node     *memNode
+	name     string
+	readable bool
+	writable bool
+	append   bool
+
+	// offset and closed are guarded by fs.mu.
+	offset int64
+	closed bool
+}
+
+// check returns the error for op on f, with f.fs.mu held: whether f is
+// closed or wasn't opened for it.
+func (f *memFile) check(op string, allowed bool) error {
+	if f.closed {
+		return &os.PathError{Op: op, Path: f.name, Err: os.ErrClosed}
+	}
+	if !allowed {
+		return &os.PathError{Op: op, Path: f.name, Err: os.ErrPermission}
+	}
+	return nil
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check("read", f.readable); err != nil {
+		return 0, err
+	}
+	if f.offset >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.node.data[f.offset:])
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check("read", f.readable); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, &os.PathError{Op: "readat", Path: f.name, Err: errors.New("negative offset")}
+	}
+	if off >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.node.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check("write", f.writable); err != nil {
+		return 0, err
+	}
+	if f.append {
+		f.offset = int64(len(f.node.data))
+	}
+	end := f.offset + int64(len(p))
+	if end > int64(len(f.node.data)) {
+		data := make([]byte, end)
+		copy(data, f.node.data)
+		f.node.data = data
+	}
+	copy(f.node.data[f.offset:], p)
+	f.offset = end
+	f.node.modTime = f.fs.now()
+	return len(p), nil
+}
+
+func (f *memFile) Close() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.closed {
+		return &os.PathError{Op: "close", Path: f.name, Err: os.ErrClosed}
+	}
+	f.closed = true
+	return nil
+}
+
+func (f *memFile) Name() string {
+	return f.name
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check("stat", true); err != nil {
+		return nil, err
+	}
+	return f.node.info(filepath.Base(f.name)), nil
+}
+
+func (f *memFile) Sync() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	return f.check("sync", true)
+}
+
+// Chmod changes the mode of the file, as EnforceFileMode does.
+func (f *memFile) Chmod(mode os.FileMode) error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check("chmod", true); err != nil {
+		return err
+	}
+	f.node.mode = mode.Perm()
+	return nil
+}
@@ -0,0 +1,65 @@
+package lumberjack
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const markerSuffix = ".current"
+
+// markerFile returns the name of the CurrentMarker file: the log file's name
+// with its extension replaced by .current.
+func (l *Logger) markerFile() string {
+	name := l.filename()
+	return name[:len(name)-len(filepath.Ext(name))] + markerSuffix
+}
+
+// isMarker reports whether name is the base name of the CurrentMarker file.
+func (l *Logger) isMarker(name string) bool {
+	return l.CurrentMarker && name == filepath.Base(l.markerFile())
+}
+
+// writeMarker points the CurrentMarker file at the open log file.
+func (l *Logger) writeMarker() {
+	if !l.CurrentMarker {
+		return
+	}
+	name, err := filepath.Abs(l.filename())
+	if err != nil {
+		name = l.filename()
+	}
+	if err := writeFileAtomic(l.markerFile(), []byte(name+"\n"), 0644, l.tempSuffix()); err != nil {
+		l.handleError(fmt.Errorf("can't write current marker: %w", err))
+	}
+}
+
+// writeFileAtomic writes data to name through a temporary file, with the
+// extension tmpSuffix, so that readers see either the old contents or the
+// new, never part of them.
+func writeFileAtomic(name string, data []byte, mode os.FileMode, tmpSuffix string) error {
+	f, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name)+"*"+tmpSuffix)
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Chmod(tmp, mode); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
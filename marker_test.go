@@ -0,0 +1,50 @@
+package lumberjack
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCurrentMarker(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestCurrentMarker", t)
+	defer os.RemoveAll(dir)
+
+	marker := filepath.Join(dir, "foobar.current")
+	l := &Logger{
+		fullPathFileName: logFile(dir),
+		CurrentMarker:    true,
+	}
+	defer l.Close()
+	_, err := l.Write([]byte("boo!"))
+	isNil(err, t)
+	existsWithContent(marker, []byte(logFile(dir)+"\n"), t)
+
+	// each new file rewrites it.
+	for i := 0; i < 2; i++ {
+		err = os.Remove(marker)
+		isNil(err, t)
+		newFakeTime()
+		err = l.Rotate()
+		isNil(err, t)
+		existsWithContent(marker, []byte(logFile(dir)+"\n"), t)
+	}
+	files, err := l.oldLogFiles()
+	isNil(err, t)
+	equals(2, len(files), t)
+	// no temporary files are left behind.
+	fileCount(dir, 4, t)
+
+	// so does reopening an existing file, under another name.
+	err = l.Close()
+	isNil(err, t)
+	other := filepath.Join(dir, "other.log")
+	l.fullPathFileName = other
+	err = os.Rename(logFile(dir), other)
+	isNil(err, t)
+	_, err = l.Write([]byte("foo"))
+	isNil(err, t)
+	existsWithContent(other, []byte("foo"), t)
+	existsWithContent(filepath.Join(dir, "other.current"), []byte(other+"\n"), t)
+}
@@ -0,0 +1,67 @@
+package lumberjack
+
+import (
+	"fmt"
+	"time"
+)
+
+// midnightTimer is the goroutine RotateAtMidnight runs.
+type midnightTimer struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startMidnightTimer starts the RotateAtMidnight goroutine, stopping any
+// left from an earlier Init.
+func (l *Logger) startMidnightTimer() {
+	l.stopMidnightTimer()
+	if !l.RotateAtMidnight || l.LogSplitDay <= 0 {
+		return
+	}
+	m := &midnightTimer{stop: make(chan struct{}), done: make(chan struct{})}
+	l.mu.Lock()
+	l.midnight = m
+	l.mu.Unlock()
+	go l.runMidnightTimer(m)
+}
+
+// stopMidnightTimer stops the RotateAtMidnight goroutine, if there is one,
+// and waits for it to finish.  It must not be called with l.mu held, since
+// the goroutine may be waiting for it.
+func (l *Logger) stopMidnightTimer() {
+	l.mu.Lock()
+	m := l.midnight
+	l.midnight = nil
+	l.mu.Unlock()
+	if m != nil {
+		close(m.stop)
+		<-m.done
+	}
+}
+
+// runMidnightTimer wakes at each midnight, or DayRolloverAt, to split the
+// day.  The next one is worked out afresh every time, so days an hour shorter
+// or longer for daylight saving time are followed.
+func (l *Logger) runMidnightTimer(m *midnightTimer) {
+	defer close(m.done)
+	for {
+		now := l.timeNow().In(l.location())
+		next := l.nextRollover(now)
+		t := time.NewTimer(next.Sub(now))
+		select {
+		case <-m.stop:
+			t.Stop()
+			return
+		case <-t.C:
+		}
+		l.mu.Lock()
+		// a file that isn't open is split by the next write, once it opens
+		// it.
+		if l.file != nil {
+			if err := l.splitDay(); err != nil {
+				l.handleError(fmt.Errorf("can't rotate log file at midnight: %w", err))
+			}
+		}
+		l.mu.Unlock()
+	}
+}
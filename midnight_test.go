@@ -0,0 +1,57 @@
+package lumberjack
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// offsetClock runs at the speed of the system clock, offset by a fixed
+// amount.
+type offsetClock time.Duration
+
+func (c offsetClock) Now() time.Time {
+	return time.Now().Add(time.Duration(c))
+}
+
+func TestRotateAtMidnight(t *testing.T) {
+	dir := makeTempDir("TestRotateAtMidnight", t)
+	defer os.RemoveAll(dir)
+
+	// a clock 200ms short of midnight.
+	now := time.Now().UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	clock := offsetClock(midnight.Add(-200 * time.Millisecond).Sub(now))
+
+	l := &Logger{
+		LogPathName:      dir + string(filepath.Separator),
+		LogFileName:      "foobar",
+		LogFileSuffix:    ".log",
+		LogSplitDay:      1,
+		RotateAtMidnight: true,
+		Clock:            clock,
+	}
+	defer l.Close()
+	err := l.Init()
+	isNil(err, t)
+	_, err = l.Write([]byte("boo!"))
+	isNil(err, t)
+
+	<-time.After(500 * time.Millisecond)
+
+	// the file was rotated with no write after midnight.
+	backup := filepath.Join(dir, "foobar-"+midnight.Add(-time.Second).Format(backupTimeFormat)+".log")
+	existsWithContent(backup, []byte("boo!"), t)
+	existsWithContent(logFile(dir), []byte{}, t)
+
+	// writes carry on in the new day's file without another rotation.
+	_, err = l.Write([]byte("foo"))
+	isNil(err, t)
+	existsWithContent(logFile(dir), []byte("foo"), t)
+	fileCount(dir, 2, t)
+
+	err = l.Close()
+	isNil(err, t)
+	equals((*midnightTimer)(nil), l.midnight, t)
+}
@@ -0,0 +1,44 @@
+package lumberjack
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"time"
+)
+
+// NetworkRetryPolicy says how to retry file operations while a network mount
+// holding the log directory recovers.
+type NetworkRetryPolicy struct {
+	// Retries is how many times an operation is retried.  Zero disables
+	// retrying.
+	Retries int `json:"Retries" yaml:"Retries"`
+
+	// Backoff is the wait before the first retry, which doubles for each
+	// retry after, up to MaxBackoff if that is set.
+	Backoff    time.Duration `json:"Backoff" yaml:"Backoff"`
+	MaxBackoff time.Duration `json:"MaxBackoff" yaml:"MaxBackoff"`
+}
+
+// isMountLost reports whether err is how a filesystem reports that the
+// network mount it is on has gone away.
+func isMountLost(err error) bool {
+	return errors.Is(err, syscall.ESTALE) || errors.Is(err, syscall.EIO) || errors.Is(err, syscall.ENOTCONN)
+}
+
+// retryNetwork runs op, retrying it as NetworkRetry says for as long as it
+// fails with isMountLost.
+func (l *Logger) retryNetwork(op func() error) error {
+	err := op()
+	backoff := l.NetworkRetry.Backoff
+	for i := 0; i < l.NetworkRetry.Retries && isMountLost(err); i++ {
+		l.handleError(fmt.Errorf("log directory unavailable, retrying in %v: %w", backoff, err))
+		sleep(backoff)
+		backoff *= 2
+		if max := l.NetworkRetry.MaxBackoff; max > 0 && backoff > max {
+			backoff = max
+		}
+		err = op()
+	}
+	return err
+}
@@ -0,0 +1,91 @@
+package lumberjack
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// flakyStat returns an osStat that fails with each of errs in turn for name,
+// then recovers.
+func flakyStat(name string, errs ...error) func(string) (os.FileInfo, error) {
+	return func(n string) (os.FileInfo, error) {
+		if n == name && len(errs) > 0 {
+			err := errs[0]
+			errs = errs[1:]
+			return nil, &os.PathError{Op: "stat", Path: n, Err: err}
+		}
+		return os.Stat(n)
+	}
+}
+
+func TestNetworkRetry(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestNetworkRetry", t)
+	defer os.RemoveAll(dir)
+
+	var waits []time.Duration
+	sleep = func(d time.Duration) { waits = append(waits, d) }
+	defer func() {
+		sleep = time.Sleep
+		osStat = os.Stat
+	}()
+
+	l := &Logger{
+		fullPathFileName: logFile(dir),
+		Compress:         true,
+		NetworkRetry:     NetworkRetryPolicy{Retries: 3, Backoff: 10 * time.Millisecond, MaxBackoff: 15 * time.Millisecond},
+	}
+	defer closeWait(l, t)
+
+	// the mount comes back on the third try at opening the file.
+	osStat = flakyStat(logFile(dir), syscall.ESTALE, syscall.EIO, syscall.ESTALE)
+	_, err := l.Write([]byte("boo!"))
+	isNil(err, t)
+	existsWithContent(logFile(dir), []byte("boo!"), t)
+	equals([]time.Duration{10 * time.Millisecond, 15 * time.Millisecond, 15 * time.Millisecond}, waits, t)
+
+	// and on the second at compressing the backup.
+	waits = nil
+	newFakeTime()
+	osStat = flakyStat(backupFile(dir), syscall.ESTALE)
+	err = l.Rotate()
+	isNil(err, t)
+	l.waitMill()
+	exists(backupFile(dir)+compressSuffix, t)
+	notExist(backupFile(dir), t)
+	equals([]time.Duration{10 * time.Millisecond}, waits, t)
+}
+
+func TestNetworkRetryGivesUp(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestNetworkRetryGivesUp", t)
+	defer os.RemoveAll(dir)
+
+	var waits []time.Duration
+	sleep = func(d time.Duration) { waits = append(waits, d) }
+	defer func() {
+		sleep = time.Sleep
+		osStat = os.Stat
+	}()
+
+	l := &Logger{
+		fullPathFileName: logFile(dir),
+		NetworkRetry:     NetworkRetryPolicy{Retries: 2, Backoff: time.Millisecond},
+	}
+	defer l.Close()
+	osStat = flakyStat(logFile(dir), syscall.ESTALE, syscall.ESTALE, syscall.ESTALE, syscall.ESTALE)
+	_, err := l.Write([]byte("boo!"))
+	notNil(err, t)
+	assert(errors.Is(err, syscall.ESTALE), t, "expected ESTALE, got %v", err)
+	equals(2, len(waits), t)
+
+	// other errors aren't retried.
+	waits = nil
+	osStat = flakyStat(logFile(dir), syscall.EACCES)
+	_, err = l.Write([]byte("boo!"))
+	notNil(err, t)
+	equals(0, len(waits), t)
+}
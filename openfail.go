@@ -0,0 +1,40 @@
+package lumberjack
+
+import "errors"
+
+// ErrOpenFailed is wrapped by the errors Write returns once FailOpen has
+// seen the log file fail to open.
+var ErrOpenFailed = errors.New("can't open log file")
+
+// openFailed reports err, a failure to open the log file, to OnOpenFailure
+// and returns the error for Write to return, which FailOpen makes stick.
+func (l *Logger) openFailed(err error) error {
+	if l.OnOpenFailure != nil {
+		l.OnOpenFailure(err)
+	}
+	if !l.FailOpen {
+		return err
+	}
+	l.openErr = &openError{err: err}
+	return l.openErr
+}
+
+// openError is the error FailOpen makes Write return: it is ErrOpenFailed,
+// and unwraps to the failure to open the log file.
+type openError struct {
+	err error
+}
+
+func (e *openError) Error() string {
+	return ErrOpenFailed.Error() + ": " + e.err.Error()
+}
+
+// Is reports whether target is ErrOpenFailed.
+func (e *openError) Is(target error) bool {
+	return target == ErrOpenFailed
+}
+
+// Unwrap returns the failure to open the log file.
+func (e *openError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,74 @@
+package lumberjack
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFailOpen(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestFailOpen", t)
+	defer os.RemoveAll(dir)
+
+	// a file where the log directory should be.
+	logDir := filepath.Join(dir, "logs")
+	err := ioutil.WriteFile(logDir, []byte("not a directory"), 0644)
+	isNil(err, t)
+
+	var failures []error
+	l := &Logger{
+		fullPathFileName: logFile(logDir),
+		FailOpen:         true,
+		OnOpenFailure:    func(err error) { failures = append(failures, err) },
+	}
+	defer l.Close()
+	_, openErr := l.Write([]byte("boo!"))
+	notNil(openErr, t)
+	assert(errors.Is(openErr, ErrOpenFailed), t, "expected ErrOpenFailed, got %v", openErr)
+	equals(1, len(failures), t)
+	// the cause can still be told apart.
+	equals(failures[0], errors.Unwrap(openErr), t)
+	var pathErr *os.PathError
+	assert(errors.As(openErr, &pathErr), t, "expected a *os.PathError cause, got %v", openErr)
+
+	// the failure sticks, even once the path is fixed, until Close.
+	err = os.Remove(logDir)
+	isNil(err, t)
+	_, err = l.Write([]byte("boo!"))
+	equals(openErr, err, t)
+	equals(1, len(failures), t)
+	notExist(logFile(logDir), t)
+
+	err = l.Close()
+	isNil(err, t)
+	_, err = l.Write([]byte("boo!"))
+	isNil(err, t)
+	existsWithContent(logFile(logDir), []byte("boo!"), t)
+}
+
+func TestOnOpenFailure(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestOnOpenFailure", t)
+	defer os.RemoveAll(dir)
+
+	logDir := filepath.Join(dir, "logs")
+	err := ioutil.WriteFile(logDir, []byte("not a directory"), 0644)
+	isNil(err, t)
+
+	var failures []error
+	l := &Logger{
+		fullPathFileName: logFile(logDir),
+		OnOpenFailure:    func(err error) { failures = append(failures, err) },
+	}
+	defer l.Close()
+	for i := 0; i < 2; i++ {
+		_, err = l.Write([]byte("boo!"))
+		notNil(err, t)
+		assert(!errors.Is(err, ErrOpenFailed), t, "expected ErrOpenFailed only with FailOpen, got %v", err)
+	}
+	// without FailOpen, each write tries again.
+	equals(2, len(failures), t)
+}
@@ -0,0 +1,40 @@
+package lumberjack
+
+import "sync/atomic"
+
+// Pause stops rotation and cleanup until Resume is called, say while a
+// backup snapshot of the log directory is taken.  While paused, writes keep
+// appending to the current file even past LogMaxSize or the end of the day,
+// Rotate does nothing, and no backups are compressed or removed, though a
+// cleanup pass already under way finishes.  The file can therefore grow
+// without bound while paused.
+func (l *Logger) Pause() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	atomic.StoreInt32(&l.paused, 1)
+}
+
+// Resume undoes Pause.  If a rotation came due while paused, it happens now;
+// otherwise any cleanup that was held back runs.
+func (l *Logger) Resume() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if atomic.SwapInt32(&l.paused, 0) == 0 {
+		return nil
+	}
+	reason := l.deferredRotate
+	l.deferredRotate = 0
+	if reason != 0 {
+		return l.rotate(reason)
+	}
+	if atomic.SwapInt32(&l.deferredMill, 0) != 0 {
+		l.mill()
+	}
+	return nil
+}
+
+// isPaused reports whether Pause is in effect.
+func (l *Logger) isPaused() bool {
+	return atomic.LoadInt32(&l.paused) != 0
+}
@@ -0,0 +1,62 @@
+package lumberjack
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestPauseResume(t *testing.T) {
+	currentTime = fakeTime
+	megabyte = 1
+	defer func() { megabyte = 1024 * 1024 }()
+	dir := makeTempDir("TestPauseResume", t)
+	defer os.RemoveAll(dir)
+
+	filename := logFile(dir)
+	l := &Logger{
+		fullPathFileName:   filename,
+		LogMaxSize:         10,
+		LogMaxSaveQuantity: 1,
+	}
+	defer closeWait(l, t)
+	b := []byte("boo!")
+	_, err := l.Write(b)
+	isNil(err, t)
+	newFakeTime()
+	isNil(l.Rotate(), t)
+	old := backupFile(dir)
+	l.waitMill()
+
+	// another backup, which retention would remove, made while paused.
+	l.Pause()
+	newFakeTime()
+	extra := backupFile(dir)
+	err = ioutil.WriteFile(extra, b, 0644)
+	isNil(err, t)
+
+	// nothing rotates while paused, even past LogMaxSize.
+	b2 := []byte("foooooo!")
+	for i := 0; i < 3; i++ {
+		_, err = l.Write(b2)
+		isNil(err, t)
+	}
+	isNil(l.Rotate(), t)
+	l.waitMill()
+	existsWithContent(filename, append(append(b2, b2...), b2...), t)
+	exists(old, t)
+	exists(extra, t)
+
+	// resuming makes the rotation that came due, and cleanup follows.
+	newFakeTime()
+	isNil(l.Resume(), t)
+	l.waitMill()
+	existsWithContent(backupFile(dir), append(append(b2, b2...), b2...), t)
+	existsWithContent(filename, []byte{}, t)
+	notExist(old, t)
+	notExist(extra, t)
+
+	// resuming when not paused does nothing.
+	isNil(l.Resume(), t)
+	fileCount(dir, 2, t)
+}
@@ -0,0 +1,11 @@
+module github.com/chriszhangmq/loglumber/pgzip
+
+go 1.15
+
+require (
+	github.com/chriszhangmq/loglumber v0.0.0-00010101000000-000000000000
+	github.com/klauspost/compress v1.13.6 // indirect
+	github.com/klauspost/pgzip v1.2.6
+)
+
+replace github.com/chriszhangmq/loglumber => ../
@@ -0,0 +1,94 @@
+// Package pgzip provides a lumberjack Compressor that spreads gzip
+// compression across CPU cores using github.com/klauspost/pgzip, for the
+// occasional very large backup, such as the first rotation after downtime,
+// that the single-threaded default takes too long over.
+//
+//	l := &lumberjack.Logger{
+//		Compress:        true,
+//		Compressor:      pgzip.NewCompressor(gzip.DefaultCompression),
+//		CompressMinSize: 64 << 20,
+//	}
+//
+// Backups are ordinary gzip files with the suffix ".gz", so they read with
+// compress/gzip and are recognized as the default Compressor's; switching
+// between the two leaves no backups unmanaged.
+//
+// The speed costs memory and CPU: each compression holds blocks of input and
+// output in memory, by default one megabyte each for as many blocks as
+// GOMAXPROCS, and keeps every core busy while it runs, competing with the
+// application.  For files of a few megabytes that buys nothing, so pair it
+// with a CompressMinSize that leaves small backups alone, or use the default
+// Compressor.  This is a module of its own, so that only programs that use it
+// depend on pgzip.
+package pgzip
+
+import (
+	"compress/gzip"
+	"io"
+	"runtime"
+
+	"github.com/chriszhangmq/loglumber"
+	kpgzip "github.com/klauspost/pgzip"
+)
+
+// defaultBlockSize is the size of the blocks compressed in parallel.
+const defaultBlockSize = 1 << 20
+
+type compressor struct {
+	level     int
+	blockSize int
+	blocks    int
+}
+
+// Option configures a Compressor made by NewCompressor.
+type Option func(*compressor)
+
+// WithConcurrency sets the size in bytes of the blocks compressed in
+// parallel and how many are in flight at once, which bound the memory used
+// to about twice blockSize times blocks.  Larger blocks compress slightly
+// better; more blocks than cores doesn't help.  The defaults are one megabyte
+// and GOMAXPROCS.
+func WithConcurrency(blockSize, blocks int) Option {
+	return func(c *compressor) {
+		c.blockSize = blockSize
+		c.blocks = blocks
+	}
+}
+
+// NewCompressor returns a Compressor that writes gzip files in parallel at
+// the given compression level, from gzip.HuffmanOnly to gzip.BestCompression,
+// where zero means gzip.DefaultCompression.
+func NewCompressor(level int, opts ...Option) lumberjack.Compressor {
+	c := compressor{
+		level:     level,
+		blockSize: defaultBlockSize,
+		blocks:    runtime.GOMAXPROCS(0),
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+func (c compressor) Suffix() string {
+	return ".gz"
+}
+
+func (c compressor) Compress(dst io.Writer, src io.Reader) error {
+	level := c.level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	w, err := kpgzip.NewWriterLevel(dst, level)
+	if err != nil {
+		return err
+	}
+	if err := w.SetConcurrency(c.blockSize, c.blocks); err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
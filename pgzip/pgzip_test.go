@@ -0,0 +1,161 @@
+package pgzip
+
+import (
+	"bytes"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chriszhangmq/loglumber"
+)
+
+var benchSize = flag.Int64("pgzip.benchsize", 2048, "size in megabytes of the file BenchmarkCompress compresses")
+
+// logLines returns n bytes of log-like text.
+func logLines(n int64) []byte {
+	var b bytes.Buffer
+	for i := 0; int64(b.Len()) < n; i++ {
+		fmt.Fprintf(&b, "2021-01-02 15:04:05 INFO request %d served in %dms for user %d\n", i, i%997, i%7919)
+	}
+	return b.Bytes()[:n]
+}
+
+func TestCompress(t *testing.T) {
+	data := logLines(5<<20 + 123)
+	for _, c := range []lumberjack.Compressor{
+		NewCompressor(0),
+		NewCompressor(gzip.BestSpeed, WithConcurrency(256<<10, 4)),
+	} {
+		if c.Suffix() != ".gz" {
+			t.Fatalf("got suffix %q, want .gz", c.Suffix())
+		}
+		var out bytes.Buffer
+		if err := c.Compress(&out, bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+		r, err := gzip.NewReader(&out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("decompressed %d bytes that don't match the %d compressed", len(got), len(data))
+		}
+	}
+
+	err := NewCompressor(42).Compress(ioutil.Discard, bytes.NewReader(data))
+	if err == nil {
+		t.Fatal("expected an error for an invalid level")
+	}
+}
+
+func TestLoggerCompressor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestLoggerCompressor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l := &lumberjack.Logger{
+		LogPathName:   dir + string(filepath.Separator),
+		LogFileName:   "foobar",
+		LogFileSuffix: ".log",
+		Compress:      true,
+		Compressor:    NewCompressor(0),
+	}
+	defer l.Close()
+	if err := l.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Write([]byte("boo!")); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	backups, err := l.Backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 || !backups[0].Compressed {
+		t.Fatalf("expected one compressed backup, got %+v", backups)
+	}
+	f, err := os.Open(backups[0].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "boo!" {
+		t.Fatalf("got %q, want %q", got, "boo!")
+	}
+}
+
+// BenchmarkCompress compares the default Compressor with this one on a file
+// of -pgzip.benchsize megabytes, 2GB by default, which it writes to a
+// temporary directory first.
+func BenchmarkCompress(b *testing.B) {
+	dir, err := ioutil.TempDir("", "BenchmarkCompress")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "big.log")
+	f, err := os.Create(name)
+	if err != nil {
+		b.Fatal(err)
+	}
+	size := *benchSize << 20
+	chunk := logLines(64 << 20)
+	for n := int64(0); n < size; n += int64(len(chunk)) {
+		if rest := size - n; rest < int64(len(chunk)) {
+			chunk = chunk[:rest]
+		}
+		if _, err := f.Write(chunk); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, bc := range []struct {
+		name string
+		c    lumberjack.Compressor
+	}{
+		{"gzip", lumberjack.NewGzipCompressor(0)},
+		{"pgzip", NewCompressor(0)},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.SetBytes(size)
+			for i := 0; i < b.N; i++ {
+				f, err := os.Open(name)
+				if err != nil {
+					b.Fatal(err)
+				}
+				err = bc.c.Compress(ioutil.Discard, f)
+				f.Close()
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package lumberjack
+
+import "io"
+
+// readFromBufSize is the size of the chunks ReadFrom reads.
+const readFromBufSize = 32 * 1024
+
+// ReadFrom implements io.ReaderFrom, so that io.Copy into a Logger reads
+// straight into one buffer rather than going through Write for every slice.
+// It reads r until EOF, writing each chunk it reads under the Logger's lock,
+// and splits a chunk that would take the log file past LogMaxSize, rotating
+// between the parts.  Unlike Write, it takes input of any length, but a
+// record that straddles a rotation is cut in two.  Other writes may land
+// between chunks, since the lock isn't held while r is read.  It returns the
+// number of bytes written and the first error other than io.EOF.
+func (l *Logger) ReadFrom(r io.Reader) (n int64, err error) {
+	size := int64(readFromBufSize)
+	if l.max() < size {
+		size = l.max()
+	}
+	buf := make([]byte, size)
+	for {
+		m, rerr := r.Read(buf)
+		if m > 0 {
+			written, werr := l.writeChunk(buf[:m])
+			n += int64(written)
+			if werr != nil {
+				return n, werr
+			}
+		}
+		if rerr == io.EOF {
+			return n, nil
+		}
+		if rerr != nil {
+			return n, rerr
+		}
+	}
+}
+
+// writeChunk writes p, in as many parts as it takes for each to fit the room
+// left in the log file.  p must be no longer than the maximum file size.
+func (l *Logger) writeChunk(p []byte) (n int, err error) {
+	if l.WriteShards > 0 {
+		return l.shardedWrite(p)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for n < len(p) {
+		// a part as long as the maximum makes write rotate a full file
+		// first.
+		room := l.max()
+		if l.file != nil && l.size < room {
+			room -= l.size
+		}
+		part := p[n:]
+		if int64(len(part)) > room {
+			part = part[:room]
+		}
+		m, _, err := l.write(part)
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,74 @@
+package lumberjack
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReadFrom(t *testing.T) {
+	megabyte = 1
+	dir := makeTempDir("TestReadFrom", t)
+	defer os.RemoveAll(dir)
+
+	// give each rotation a new time, so that backups get their own names.
+	var mu sync.Mutex
+	now := fakeTime()
+	currentTime = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(time.Second)
+		return now
+	}
+	defer func() { currentTime = fakeTime }()
+
+	l := &Logger{
+		fullPathFileName: logFile(dir),
+		LogMaxSize:       10,
+	}
+	defer l.Close()
+	_, err := l.Write([]byte("boo!"))
+	isNil(err, t)
+
+	// LimitReader hides strings.Reader's WriteTo, which io.Copy would
+	// otherwise prefer.
+	data := "abcdefghijklmnopqrst"
+	n, err := io.Copy(l, io.LimitReader(strings.NewReader(data), int64(len(data))))
+	isNil(err, t)
+	equals(int64(len(data)), n, t)
+	existsWithContent(logFile(dir), []byte("qrst"), t)
+
+	backups, err := l.Backups()
+	isNil(err, t)
+	equals(2, len(backups), t)
+	for i, want := range []string{"ghijklmnop", "boo!abcdef"} {
+		b, err := ioutil.ReadFile(backups[i].Path)
+		isNil(err, t)
+		equals(want, string(b), t)
+	}
+}
+
+func TestReadFromError(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestReadFromError", t)
+	defer os.RemoveAll(dir)
+
+	l := &Logger{fullPathFileName: logFile(dir)}
+	defer l.Close()
+	r := io.MultiReader(strings.NewReader("boo!"), errReader{})
+	n, err := l.ReadFrom(r)
+	equals(int64(4), n, t)
+	equals(errRead, err, t)
+	existsWithContent(logFile(dir), []byte("boo!"), t)
+}
+
+var errRead = io.ErrUnexpectedEOF
+
+// errReader fails every read with errRead.
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) { return 0, errRead }
@@ -0,0 +1,66 @@
+package lumberjack
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+)
+
+// ErrPathInUse is returned by Init when another Logger in the process has
+// already been initialized with the same log file and not closed.
+var ErrPathInUse = errors.New("log file is already in use by another Logger")
+
+// registry maps the absolute names of log files to the Logger using them.
+var registry = struct {
+	sync.Mutex
+	paths map[string]*Logger
+}{paths: make(map[string]*Logger)}
+
+// register claims name for l, releasing any name l held before.  If the name
+// belongs to another Logger it fails with ErrPathInUse, unless
+// AllowSharedPath is set, in which case the clash goes to ErrorHandler.  A
+// Logger with a FileSystem claims no name, as its files are its own.
+func (l *Logger) register(name string) error {
+	if l.FileSystem != nil {
+		l.unregister()
+		return nil
+	}
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return fmt.Errorf("can't resolve log file name: %s", err)
+	}
+	registry.Lock()
+	defer registry.Unlock()
+
+	if other, ok := registry.paths[abs]; ok && other != l {
+		err := fmt.Errorf("%w: %s", ErrPathInUse, abs)
+		if !l.AllowSharedPath {
+			return err
+		}
+		l.handleError(err)
+		return nil
+	}
+	l.unregisterLocked()
+	registry.paths[abs] = l
+	l.registered = abs
+	return nil
+}
+
+// unregister releases the name l claimed, if any.
+func (l *Logger) unregister() {
+	registry.Lock()
+	defer registry.Unlock()
+	l.unregisterLocked()
+}
+
+// unregisterLocked is unregister with the registry already locked.
+func (l *Logger) unregisterLocked() {
+	if l.registered == "" {
+		return
+	}
+	if registry.paths[l.registered] == l {
+		delete(registry.paths, l.registered)
+	}
+	l.registered = ""
+}
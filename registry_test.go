@@ -0,0 +1,49 @@
+package lumberjack
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPathInUse(t *testing.T) {
+	dir := makeTempDir("TestPathInUse", t)
+	defer os.RemoveAll(dir)
+
+	newLogger := func(name string) *Logger {
+		return &Logger{
+			LogPathName:   dir + string(filepath.Separator),
+			LogFileName:   name,
+			LogFileSuffix: ".log",
+		}
+	}
+	l := newLogger("foobar")
+	isNil(l.Init(), t)
+	defer l.Close()
+
+	// initializing again is fine; another Logger on the same file isn't.
+	isNil(l.Init(), t)
+	l2 := newLogger("foobar")
+	err := l2.Init()
+	notNil(err, t)
+	assert(errors.Is(err, ErrPathInUse), t, "expected ErrPathInUse, got %v", err)
+
+	// a different file is fine.
+	l3 := newLogger("other")
+	isNil(l3.Init(), t)
+	defer l3.Close()
+
+	// so is a shared one that is allowed, with a warning.
+	var warned error
+	l2.AllowSharedPath = true
+	l2.ErrorHandler = func(err error) { warned = err }
+	isNil(l2.Init(), t)
+	assert(errors.Is(warned, ErrPathInUse), t, "expected ErrPathInUse, got %v", warned)
+
+	// closing gives the name up.
+	isNil(l.Close(), t)
+	l4 := newLogger("foobar")
+	isNil(l4.Init(), t)
+	defer l4.Close()
+}
@@ -0,0 +1,47 @@
+package lumberjack
+
+import (
+	"fmt"
+	"time"
+)
+
+// dayRolloverLayout is the layout of DayRolloverAt.
+const dayRolloverLayout = "15:04:05"
+
+// validDayRollover checks that s, if set, is a time of day in
+// dayRolloverLayout.
+func validDayRollover(s string) error {
+	if s == "" {
+		return nil
+	}
+	if _, err := time.Parse(dayRolloverLayout, s); err != nil {
+		return fmt.Errorf("invalid DayRolloverAt %q, want a time like 06:00:00: %s", s, err)
+	}
+	return nil
+}
+
+// nextRollover returns the first DayRolloverAt after t, in the Logger's time
+// zone: the start of the day after the one holding t.  An invalid
+// DayRolloverAt, which Init and Validate reject, falls back to midnight.
+func (l *Logger) nextRollover(t time.Time) time.Time {
+	var at time.Time
+	if l.DayRolloverAt != "" {
+		at, _ = time.Parse(dayRolloverLayout, l.DayRolloverAt)
+	}
+	t = t.In(l.location())
+	next := time.Date(t.Year(), t.Month(), t.Day(), at.Hour(), at.Minute(), at.Second(), 0, t.Location())
+	if !t.Before(next) {
+		next = time.Date(t.Year(), t.Month(), t.Day()+1, at.Hour(), at.Minute(), at.Second(), 0, t.Location())
+	}
+	return next
+}
+
+// updateDay sets the current time to t and works out the ends of its day and
+// of the day before.  It assumes l.mu is held, or that the Logger isn't in
+// use yet, as in Init.
+func (l *Logger) updateDay(t time.Time) {
+	l.updateCurrentTimestamp(t)
+	next := l.nextRollover(l.nowTime)
+	l.updateLastTimeOfToday(next)
+	l.updateYesterdayTime(next)
+}
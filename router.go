@@ -0,0 +1,120 @@
+package lumberjack
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Router writes to one Logger per key, such as a tenant or a severity,
+// making each on the first write with its key and closing the least recently
+// used once more than a set number are open.  A closed Logger is made again
+// by the next write with its key, and picks up its file where it left off.
+// Writes through a Router are serialized.
+type Router struct {
+	newLogger func(key string) *Logger
+	maxOpen   int
+
+	mu      sync.Mutex
+	loggers map[string]*list.Element
+	// lru holds the open routes, most recently used first.
+	lru *list.List
+}
+
+// route is a Logger open for a key.
+type route struct {
+	key string
+	l   *Logger
+}
+
+// NewRouter returns a Router that makes the Logger for a key with newLogger,
+// keeping at most maxOpen of them open, or any number if maxOpen is zero or
+// less.  newLogger must give each key a Logger of its own file, not yet
+// initialized; the Router calls Init on it.  KeyedFile makes one from a
+// template Logger.
+func NewRouter(newLogger func(key string) *Logger, maxOpen int) *Router {
+	return &Router{
+		newLogger: newLogger,
+		maxOpen:   maxOpen,
+		loggers:   make(map[string]*list.Element),
+		lru:       list.New(),
+	}
+}
+
+// KeyedFile returns a function for NewRouter that clones template for each
+// key, naming its file after template's with a dash and the key, so that the
+// key "db" turns server.log into server-db.log.
+func KeyedFile(template *Logger) func(key string) *Logger {
+	return func(key string) *Logger {
+		l := template.Clone()
+		l.LogFileName += "-" + key
+		return l
+	}
+}
+
+// WriteKeyed writes p to the Logger for key, making it first if it isn't
+// open.  Keys can't be empty or contain path separators or "..", since they
+// usually end up in file names.
+func (r *Router) WriteKeyed(key string, p []byte) (n int, err error) {
+	if key == "" || strings.ContainsAny(key, `/\`) || strings.Contains(key, "..") {
+		return 0, fmt.Errorf("invalid routing key %q", key)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	l, err := r.logger(key)
+	if err != nil {
+		return 0, err
+	}
+	return l.Write(p)
+}
+
+// logger returns the open Logger for key, making it if needed and closing
+// the least recently used if that opens too many.  It assumes r.mu is held.
+func (r *Router) logger(key string) (*Logger, error) {
+	if e, ok := r.loggers[key]; ok {
+		r.lru.MoveToFront(e)
+		return e.Value.(*route).l, nil
+	}
+	l := r.newLogger(key)
+	if l == nil {
+		return nil, fmt.Errorf("no Logger for routing key %q", key)
+	}
+	if err := l.Init(); err != nil {
+		return nil, fmt.Errorf("can't start Logger for routing key %q: %w", key, err)
+	}
+	r.loggers[key] = r.lru.PushFront(&route{key: key, l: l})
+	for r.maxOpen > 0 && r.lru.Len() > r.maxOpen {
+		oldest := r.lru.Back()
+		rt := oldest.Value.(*route)
+		r.lru.Remove(oldest)
+		delete(r.loggers, rt.key)
+		if err := rt.l.Close(); err != nil {
+			rt.l.handleError(fmt.Errorf("can't close idle Logger for routing key %q: %w", rt.key, err))
+		}
+	}
+	return l, nil
+}
+
+// Close closes every open Logger.  The Router can still be written to
+// afterwards, making them again.
+func (r *Router) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var errs []string
+	for e := r.lru.Front(); e != nil; e = e.Next() {
+		rt := e.Value.(*route)
+		if err := rt.l.Close(); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", rt.key, err))
+		}
+	}
+	r.loggers = make(map[string]*list.Element)
+	r.lru.Init()
+	if len(errs) > 0 {
+		return errors.New("can't close all Loggers: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
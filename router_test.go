@@ -0,0 +1,69 @@
+package lumberjack
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRouter(t *testing.T) {
+	// the clock has to agree with the files' modification times, which Init
+	// goes by to tell whether a file being reopened is from an earlier day.
+	currentTime = time.Now
+	defer func() { currentTime = fakeTime }()
+	dir := makeTempDir("TestRouter", t)
+	defer os.RemoveAll(dir)
+
+	template := &Logger{
+		LogPathName:   dir + string(filepath.Separator),
+		LogFileName:   "foobar",
+		LogFileSuffix: ".log",
+		LogMaxSize:    10,
+	}
+	made := make(map[string][]*Logger)
+	keyed := KeyedFile(template)
+	r := NewRouter(func(key string) *Logger {
+		l := keyed(key)
+		made[key] = append(made[key], l)
+		return l
+	}, 2)
+	defer r.Close()
+
+	write := func(key, s string) {
+		_, err := r.WriteKeyed(key, []byte(s))
+		isNilUp(err, t, 1)
+	}
+	file := func(key string) string {
+		return filepath.Join(dir, "foobar-"+key+".log")
+	}
+	write("a", "one")
+	write("b", "two")
+	write("a", "three")
+	existsWithContent(file("a"), []byte("onethree"), t)
+	existsWithContent(file("b"), []byte("two"), t)
+	equals(10, made["a"][0].LogMaxSize, t)
+
+	// a third key closes the least recently used Logger, b's.
+	write("c", "four")
+	existsWithContent(file("c"), []byte("four"), t)
+	assert(made["b"][0].file == nil, t, "expected the Logger for b to be closed")
+	assert(made["a"][0].file != nil, t, "expected the Logger for a to be open")
+
+	// and writing to b again makes a new Logger, which carries on with its
+	// file, and closes a's.
+	write("b", "five")
+	equals(2, len(made["b"]), t)
+	existsWithContent(file("b"), []byte("twofive"), t)
+	assert(made["a"][0].file == nil, t, "expected the Logger for a to be closed")
+
+	for _, key := range []string{"", "../x", "x/y"} {
+		_, err := r.WriteKeyed(key, []byte("bad"))
+		notNil(err, t)
+	}
+
+	err := r.Close()
+	isNil(err, t)
+	assert(made["b"][1].file == nil, t, "expected the Logger for b to be closed")
+	assert(made["c"][0].file == nil, t, "expected the Logger for c to be closed")
+}
@@ -0,0 +1,138 @@
+package lumberjack
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// shardedWriter holds the buffers used when WriteShards is set.  Writers
+// append to one of several shards, each with its own lock, and a single
+// flusher writes the shards' contents to the file in the order the writes were
+// made.
+type shardedWriter struct {
+	// seq numbers writes in the order they were buffered, and next picks the
+	// shard for the next write.  They are first so they are 64-bit aligned.
+	seq  uint64
+	next uint64
+
+	shards  []writeShard
+	wake    chan struct{}
+	flushMu sync.Mutex
+
+	// buf is reused by flushShards to join entries.
+	buf []byte
+}
+
+// writeShard is one buffer of a shardedWriter.
+type writeShard struct {
+	mu      sync.Mutex
+	entries []shardEntry
+}
+
+// shardEntry is one buffered write.
+type shardEntry struct {
+	seq uint64
+	p   []byte
+}
+
+// shardedWriter returns the Logger's shards, starting the flusher goroutine
+// the first time.
+func (l *Logger) shardedWriter() *shardedWriter {
+	l.startShards.Do(func() {
+		l.shards = &shardedWriter{
+			shards: make([]writeShard, l.WriteShards),
+			wake:   make(chan struct{}, 1),
+		}
+		go l.shardFlushRun()
+	})
+	return l.shards
+}
+
+// shardedWrite buffers a copy of p for the flusher.
+func (l *Logger) shardedWrite(p []byte) (int, error) {
+	if writeLen := int64(len(p)); writeLen > l.max() {
+		return 0, fmt.Errorf(
+			"write length %d exceeds maximum file size %d", writeLen, l.max(),
+		)
+	}
+	s := l.shardedWriter()
+	buf := append([]byte(nil), p...)
+	sh := &s.shards[atomic.AddUint64(&s.next, 1)%uint64(len(s.shards))]
+
+	// the sequence number is taken under the shard's lock, so that each
+	// shard's entries stay in sequence order and a flusher that has seen a
+	// number can find its entry.
+	sh.mu.Lock()
+	sh.entries = append(sh.entries, shardEntry{seq: atomic.AddUint64(&s.seq, 1), p: buf})
+	sh.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return len(p), nil
+}
+
+// shardFlushRun runs in a goroutine to write buffered entries to the file.
+func (l *Logger) shardFlushRun() {
+	for range l.shards.wake {
+		l.flushShards()
+	}
+}
+
+// flushShards writes every entry buffered so far to the file, in sequence
+// order.  Errors go to ErrorHandler, since the writers have already returned.
+func (l *Logger) flushShards() {
+	s := l.shardedWriter()
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	// Every write numbered up to cutoff is already in its shard, or is about
+	// to be added by a writer holding the shard's lock.  Later writes are
+	// left for the next flush, so none can overtake an earlier one.
+	cutoff := atomic.LoadUint64(&s.seq)
+	var batch []shardEntry
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		k := 0
+		for k < len(sh.entries) && sh.entries[k].seq <= cutoff {
+			k++
+		}
+		batch = append(batch, sh.entries[:k]...)
+		sh.entries = sh.entries[:copy(sh.entries, sh.entries[k:])]
+		sh.mu.Unlock()
+	}
+	if len(batch) == 0 {
+		return
+	}
+	sort.Slice(batch, func(i, j int) bool {
+		return batch[i].seq < batch[j].seq
+	})
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Entries are joined into as few writes as possible, breaking wherever
+	// the file might need to rotate in between.
+	buf := s.buf[:0]
+	flush := func() {
+		if len(buf) == 0 {
+			return
+		}
+		if _, _, err := l.write(buf); err != nil {
+			l.handleError(err)
+		}
+		buf = buf[:0]
+	}
+	for _, e := range batch {
+		if l.file == nil || l.size+int64(len(buf)+len(e.p)) > l.max() {
+			flush()
+		}
+		buf = append(buf, e.p...)
+	}
+	flush()
+	s.buf = buf
+}
@@ -0,0 +1,77 @@
+package lumberjack
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWriteShards(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestWriteShards", t)
+	defer os.RemoveAll(dir)
+
+	filename := logFile(dir)
+	l := &Logger{
+		fullPathFileName: filename,
+		WriteShards:      4,
+	}
+	const writers, lines = 8, 500
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < lines; i++ {
+				n, err := l.Write([]byte(fmt.Sprintf("%d %d\n", w, i)))
+				if err != nil || n == 0 {
+					t.Errorf("write failed: %d, %v", n, err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	isNil(l.Close(), t)
+
+	f, err := os.Open(filename)
+	isNil(err, t)
+	defer f.Close()
+	next := make([]int, writers)
+	count := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var w, i int
+		_, err := fmt.Sscanf(scanner.Text(), "%d %d", &w, &i)
+		isNil(err, t)
+		// each writer's lines are whole and in order.
+		equals(next[w], i, t)
+		next[w]++
+		count++
+	}
+	isNil(scanner.Err(), t)
+	equals(writers*lines, count, t)
+}
+
+func BenchmarkConcurrentWrite(b *testing.B) {
+	for _, shards := range []int{0, 8} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			dir := makeTempDir("BenchmarkConcurrentWrite", b)
+			defer os.RemoveAll(dir)
+			l := &Logger{
+				fullPathFileName: logFile(dir),
+				WriteShards:      shards,
+			}
+			defer l.Close()
+			line := []byte(strings.Repeat("x", 99) + "\n")
+			b.SetBytes(int64(len(line)))
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					l.Write(line)
+				}
+			})
+		})
+	}
+}
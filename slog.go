@@ -0,0 +1,15 @@
+// +build go1.21
+
+package lumberjack
+
+import "log/slog"
+
+// NewSlogHandler returns a slog.Handler that writes records to l as lines of
+// JSON, in the format of slog.JSONHandler, with the given options, which may
+// be nil.  Handlers derived with WithAttrs and WithGroup write to l too.
+// Each record is written with a single Write, so a rotation falls between
+// records, never in one; a record too long for LogMaxSize fails with Write's
+// error.  It needs Go 1.21 or later.
+func NewSlogHandler(l *Logger, opts *slog.HandlerOptions) slog.Handler {
+	return slog.NewJSONHandler(l, opts)
+}
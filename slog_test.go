@@ -0,0 +1,75 @@
+// +build go1.21
+
+package lumberjack
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSlogHandler(t *testing.T) {
+	megabyte = 1
+	dir := makeTempDir("TestSlogHandler", t)
+	defer os.RemoveAll(dir)
+
+	// give each rotation a new time, so that backups get their own names.
+	now := fakeTime()
+	currentTime = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	defer func() { currentTime = fakeTime }()
+
+	l := &Logger{
+		fullPathFileName: logFile(dir),
+		LogMaxSize:       200,
+		LazyMill:         true,
+	}
+	defer l.Close()
+	opts := &slog.HandlerOptions{
+		// drop the time, which the fake clock doesn't set.
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}
+	log := slog.New(NewSlogHandler(l, opts)).With("app", "foo").WithGroup("req")
+	for i := 0; i < 10; i++ {
+		log.Info("handled", "id", i)
+	}
+	err := l.Close()
+	isNil(err, t)
+
+	// every file holds whole records.
+	files, err := filepath.Glob(filepath.Join(dir, "foobar*.log"))
+	isNil(err, t)
+	assert(len(files) > 1, t, "expected rotations, got %d files", len(files))
+	records := 0
+	for _, name := range files {
+		b, err := ioutil.ReadFile(name)
+		isNil(err, t)
+		assert(len(b) <= 200, t, "%s has %d bytes", name, len(b))
+		for _, line := range bytes.Split(bytes.TrimSuffix(b, []byte("\n")), []byte("\n")) {
+			var rec struct {
+				Msg string
+				App string
+				Req struct{ ID int }
+			}
+			err := json.Unmarshal(line, &rec)
+			isNil(err, t)
+			equals("handled", rec.Msg, t)
+			equals("foo", rec.App, t)
+			records++
+		}
+	}
+	equals(10, records, t)
+	existsWithContent(logFile(dir), []byte(`{"level":"INFO","msg":"handled","app":"foo","req":{"id":9}}`+"\n"), t)
+}
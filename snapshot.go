@@ -0,0 +1,46 @@
+package lumberjack
+
+import (
+	"fmt"
+	"io"
+)
+
+// CompressedReader returns a reader of the gzip-compressed contents of the
+// active log file as they are when it is called, for shipping the file
+// before it has been rotated.  The file is neither rotated nor copied: it is
+// compressed as it is read, up to the size it had at the time of the call,
+// so later writes aren't included.  It uses CompressLevel, whatever the
+// Compressor.  If the file is rotated before the reader is done, the reader
+// still yields the snapshot, since it keeps the file open.  The caller must
+// close the reader.
+func (l *Logger) CompressedReader() (io.ReadCloser, error) {
+	l.mu.Lock()
+	name := l.filename()
+	if err := l.flushBuffer(); err != nil {
+		l.handleError(err)
+	}
+	f, err := l.open(name)
+	if err != nil {
+		l.mu.Unlock()
+		return nil, fmt.Errorf("can't open log file: %s", err)
+	}
+	size := l.size
+	if l.file == nil {
+		info, err := f.Stat()
+		if err != nil {
+			l.mu.Unlock()
+			f.Close()
+			return nil, fmt.Errorf("can't stat log file: %s", err)
+		}
+		size = info.Size()
+	}
+	c := gzipCompressor{level: l.CompressLevel}
+	l.mu.Unlock()
+
+	pr, pw := io.Pipe()
+	go func() {
+		defer f.Close()
+		pw.CloseWithError(c.Compress(pw, io.LimitReader(f, size)))
+	}()
+	return pr, nil
+}
@@ -0,0 +1,47 @@
+package lumberjack
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestCompressedReader(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestCompressedReader", t)
+	defer os.RemoveAll(dir)
+
+	l := &Logger{fullPathFileName: logFile(dir)}
+	defer l.Close()
+	b := []byte("boo!\nfoooooo!\n")
+	_, err := l.Write(b)
+	isNil(err, t)
+
+	r, err := l.CompressedReader()
+	isNil(err, t)
+	defer r.Close()
+
+	// writes after the call, and a rotation, don't change the snapshot.
+	_, err = l.Write([]byte("later\n"))
+	isNil(err, t)
+	newFakeTime()
+	isNil(l.Rotate(), t)
+
+	gz, err := gzip.NewReader(r)
+	isNil(err, t)
+	got, err := ioutil.ReadAll(gz)
+	isNil(err, t)
+	equals(string(b), string(got), t)
+	isNil(r.Close(), t)
+
+	// with the file closed, the snapshot is what is on disk.
+	isNil(l.Close(), t)
+	r, err = l.CompressedReader()
+	isNil(err, t)
+	gz, err = gzip.NewReader(r)
+	isNil(err, t)
+	got, err = ioutil.ReadAll(gz)
+	isNil(err, t)
+	equals("", string(got), t)
+}
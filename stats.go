@@ -0,0 +1,104 @@
+package lumberjack
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// persistCountersInterval is how long PersistCounters lets writes go
+// between saves.
+const persistCountersInterval = 10 * time.Second
+
+// Stats holds a Logger's counters.  They count what this process did or,
+// with PersistCounters, what was done over the life of the log.
+type Stats struct {
+	// TotalBytes is the number of bytes written to log files.  With
+	// BufferSize, bytes count once they are written out.
+	TotalBytes int64 `json:"TotalBytes"`
+
+	// TotalRotations is the number of times the log file was rotated,
+	// whether for size, for the day or on request.
+	TotalRotations int64 `json:"TotalRotations"`
+
+	// TotalCompressions is the number of backups compressed.
+	TotalCompressions int64 `json:"TotalCompressions"`
+
+	// TotalRemoved is the number of backups removed by retention or to
+	// keep MinFreeDiskMB free.
+	TotalRemoved int64 `json:"TotalRemoved"`
+}
+
+// Stats returns the Logger's counters.  It is safe to call at any time.
+func (l *Logger) Stats() Stats {
+	return Stats{
+		TotalBytes:        atomic.LoadInt64(&l.totalBytes),
+		TotalRotations:    atomic.LoadInt64(&l.totalRotations),
+		TotalCompressions: atomic.LoadInt64(&l.totalCompressions),
+		TotalRemoved:      atomic.LoadInt64(&l.totalRemoved),
+	}
+}
+
+// CurrentSize returns the size of the open log file, or 0 if there is none.
+// It is safe to call at any time.
+func (l *Logger) CurrentSize() int64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.file == nil {
+		return 0
+	}
+	// UnlockedAppend updates size under the read lock.
+	return atomic.LoadInt64(&l.size)
+}
+
+// countersFile returns the name of the PersistCounters file.
+func (l *Logger) countersFile() string {
+	return filepath.Join(l.dir(), "."+filepath.Base(l.filename())+".counters")
+}
+
+// persistCounters saves the counters if PersistCounters is set.  Failures go
+// to ErrorHandler.  It assumes l.mu is held.
+func (l *Logger) persistCounters() {
+	if !l.PersistCounters {
+		return
+	}
+	l.countersSavedAt = l.timeNow()
+	b, err := json.Marshal(l.Stats())
+	if err == nil {
+		err = writeFileAtomic(l.countersFile(), append(b, '\n'), l.fileMode(), l.tempSuffix())
+	}
+	if err != nil {
+		l.handleError(fmt.Errorf("can't save counters: %w", err))
+	}
+}
+
+// restoreCounters loads the counters saved by PersistCounters, if it is set.
+// Counters that can't be read start from zero, and the error goes to
+// ErrorHandler.
+func (l *Logger) restoreCounters() {
+	if !l.PersistCounters {
+		return
+	}
+	l.countersSavedAt = l.timeNow()
+	b, err := ioutil.ReadFile(l.countersFile())
+	if os.IsNotExist(err) {
+		return
+	}
+	var st Stats
+	if err == nil {
+		err = json.Unmarshal(b, &st)
+	}
+	if err != nil {
+		l.handleError(fmt.Errorf("can't restore counters, starting from zero: %w", err))
+		return
+	}
+	atomic.StoreInt64(&l.totalBytes, st.TotalBytes)
+	atomic.StoreInt64(&l.totalRotations, st.TotalRotations)
+	atomic.StoreInt64(&l.totalCompressions, st.TotalCompressions)
+	atomic.StoreInt64(&l.totalRemoved, st.TotalRemoved)
+}
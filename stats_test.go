@@ -0,0 +1,111 @@
+package lumberjack
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPersistCounters(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestPersistCounters", t)
+	defer os.RemoveAll(dir)
+
+	counters := filepath.Join(dir, ".foobar.log.counters")
+	l := &Logger{
+		LogPathName:     dir + string(filepath.Separator),
+		LogFileName:     "foobar",
+		LogFileSuffix:   ".log",
+		PersistCounters: true,
+	}
+	err := l.Init()
+	isNil(err, t)
+	_, err = l.Write([]byte("boo!"))
+	isNil(err, t)
+	equals(int64(4), l.Stats().TotalBytes, t)
+	// not yet due.
+	notExist(counters, t)
+
+	fakeCurrentTime = fakeCurrentTime.Add(persistCountersInterval)
+	_, err = l.Write([]byte("foo"))
+	isNil(err, t)
+	existsWithContent(counters, []byte("{\"TotalBytes\":7,\"TotalRotations\":0,\"TotalCompressions\":0,\"TotalRemoved\":0}\n"), t)
+
+	_, err = l.Write([]byte("bar"))
+	isNil(err, t)
+	err = l.Close()
+	isNil(err, t)
+	existsWithContent(counters, []byte("{\"TotalBytes\":10,\"TotalRotations\":0,\"TotalCompressions\":0,\"TotalRemoved\":0}\n"), t)
+
+	// a restart carries on from the saved counters.
+	l2 := &Logger{
+		LogPathName:     dir + string(filepath.Separator),
+		LogFileName:     "foobar",
+		LogFileSuffix:   ".log",
+		PersistCounters: true,
+	}
+	err = l2.Init()
+	isNil(err, t)
+	equals(int64(10), l2.Stats().TotalBytes, t)
+	_, err = l2.Write([]byte("baz!"))
+	isNil(err, t)
+	equals(int64(14), l2.Stats().TotalBytes, t)
+	err = l2.Close()
+	isNil(err, t)
+
+	// corrupt counters start from zero.
+	var handled []error
+	err = ioutil.WriteFile(counters, []byte("{"), 0644)
+	isNil(err, t)
+	l3 := &Logger{
+		LogPathName:     dir + string(filepath.Separator),
+		LogFileName:     "foobar",
+		LogFileSuffix:   ".log",
+		PersistCounters: true,
+		ErrorHandler:    func(err error) { handled = append(handled, err) },
+	}
+	defer l3.Close()
+	err = l3.Init()
+	isNil(err, t)
+	equals(int64(0), l3.Stats().TotalBytes, t)
+	equals(1, len(handled), t)
+}
+
+func TestStats(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestStats", t)
+	defer os.RemoveAll(dir)
+
+	l := &Logger{fullPathFileName: logFile(dir)}
+	defer l.Close()
+	equals(int64(0), l.CurrentSize(), t)
+	_, err := l.Write([]byte("boo!"))
+	isNil(err, t)
+	equals(int64(4), l.CurrentSize(), t)
+
+	newFakeTime()
+	err = l.Rotate()
+	isNil(err, t)
+	equals(int64(0), l.CurrentSize(), t)
+	_, err = l.Write([]byte("foo"))
+	isNil(err, t)
+	equals(int64(3), l.CurrentSize(), t)
+	equals(Stats{TotalBytes: 7, TotalRotations: 1}, l.Stats(), t)
+
+	// retention removes the older backup and compresses the newer one.
+	older := backupFile(dir)
+	newFakeTime()
+	err = ioutil.WriteFile(backupFile(dir), []byte("data"), 0644)
+	isNil(err, t)
+	m := &Logger{
+		fullPathFileName:   logFile(dir),
+		Compress:           true,
+		LogMaxSaveQuantity: 1,
+	}
+	err = m.millRunOnce()
+	isNil(err, t)
+	notExist(older, t)
+	exists(backupFile(dir)+compressSuffix, t)
+	equals(Stats{TotalCompressions: 1, TotalRemoved: 1}, m.Stats(), t)
+}
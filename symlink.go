@@ -0,0 +1,51 @@
+package lumberjack
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+)
+
+// osSymlink exists so it can be mocked out by tests.
+var osSymlink = os.Symlink
+
+// writeSymlink points SymlinkPath at the open log file, replacing any link
+// there atomically.  Failures go to ErrorHandler.
+func (l *Logger) writeSymlink() {
+	if l.SymlinkPath == "" {
+		return
+	}
+	target, err := filepath.Abs(l.filename())
+	if err != nil {
+		target = l.filename()
+	}
+	if cur, err := os.Readlink(l.SymlinkPath); err == nil && cur == target {
+		return
+	}
+	if err := replaceLink(target, l.SymlinkPath, l.tempSuffix()); err != nil {
+		l.handleError(fmt.Errorf("can't update symlink %s: %w", l.SymlinkPath, err))
+	}
+}
+
+// replaceLink makes a symlink at name pointing at target, by making it under
+// a temporary name, with the extension tmpSuffix, and renaming it over name.
+// Where symlinks can't be made, as on Windows without the privilege, it
+// makes a hard link to target instead.
+func replaceLink(target, name, tmpSuffix string) error {
+	tmp := filepath.Join(filepath.Dir(name), "."+filepath.Base(name)+strconv.Itoa(os.Getpid())+tmpSuffix)
+	os.Remove(tmp)
+	err := osSymlink(target, tmp)
+	if err != nil && runtime.GOOS == "windows" {
+		err = osLink(target, tmp)
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
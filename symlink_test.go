@@ -0,0 +1,56 @@
+package lumberjack
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestSymlinkPath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need a privilege on windows")
+	}
+	currentTime = fakeTime
+	dir := makeTempDir("TestSymlinkPath", t)
+	defer os.RemoveAll(dir)
+
+	link := filepath.Join(dir, "current.log")
+	l := &Logger{
+		fullPathFileName: logFile(dir),
+		SymlinkPath:      link,
+	}
+	defer l.Close()
+	_, err := l.Write([]byte("boo!"))
+	isNil(err, t)
+	target, err := os.Readlink(link)
+	isNil(err, t)
+	equals(logFile(dir), target, t)
+	existsWithContent(link, []byte("boo!"), t)
+
+	// it follows the new file after a rotation.
+	newFakeTime()
+	err = l.Rotate()
+	isNil(err, t)
+	_, err = l.Write([]byte("foo"))
+	isNil(err, t)
+	existsWithContent(link, []byte("foo"), t)
+	// no temporary links are left behind.
+	fileCount(dir, 3, t)
+
+	// a stale link is replaced on reopening.
+	err = l.Close()
+	isNil(err, t)
+	err = os.Remove(link)
+	isNil(err, t)
+	err = os.Symlink(backupFile(dir), link)
+	isNil(err, t)
+	_, err = l.Write([]byte("bar"))
+	isNil(err, t)
+	existsWithContent(link, []byte("foobar"), t)
+}
+
+func TestSymlinkPathIsLogFile(t *testing.T) {
+	l := &Logger{fullPathFileName: "/var/log/foo.log", SymlinkPath: "/var/log/./foo.log"}
+	notNil(l.Validate(), t)
+}
@@ -0,0 +1,51 @@
+package lumberjack
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// locations caches loaded time zones by name, since loading one reads the
+// zone database.
+var locations sync.Map
+
+// loadLocation is time.LoadLocation with a cache.
+func loadLocation(name string) (*time.Location, error) {
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
+
+// validTimezone checks that name, if set, is a known time zone.
+func validTimezone(name string) error {
+	if name == "" {
+		return nil
+	}
+	if _, err := loadLocation(name); err != nil {
+		return fmt.Errorf("invalid Timezone %q: %s", name, err)
+	}
+	return nil
+}
+
+// location returns the time zone the Logger works in: Timezone if set, the
+// local time zone if LocalTime is set, and UTC otherwise.  An invalid Timezone,
+// which Init and Validate reject, falls back to UTC.
+func (l *Logger) location() *time.Location {
+	if l.Timezone != "" {
+		if loc, err := loadLocation(l.Timezone); err == nil {
+			return loc
+		}
+		return time.UTC
+	}
+	if l.LocalTime {
+		return time.Local
+	}
+	return time.UTC
+}
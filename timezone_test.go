@@ -0,0 +1,65 @@
+package lumberjack
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestTimezone(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestTimezone", t)
+	defer os.RemoveAll(dir)
+
+	// a zone that matches neither UTC nor, almost certainly, the local zone.
+	loc, err := time.LoadLocation("Asia/Kathmandu")
+	isNil(err, t)
+	l := &Logger{
+		LogPathName:   dir + string(filepath.Separator),
+		LogFileName:   "foobar",
+		LogFileSuffix: ".log",
+		LocalTime:     true,
+		Timezone:      "Asia/Kathmandu",
+		LogMaxSaveDay: 1,
+	}
+	isNil(l.Init(), t)
+	defer l.Close()
+
+	// the day ends at midnight in the configured zone.
+	now := fakeTime().In(loc)
+	endOfDay := time.Date(now.Year(), now.Month(), now.Day(), 23, 59, 59, 0, loc)
+	equals(endOfDay.Unix(), l.lastTimestamp, t)
+
+	b := []byte("boo!")
+	_, err = l.Write(b)
+	isNil(err, t)
+	err = l.Rotate()
+	isNil(err, t)
+	l.waitMill()
+
+	// the backup is named, and read back, in the configured zone, and so
+	// isn't mistaken for one old enough to remove.
+	backup := filepath.Join(dir, "foobar-"+now.Format(backupTimeFormat)+".log")
+	existsWithContent(backup, b, t)
+	files, err := l.oldLogFiles()
+	isNil(err, t)
+	equals(1, len(files), t)
+	equals(now.Truncate(time.Second).Unix(), files[0].timestamp.Unix(), t)
+	equals(loc, files[0].timestamp.Location(), t)
+}
+
+func TestInvalidTimezone(t *testing.T) {
+	dir := makeTempDir("TestInvalidTimezone", t)
+	defer os.RemoveAll(dir)
+
+	l := &Logger{
+		LogPathName:   dir + string(filepath.Separator),
+		LogFileName:   "foobar",
+		LogFileSuffix: ".log",
+		Timezone:      "Nowhere/Special",
+	}
+	notNil(l.Validate(), t)
+	notNil(l.Init(), t)
+}
@@ -0,0 +1,24 @@
+// +build !linux
+
+package lumberjack
+
+import (
+	"errors"
+	"os"
+)
+
+// dirWritable reports an error if dir does not look writable.  Off linux this
+// only inspects the permission bits, since there is no portable access(2).
+func dirWritable(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return errors.New("not a directory")
+	}
+	if info.Mode().Perm()&0222 == 0 {
+		return errors.New("permission denied")
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+package lumberjack
+
+import (
+	"syscall"
+)
+
+// wOK is the access(2) mode bit for write permission.
+const wOK = 0x2
+
+// dirWritable reports an error if the process can't create files in dir.
+func dirWritable(dir string) error {
+	return syscall.Access(dir, wOK)
+}